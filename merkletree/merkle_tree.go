@@ -5,12 +5,44 @@
 package merkletree
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
+)
+
+// 默克尔树构造版本
+const (
+	VERSION_1 = 1 // 旧版构造：仅补齐叶节点层，叶节点与中间节点使用相同的hash方式，只适用于1至MAX_LEAVES_V1个叶节点
+	VERSION_2 = 2 // 新版构造：任意叶节点数，奇数层的最后一个节点直接提升到上一层，叶节点与中间节点hash加不同前缀，支持空树
+)
+
+// VERSION_2中的hash前缀，区分叶节点与中间节点，防止以中间节点冒充叶节点的第二原像攻击
+const (
+	LEAF_PREFIX  = 0x00
+	INNER_PREFIX = 0x01
+)
+
+// VERSION_1只补齐叶节点层，超过4个叶节点时上层节点数为奇数，无法构造
+const MAX_LEAVES_V1 = 4
+
+var (
+	ErrIndexOutOfRange = errors.New("merkle leaf index out of range")                   // 生成默克尔证明时叶节点编号越界
+	ErrLeafCount       = errors.New("version 1 merkle tree supports 1 to 4 leaves only") // VERSION_1的叶节点数不在1至MAX_LEAVES_V1之间
 )
 
 // 默克尔数结构
 type MerkleTree struct {
-	RootNode *MerkleNode
+	RootNode   *MerkleNode
+	Leaf_count int // 原始数据个数，不含补齐的节点
+	Version    int // 构造版本
+
+	levels [][]MerkleNode // 自叶节点层到根节点层的各层节点，用于生成默克尔证明
+}
+
+// ProofNode，默克尔证明中的一个节点：从叶节点到根节点路径上每一层的兄弟节点
+type ProofNode struct {
+	Hash []byte `json:"Hash"` // 兄弟节点hash
+	Left bool   `json:"Left"` // 兄弟节点是否位于左侧
 }
 
 // 默克尔数节点结构
@@ -20,11 +52,26 @@ type MerkleNode struct {
 	Data  []byte // 默克尔树根节点
 }
 
-// NewMerkleTree，将节点组建为树
+// NewVersionedMerkleTree，按指定版本将节点组建为树
+// 参数：构造版本int，节点数据
+// 返回值：默克尔树，VERSION_1的叶节点数不合法时返回ErrLeafCount
+func NewVersionedMerkleTree(version int, data [][]byte) (*MerkleTree, error) {
+	if version == VERSION_1 {
+		return NewMerkleTree(data)
+	}
+	return newMerkleTreeV2(data), nil
+}
+
+// NewMerkleTree，将节点组建为树（VERSION_1）
 // 参数：节点数据
-// 返回值：默克尔树
-func NewMerkleTree(data [][]byte) *MerkleTree {
+// 返回值：默克尔树，叶节点数不在1至MAX_LEAVES_V1之间时返回ErrLeafCount
+func NewMerkleTree(data [][]byte) (*MerkleTree, error) {
+	if len(data) == 0 || len(data) > MAX_LEAVES_V1 {
+		return nil, ErrLeafCount
+	}
 	var nodes []MerkleNode
+	var levels [][]MerkleNode
+	leaf_count := len(data)
 	// 确保必须为2的整数倍节点
 	if len(data)%2 != 0 {
 		data = append(data, data[len(data)-1])
@@ -37,6 +84,7 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 
 	// 两层循环完成节点树形构造
 	for i := 0; i < len(data)/2; i++ {
+		levels = append(levels, nodes)
 		var new_level []MerkleNode
 		// i=0时，叶节点hash合并
 		// i=1时，注意nodes已经不是原来的nodes
@@ -47,10 +95,63 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 		// nodes已经升级为此前循环生成的新节点
 		nodes = new_level
 	}
+	levels = append(levels, nodes)
+
+	mTree := MerkleTree{&nodes[0], leaf_count, VERSION_1, levels} // 构造默克尔树
+
+	return &mTree, nil
+}
+
+// newMerkleTreeV2，将节点组建为树（VERSION_2）：逐层两两合并，奇数层的最后一个节点直接提升到上一层；
+// 没有数据时根节点为空数据的hash
+// 参数：节点数据
+// 返回值：默克尔树
+func newMerkleTreeV2(data [][]byte) *MerkleTree {
+	if len(data) == 0 {
+		empty := sha256.Sum256(nil)
+		root := MerkleNode{Data: empty[:]}
+		return &MerkleTree{&root, 0, VERSION_2, [][]MerkleNode{{root}}}
+	}
+
+	nodes := make([]MerkleNode, 0, len(data))
+	for _, datum := range data {
+		nodes = append(nodes, MerkleNode{Data: leafHash(datum)})
+	}
+	levels := [][]MerkleNode{nodes}
+	for len(nodes) > 1 { // 每次循环构造一层
+		new_level := make([]MerkleNode, 0, (len(nodes)+1)/2)
+		for j := 0; j < len(nodes); j += 2 {
+			if j+1 == len(nodes) { // 奇数层的最后一个节点不与自身合并，直接提升
+				new_level = append(new_level, nodes[j])
+				continue
+			}
+			new_level = append(new_level, MerkleNode{
+				Left:  &nodes[j],
+				Right: &nodes[j+1],
+				Data:  innerHash(nodes[j].Data, nodes[j+1].Data),
+			})
+		}
+		nodes = new_level
+		levels = append(levels, nodes)
+	}
 
-	mTree := MerkleTree{&nodes[0]} // 构造默克尔树
+	return &MerkleTree{&nodes[0], len(data), VERSION_2, levels}
+}
+
+// leafHash，VERSION_2叶节点hash：H(0x00||data)
+func leafHash(data []byte) []byte {
+	hash := sha256.Sum256(append([]byte{LEAF_PREFIX}, data...))
+	return hash[:]
+}
 
-	return &mTree
+// innerHash，VERSION_2中间节点hash：H(0x01||left||right)
+func innerHash(left, right []byte) []byte {
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, INNER_PREFIX)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+	hash := sha256.Sum256(buf)
+	return hash[:]
 }
 
 // NewMerkleNode，创建默克尔树节点，既要支持中间节点，也要支持叶子节点
@@ -74,3 +175,54 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 
 	return &m_node
 }
+
+// Proof，生成第index个原始数据的默克尔证明，按从叶节点到根节点的顺序给出各层兄弟节点；
+// 被直接提升的节点在该层没有兄弟节点
+// 参数：原始数据编号int
+// 返回值：默克尔证明[]ProofNode，错误error
+func (m *MerkleTree) Proof(index int) ([]ProofNode, error) {
+	if index < 0 || index >= m.Leaf_count {
+		return nil, ErrIndexOutOfRange
+	}
+
+	var proof []ProofNode
+	for _, level := range m.levels[:len(m.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, ProofNode{Hash: level[sibling].Data, Left: sibling < index})
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyProof，校验VERSION_1默克尔证明：由原始数据与各层兄弟节点逐层计算，结果须等于根节点hash
+// 参数：根节点hash[]byte，原始数据[]byte，默克尔证明[]ProofNode
+// 返回值：校验结果bool
+func VerifyProof(root, leaf []byte, proof []ProofNode) bool {
+	return VerifyVersionedProof(VERSION_1, root, leaf, proof)
+}
+
+// VerifyVersionedProof，按指定构造版本校验默克尔证明
+// 参数：构造版本int，根节点hash[]byte，原始数据[]byte，默克尔证明[]ProofNode
+// 返回值：校验结果bool
+func VerifyVersionedProof(version int, root, leaf []byte, proof []ProofNode) bool {
+	var hash []byte
+	if version == VERSION_1 {
+		hash = NewMerkleNode(nil, nil, leaf).Data
+	} else {
+		hash = leafHash(leaf)
+	}
+	for _, sibling := range proof {
+		left, right := hash, sibling.Hash
+		if sibling.Left {
+			left, right = sibling.Hash, hash
+		}
+		if version == VERSION_1 {
+			hash = NewMerkleNode(&MerkleNode{Data: left}, &MerkleNode{Data: right}, nil).Data
+		} else {
+			hash = innerHash(left, right)
+		}
+	}
+	return bytes.Equal(hash, root)
+}
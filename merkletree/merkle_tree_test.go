@@ -1,8 +1,10 @@
 package merkletree
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -69,7 +71,105 @@ func TestNewMerkleTree(t *testing.T) {
 	n7 := NewMerkleNode(n5, n6, nil)
 
 	rootHash := fmt.Sprintf("%x", n7.Data)
-	mTree := NewMerkleTree(data)
+	mTree, err := NewMerkleTree(data)
+	assert.NoError(t, err)
 
 	assert.Equal(t, rootHash, fmt.Sprintf("%x", mTree.RootNode.Data), "Merkle tree root hash is correct")
+
+	// 叶节点数超出VERSION_1的构造范围时返回错误，不越界访问
+	for _, n := range []int{0, 5, 6, 7, 8, 9} {
+		_, err = NewMerkleTree(make([][]byte, n))
+		assert.ErrorIs(t, err, ErrLeafCount, "%d leaves", n)
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	data := [][]byte{
+		[]byte("node1"),
+		[]byte("node2"),
+		[]byte("node3"),
+		[]byte("node4"),
+	}
+	for n := 1; n <= len(data); n++ {
+		mTree, err := NewMerkleTree(data[:n])
+		assert.NoError(t, err)
+		root := mTree.RootNode.Data
+		for i := 0; i < n; i++ {
+			proof, err := mTree.Proof(i)
+			assert.NoError(t, err)
+			assert.True(t, VerifyProof(root, data[i], proof), "proof of leaf %d/%d is valid", i, n)
+			assert.False(t, VerifyProof(root, []byte("forged"), proof), "proof of forged leaf is invalid")
+		}
+		_, err = mTree.Proof(n)
+		assert.ErrorIs(t, err, ErrIndexOutOfRange)
+	}
+}
+
+// referenceRoot，VERSION_2的参考实现（RFC 6962）：以不超过n的最大2的幂次拆分左右子树，递归计算根节点hash
+func referenceRoot(data [][]byte) []byte {
+	switch len(data) {
+	case 0:
+		hash := sha256.Sum256(nil)
+		return hash[:]
+	case 1:
+		hash := sha256.Sum256(append([]byte{LEAF_PREFIX}, data[0]...))
+		return hash[:]
+	}
+	k := 1
+	for k*2 < len(data) {
+		k *= 2
+	}
+	buf := append([]byte{INNER_PREFIX}, referenceRoot(data[:k])...)
+	buf = append(buf, referenceRoot(data[k:])...)
+	hash := sha256.Sum256(buf)
+	return hash[:]
+}
+
+// mustTree，构造指定版本的默克尔树，构造失败时测试失败
+func mustTree(t *testing.T, version int, data [][]byte) *MerkleTree {
+	mTree, err := NewVersionedMerkleTree(version, data)
+	if err != nil {
+		t.Fatalf("version %d tree of %d leaves: %v", version, len(data), err)
+	}
+	return mTree
+}
+
+func TestMerkleTreeV2(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n <= 70; n++ {
+		data := make([][]byte, n)
+		for i := range data {
+			data[i] = make([]byte, rnd.Intn(64))
+			rnd.Read(data[i])
+		}
+		mTree := mustTree(t, VERSION_2, data)
+		root := mTree.RootNode.Data
+		assert.Equal(t, referenceRoot(data), root, "root of %d leaves matches the reference", n)
+
+		for i := 0; i < n; i++ {
+			proof, err := mTree.Proof(i)
+			assert.NoError(t, err)
+			assert.True(t, VerifyVersionedProof(VERSION_2, root, data[i], proof), "proof of leaf %d/%d is valid", i, n)
+			assert.False(t, VerifyVersionedProof(VERSION_2, root, append(data[i], 0), proof), "proof of forged leaf is invalid")
+			assert.False(t, VerifyProof(root, data[i], proof), "proof is bound to its version")
+		}
+		_, err := mTree.Proof(n)
+		assert.ErrorIs(t, err, ErrIndexOutOfRange)
+	}
+
+	// 以两个叶节点hash的拼接冒充叶节点，不能得到相同的根
+	data := [][]byte{[]byte("node1"), []byte("node2")}
+	inner := append(leafHash(data[0]), leafHash(data[1])...)
+	assert.NotEqual(t, mustTree(t, VERSION_2, data).RootNode.Data,
+		mustTree(t, VERSION_2, [][]byte{inner}).RootNode.Data, "leaf and inner hashes are separated")
+
+	// 重复最后一个叶节点会改变根，不存在交易列表的可塑性
+	dup := append(data, data[1])
+	assert.NotEqual(t, mustTree(t, VERSION_2, data).RootNode.Data,
+		mustTree(t, VERSION_2, dup).RootNode.Data, "duplicated leaf changes the root")
+
+	// VERSION_1保持旧版结果
+	v1, err := NewMerkleTree(data)
+	assert.NoError(t, err)
+	assert.Equal(t, v1.RootNode.Data, mustTree(t, VERSION_1, data).RootNode.Data)
 }
@@ -7,6 +7,7 @@ replace (
 	qblock => ../qblock
 	qbtx => ../qbtx
 	qkdserv => ../qkdserv
+	qrng => ../qrng
 	uss => ../uss
 	utils => ../utils
 )
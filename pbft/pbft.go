@@ -8,3 +8,8 @@ type PBFT interface {
 	Commit(prepare *PrepareMsg) *CommitMsg
 	Reply(commit *CommitMsg) *ReplyMsg
 }
+
+// BlockValidator，区块校验接口：由共识节点对应的区块链节点依据其账本与UTXO集合完整校验请求区块
+type BlockValidator interface {
+	ValidateBlock(block *qblock.Block) error // 返回拒绝原因，通过时返回nil
+}
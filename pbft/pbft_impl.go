@@ -9,10 +9,11 @@ import (
 
 // pbft状态标识
 type State struct {
-	View                 View     // 视图号
-	Msg_logs             *MsgLogs // 缓存数据
-	Last_sequence_number int64    // 上次共识序列号
-	Current_stage        Stage    // 当前状态
+	View                 View           // 视图号
+	Msg_logs             *MsgLogs       // 缓存数据
+	Last_sequence_number int64          // 上次共识序列号
+	Current_stage        Stage          // 当前状态
+	Block_validator      BlockValidator // 区块完整校验，为nil时只校验签名
 }
 
 // pbft缓存数据，用于存放pbft过程中的各类消息
@@ -59,5 +60,6 @@ func CreateState(view int64, lastSequenceNumber int64) *State {
 		},
 		Last_sequence_number: lastSequenceNumber, // 上一个序列号
 		Current_stage:        Idle,               // 目前状态，节点创立，即将进入共识
+		Block_validator:      nil,                // 由调用者按需设置
 	}
 }
@@ -47,6 +47,11 @@ type CommitMsg struct {
 	Sign_i          uss.USSToeplitzHashSignMsg // 当前从节点i对Commit消息的签名
 }
 
+// 区块校验应答消息，由区块链节点发往共识节点
+type ValidateReplyMsg struct {
+	Errors []string // 区块被拒绝的原因，通过时为空
+}
+
 // PrePrepareMsg.signMessageEncode,对预准备消息编码，形成待签名消息
 // 参数：预准备消息PrePrepareMsg
 // 返回值：待签名消息[]byte
@@ -81,6 +81,12 @@ func (state *State) verifyPrePrepareMsg(preprepare *PrePrepareMsg) bool {
 		defer file.Close()
 		log.Println("the digest is wrong!")
 		result = false
+	} else if !preprepare.Request.VerifyMerkleRoot() {
+		file, _ := utils.Init_log(LOG_ERROR_PATH + qkdserv.Node_name + ".log")
+		log.SetPrefix("[Prepare error]")
+		defer file.Close()
+		log.Println("the merkle root is wrong!")
+		result = false
 	} else if !uss.UnconditionallySecureVerifySign(preprepare.Request.Block_uss) {
 		if !state.verifyRequestTX(preprepare.Request.Transactions) {
 			file, _ := utils.Init_log(LOG_ERROR_PATH + qkdserv.Node_name + ".log")
@@ -101,6 +107,14 @@ func (state *State) verifyPrePrepareMsg(preprepare *PrePrepareMsg) bool {
 		defer file.Close()
 		log.Println("the tx is wrong!")
 		result = false
+	} else if !state.verifyRequestFee(preprepare.Request) {
+		result = false
+	} else if !state.validateRequestBlock(preprepare.Request) {
+		file, _ := utils.Init_log(LOG_ERROR_PATH + qkdserv.Node_name + ".log")
+		log.SetPrefix("[Prepare error]")
+		defer file.Close()
+		log.Println("the block is rejected by block validation!")
+		result = false
 	} else {
 		file, _ := utils.Init_log(utils.VERIFY_PATH + qkdserv.Node_name + ".log")
 		defer file.Close()
@@ -67,21 +67,27 @@ func (state *State) PrePrePare(request *qblock.Block) *PrePrepareMsg {
 // 参数：交易消息[]*qbtx.Transaction
 // 返回值：验证结果bool
 func (state *State) verifyRequestTX(txs []*qbtx.Transaction) bool {
-
-	//TODO:验证每条交易信息的签名
 	verify_num := 0
 	for _, tx := range txs {
-		if tx.VerifyUSSTransactionSign() { // 验证签名正确性
+		errs := tx.VerifyUSSTransactionSign() // 验证签名正确性
+		if len(errs) == 0 {
 			file, _ := utils.Init_log(utils.VERIFY_PATH + qkdserv.Node_name + ".log")
 			log.SetPrefix("[STAGE-PrePrepare/Prepare:VERIFY of Transaction SIGN]")
 			log.Println("transaciton ID:", hex.EncodeToString(tx.TX_id))
-			defer file.Close()
 			for _, vin := range tx.TX_vin {
 				log.Println("Index of uss:", hex.EncodeToString(vin.TX_uss_sign.Sign_index.Sign_task_sn[:]))
 			}
 			log.Printf("Verify of transaction sign success\n\n")
+			file.Close() // 每笔交易记录完即关闭，不在循环中累积文件句柄
 
 			verify_num++
+		} else {
+			file, _ := utils.Init_log(LOG_ERROR_PATH + qkdserv.Node_name + ".log")
+			log.SetPrefix("[Pre-prepare error]")
+			for _, err := range errs { // 逐条记录未通过校验的输入项
+				log.Println(err)
+			}
+			file.Close()
 		}
 	}
 	if verify_num == len(txs) {
@@ -94,3 +100,39 @@ func (state *State) verifyRequestTX(txs []*qbtx.Transaction) bool {
 		return false
 	}
 }
+
+// State.verifyRequestFee，验证区块中的手续费交易支付给区块提议者
+// 参数：请求消息*qblock.Block
+// 返回值：验证结果bool
+func (state *State) verifyRequestFee(request *qblock.Block) bool {
+	if len(request.Transactions) == 0 || !request.Transactions[0].IsFeeTX() {
+		return true
+	}
+	fee_tx := request.Transactions[0]
+	if len(fee_tx.TX_vout) != 1 || utils.GetAddrOwner(fee_tx.TX_vout[0].TX_dst) != request.Proposer() {
+		file, _ := utils.Init_log(LOG_ERROR_PATH + qkdserv.Node_name + ".log")
+		log.SetPrefix("[Prepare error]")
+		defer file.Close()
+		log.Println("the fee of block is not paid to the proposer:", hex.EncodeToString(fee_tx.TX_id))
+		return false
+	}
+	return true
+}
+
+// State.validateRequestBlock，由本节点的区块链节点完整校验请求区块：区块hash、衔接最新区块、时间戳、默克尔树根，
+// 以及交易的被引用输出存在且未花费、金额守恒、区块内无双花
+// 参数：请求消息*qblock.Block
+// 返回值：验证结果bool
+func (state *State) validateRequestBlock(request *qblock.Block) bool {
+	if state.Block_validator == nil {
+		return true
+	}
+	if err := state.Block_validator.ValidateBlock(request); err != nil {
+		file, _ := utils.Init_log(LOG_ERROR_PATH + qkdserv.Node_name + ".log")
+		log.SetPrefix("[Prepare error]")
+		defer file.Close()
+		log.Println(err)
+		return false
+	}
+	return true
+}
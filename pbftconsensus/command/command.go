@@ -7,6 +7,7 @@ import (
 	"os"
 	"pbftconsensus/network"
 	"qkdserv"
+	"qrng"
 )
 
 // CLI responsible for processing command line arguments
@@ -38,6 +39,14 @@ func (command *COMM) Run() {
 	qkdserv.Node_name = nodeName // 调用此程序的当前节点或客户端名称
 	// 初始化签名密钥池
 	qkdserv.QKD_sign_random_matrix_pool = make(map[qkdserv.QKDSignMatrixIndex]qkdserv.QKDSignRandomsMatrix)
+	// 选择熵源，QRNG_SOURCE未设置时使用操作系统随机数
+	if spec := os.Getenv("QRNG_SOURCE"); spec != "" {
+		src, err := qrng.NewSourceFromSpec(spec)
+		if err != nil {
+			log.Panic(err)
+		}
+		qrng.SetDefault(src)
+	}
 
 	// 1.利用NewFlagSet函数立flag。
 	// name参数的种类："getbalance"，对应命令行参数os.Args[1]，代表要做什么事情
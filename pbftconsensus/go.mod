@@ -7,6 +7,7 @@ require (
 	qblock v0.0.0-00010101000000-000000000000
 	qbtx v0.0.0-00010101000000-000000000000
 	qkdserv v0.0.0-00010101000000-000000000000
+	qrng v0.0.0-00010101000000-000000000000
 	utils v0.0.0-00010101000000-000000000000
 )
 
@@ -16,6 +17,7 @@ replace (
 	qblock => ../qblock
 	qbtx => ../qbtx
 	qkdserv => ../qkdserv
+	qrng => ../qrng
 	uss => ../uss
 	utils => ../utils
 )
@@ -0,0 +1,37 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"pbft"
+	"qblock"
+	"strings"
+	"utils"
+)
+
+// nodeValidator，通过http请求本节点对应的区块链节点校验区块，区块链节点持有账本与UTXO集合
+type nodeValidator struct {
+	url string // 区块链节点地址
+}
+
+// ValidateBlock，请求区块链节点完整校验区块，请求失败时视为校验不通过
+// 参数：区块*qblock.Block
+// 返回值：拒绝原因error，通过时为nil
+func (v *nodeValidator) ValidateBlock(block *qblock.Block) error {
+	jsonMsg, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	data, err := utils.Post(v.url+"/validate", jsonMsg)
+	if err != nil {
+		return err
+	}
+	var reply pbft.ValidateReplyMsg
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return err
+	}
+	if len(reply.Errors) != 0 {
+		return errors.New(strings.Join(reply.Errors, "; "))
+	}
+	return nil
+}
@@ -66,6 +66,7 @@ func (consensus *NodeConsensus) createStateForNewConsensus() error {
 	}
 	// 创建新的节点状态，即进行节点状态的初始化
 	consensus.PBFT.CurrentState = pbft.CreateState(consensus.View.ID, lastSequenceID)
+	consensus.PBFT.CurrentState.Block_validator = &nodeValidator{url: consensus.BC_url} // 由本节点的区块链节点校验区块
 	return nil
 }
 
@@ -10,6 +10,7 @@ require (
 	qblock v0.0.0-00010101000000-000000000000
 	qbtx v0.0.0-00010101000000-000000000000
 	qkdserv v0.0.0-00010101000000-000000000000
+	qrng v0.0.0-00010101000000-000000000000
 	uss v0.0.0-00010101000000-000000000000
 	utils v0.0.0-00010101000000-000000000000
 )
@@ -20,6 +21,7 @@ replace (
 	qblock => ../qblock
 	qbtx => ../qbtx
 	qkdserv => ../qkdserv
+	qrng => ../qrng
 	uss => ../uss
 	utils => ../utils
 )
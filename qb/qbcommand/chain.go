@@ -0,0 +1,125 @@
+package qbcommand
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"qb/qbstore"
+	"qb/quantumbc"
+	"qblock"
+)
+
+// exportChain，将本节点自高度from起的区块写入导出文件，须在节点停止时执行
+func (command *COMM) exportChain(nodeID, outPath string, from int64) {
+	bc := quantumbc.NewBlockchain(nodeID)
+	defer bc.DB.Close()
+
+	file, err := os.Create(outPath)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	count, err := bc.ExportChain(w, from)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Exported %d blocks (height %d-%d) of %s to %s\n", count, from, from+int64(count)-1, nodeID, outPath)
+}
+
+// importChain，将导出文件中的区块经完整校验后连接到本节点账本，账本不存在时由分发的创世区块创建，须在节点停止时执行
+func (command *COMM) importChain(nodeID, inPath string) {
+	file, err := os.Open(inPath)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer file.Close()
+
+	genesis, _ := loadGenesis() // 导入的区块须按创世区块记录的资产发行方校验
+	var bc *quantumbc.Blockchain
+	if quantumbc.DBExists(quantumbc.DBPath(nodeID)) {
+		bc = quantumbc.NewBlockchain(nodeID)
+	} else {
+		bc = quantumbc.CreateBlockchain(genesis, nodeID)
+	}
+	defer bc.DB.Close()
+
+	count, err := bc.ImportChain(file)
+	if err != nil { // 出错前已连接的区块保留
+		log.Panicf("ERROR: %v (imported %d blocks, height is now %d)", err, count, bc.GetlastHeight())
+	}
+	fmt.Printf("Imported %d blocks into %s, height is now %d\n", count, nodeID, bc.GetlastHeight())
+}
+
+// exportSnapshot，导出本节点最新区块处的UTXO快照，并打印供新节点核对的状态hash，须在节点停止时执行
+func (command *COMM) exportSnapshot(nodeID, outPath string) {
+	bc := quantumbc.NewBlockchain(nodeID)
+	defer bc.DB.Close()
+
+	file, err := os.Create(outPath)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	meta, err := bc.ExportSnapshot(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Snapshot of %s at height %d (%x) written to %s\n", nodeID, meta.Height, meta.Block_hash, outPath)
+	fmt.Printf("State hash: %x\n", meta.State_hash)
+}
+
+// importSnapshot，由UTXO快照创建本节点账本，快照须与可信的状态hash相同，本节点此前不能有账本
+func (command *COMM) importSnapshot(nodeID, inPath, stateHash string) {
+	trusted, err := hex.DecodeString(stateHash)
+	if err != nil || len(trusted) == 0 {
+		log.Panic("ERROR: state hash is not valid")
+	}
+	genesis, err := qblock.LoadGenesisBlock(qblock.GENESIS_BLOCK_PATH)
+	if err != nil {
+		log.Panic(err)
+	}
+	dbFile := quantumbc.DBPath(nodeID)
+	if quantumbc.DBExists(dbFile) {
+		log.Panicf("ERROR: %v: %s", quantumbc.ErrLedgerExists, dbFile)
+	}
+	file, err := os.Open(inPath)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer file.Close()
+
+	store, err := qbstore.OpenBolt(dbFile)
+	if err != nil {
+		log.Panic(err)
+	}
+	bc, err := quantumbc.ImportSnapshot(store, file, genesis, trusted)
+	if err != nil {
+		store.Close()
+		os.Remove(dbFile) // 不保留导入失败的空账本
+		log.Panic(err)
+	}
+	defer bc.DB.Close()
+	fmt.Printf("Ledger of %s created from snapshot at height %d (%x)\n", nodeID, bc.GetlastHeight(), bc.GetlastHash())
+}
+
+// pruneChain，删除本节点最新depth个区块之前的区块内容，保留区块头、索引与UTXO集合，须在节点停止时执行
+func (command *COMM) pruneChain(nodeID string, depth int64) {
+	bc := quantumbc.NewBlockchain(nodeID)
+	defer bc.DB.Close()
+
+	pruned, err := bc.Prune(depth)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Pruned %d blocks of %s, blocks below height %d are no longer stored\n", pruned, nodeID, bc.BaseHeight())
+}
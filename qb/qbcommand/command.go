@@ -1,11 +1,20 @@
 package qbcommand
 
 import (
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"qb/qbutxo"
+	"qb/qbwallet"
+	"qb/quantumbc"
+	"qblock"
+	"qbtx"
 	"qkdserv"
+	"qrng"
+	"strconv"
 )
 
 // CLI responsible for processing command line arguments
@@ -14,9 +23,40 @@ type COMM struct{}
 // 命令行帮助函数
 func (command *COMM) printUsage() {
 	fmt.Println("Usage:")
-	fmt.Println("  getbalance -address ADDRESS - Get balance of ADDRESS")                                     // 客户端实现余额查询
-	fmt.Println("  transaction -from FROM -to TO -amount AMOUNT -Send AMOUNT of BestiCoins from FROM to TO.") // 客户端实现交易
-	fmt.Println("  startnode -Start a node with ID specified in NODE_ID env.")                                // 开启联盟节点
+	fmt.Println("  getbalance -address ADDRESS -asset ID - Get balance of ADDRESS from the primary, of every asset if ID is empty")  // 客户端实现余额查询
+	fmt.Println("  history -address ADDRESS -offset N -limit N - List payments of ADDRESS, newest first")                            // 客户端查询收支记录
+	fmt.Println("  transaction -from FROM -to TO,... -amount AMOUNT,... -fee FEE -Send AMOUNT of BestiCoins from FROM to each TO.")  // 客户端实现交易
+	fmt.Println("      -change ADDRESS -strategy largest|smallest|bnb -inputs TXID:INDEX,... (optional)")                            // 找零地址、输入选择策略与手动指定输入
+	fmt.Println("      -locktime HEIGHT|UNIXTIME -lockblocks N (optional)")                                                          // 交易锁定时间与付款输出的相对锁定
+	fmt.Println("      -asset ID -Send AMOUNT of asset ID instead; the fee is always paid in BestiCoins (optional)")                 // 资产转账
+	fmt.Println("  issue -from ISSUER -to TO,... -amount AMOUNT,... -asset ID -fee FEE -Issue new units of asset ID.")               // 发行资产
+	fmt.Println("      -FROM must be the issuer of ID recorded in the genesis block.")                                               // 须为创世区块记录的发行方
+	fmt.Println("  multisig -m M -addrs ADDR,... -Print the locking script spendable by M of the ADDRs; lock coins with scriptpay.") // 多重签名锁定脚本
+	fmt.Println("  multisigtx -m M -addrs ADDR,... -to TO,... -amount AMOUNT,... -fee FEE -change ADDRESS -out FILE")                // 构造多重签名交易
+	fmt.Println("      -Write an unsigned transaction spending the multisig address to FILE.")                                       // 未签名的交易写入文件
+	fmt.Println("  cosign -in FILE -out FILE -Add the signature of NODE_NAME to the multisig inputs of the transaction in FILE.")    // 共同签名
+	fmt.Println("  sendtx -in FILE -Send the signed transaction in FILE.")                                                           // 提交已签名的交易
+	fmt.Println("  htlccreate -from FROM -to RECEIVER -amount AMOUNT -fee FEE -timeout HEIGHT -hashlock HASH")                       // 创建哈希时间锁合约
+	fmt.Println("      -Lock AMOUNT for RECEIVER until HEIGHT; a random secret is generated if HASH is empty.")                      // 未给出哈希锁时生成随机原像
+	fmt.Println("  htlcclaim -hashlock HASH -receiver ADDR -sender ADDR -timeout HEIGHT -preimage SECRET -fee FEE")                  // 接收方领取合约
+	fmt.Println("  htlcrefund -hashlock HASH -receiver ADDR -sender ADDR -timeout HEIGHT -fee FEE")                                  // 发送方超时后退款
+	fmt.Println("  script -template p2a|htlc|timelock -Print a standard locking script and its address, with")                       // 标准锁定脚本
+	fmt.Println("      -addr ADDR (p2a, timelock) -locktime HEIGHT|UNIXTIME (timelock)")                                             // 各模板的参数
+	fmt.Println("      -hashlock HASH -receiver ADDR -sender ADDR -timeout HEIGHT (htlc)")                                           // 合约模板的参数
+	fmt.Println("  scriptpay -from FROM -script SCRIPT -amount AMOUNT -fee FEE -Lock AMOUNT by the locking script (hex).")           // 付款到锁定脚本
+	fmt.Println("  scriptspend -script SCRIPT -to TO -fee FEE -unlock sig|claim|refund -preimage SECRET -locktime N")                // 以解锁脚本花费
+	fmt.Println("      -Spend all outputs locked by SCRIPT with the signature of NODE_NAME.")                                        // 当前节点签名
+	fmt.Println("  verifytx -txid TXID -Verify that transaction TXID is included in the blockchain, confirmed by F+1 replicas.")     // 客户端校验交易是否上链
+	fmt.Println("  genesis -spec SPEC -out FILE -Build the genesis block from SPEC and write it to FILE.")                           // 生成创世区块
+	fmt.Println("  reindex -Rebuild the UTXO set of the local node from the whole chain (repair).")                                  // 修复UTXO集合
+	fmt.Println("  checkutxo -Compare the UTXO set of the local node with a full rebuild.")                                          // UTXO一致性检查
+	fmt.Println("  verifychain -Audit the blocks, signatures, indexes and UTXO set of the local node.")                              // 审计账本
+	fmt.Println("  exportchain -out FILE -from HEIGHT -Write the blocks of the local node to FILE.")                                 // 导出区块
+	fmt.Println("  importchain -in FILE -Validate and connect the blocks in FILE to the local node.")                                // 导入区块
+	fmt.Println("  exportsnapshot -out FILE -Write the UTXO snapshot at the tip of the local node to FILE.")                         // 导出UTXO快照
+	fmt.Println("  importsnapshot -in FILE -statehash HASH -Create the local ledger from a trusted UTXO snapshot.")                  // 由UTXO快照创建账本
+	fmt.Println("  prunechain -depth N -Delete the bodies of all but the newest N blocks of the local node.")                        // 修剪账本
+	fmt.Println("  startnode -prune N -Start a node with ID specified in NODE_ID env, keeping N full blocks if N>0.")                // 开启联盟节点
 }
 
 func (command *COMM) validateArgs() {
@@ -39,22 +79,129 @@ func (command *COMM) Run() {
 	qkdserv.Node_name = nodeName // 调用此程序的当前节点或客户端名称
 	// 初始化签名密钥池
 	qkdserv.QKD_sign_random_matrix_pool = make(map[qkdserv.QKDSignMatrixIndex]qkdserv.QKDSignRandomsMatrix)
+	// 账本数据目录，QB_DATA_DIR未设置时使用默认目录
+	if dir := os.Getenv("QB_DATA_DIR"); dir != "" {
+		quantumbc.Data_dir = dir
+	}
+	// 选择熵源，QRNG_SOURCE未设置时使用操作系统随机数
+	if spec := os.Getenv("QRNG_SOURCE"); spec != "" {
+		src, err := qrng.NewSourceFromSpec(spec)
+		if err != nil {
+			log.Panic(err)
+		}
+		qrng.SetDefault(src)
+	}
 
 	// 1.利用NewFlagSet函数立flag。
 	// name参数的种类："getbalance"，对应命令行参数os.Args[1]，代表要做什么事情
 	// errorHandling错误的处理方式：继续ContineOnError，退出ExitOnError，抛出恐慌PanicOnError
-	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError) // 查询余额
-	txCmd := flag.NewFlagSet("transaction", flag.ExitOnError)        // 交易
-	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)   // 创建节点
+	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)         // 查询余额
+	historyCmd := flag.NewFlagSet("history", flag.ExitOnError)               // 查询收支记录
+	txCmd := flag.NewFlagSet("transaction", flag.ExitOnError)                // 交易
+	issueCmd := flag.NewFlagSet("issue", flag.ExitOnError)                   // 发行资产
+	multiSigCmd := flag.NewFlagSet("multisig", flag.ExitOnError)             // 多重签名地址
+	multiSigTXCmd := flag.NewFlagSet("multisigtx", flag.ExitOnError)         // 构造多重签名交易
+	coSignCmd := flag.NewFlagSet("cosign", flag.ExitOnError)                 // 共同签名
+	sendTXCmd := flag.NewFlagSet("sendtx", flag.ExitOnError)                 // 提交已签名的交易
+	htlcCreateCmd := flag.NewFlagSet("htlccreate", flag.ExitOnError)         // 创建哈希时间锁合约
+	htlcClaimCmd := flag.NewFlagSet("htlcclaim", flag.ExitOnError)           // 领取合约
+	htlcRefundCmd := flag.NewFlagSet("htlcrefund", flag.ExitOnError)         // 合约退款
+	scriptCmd := flag.NewFlagSet("script", flag.ExitOnError)                 // 标准锁定脚本
+	scriptPayCmd := flag.NewFlagSet("scriptpay", flag.ExitOnError)           // 付款到锁定脚本
+	scriptSpendCmd := flag.NewFlagSet("scriptspend", flag.ExitOnError)       // 以解锁脚本花费
+	verifyTXCmd := flag.NewFlagSet("verifytx", flag.ExitOnError)             // 校验交易包含证明
+	genesisCmd := flag.NewFlagSet("genesis", flag.ExitOnError)               // 生成创世区块
+	reindexCmd := flag.NewFlagSet("reindex", flag.ExitOnError)               // 修复UTXO集合
+	checkUTXOCmd := flag.NewFlagSet("checkutxo", flag.ExitOnError)           // UTXO一致性检查
+	verifyChainCmd := flag.NewFlagSet("verifychain", flag.ExitOnError)       // 审计账本
+	exportChainCmd := flag.NewFlagSet("exportchain", flag.ExitOnError)       // 导出区块
+	importChainCmd := flag.NewFlagSet("importchain", flag.ExitOnError)       // 导入区块
+	exportSnapshotCmd := flag.NewFlagSet("exportsnapshot", flag.ExitOnError) // 导出UTXO快照
+	importSnapshotCmd := flag.NewFlagSet("importsnapshot", flag.ExitOnError) // 由UTXO快照创建账本
+	pruneChainCmd := flag.NewFlagSet("prunechain", flag.ExitOnError)         // 修剪账本
+	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)           // 创建节点
 
 	// 2.设定参数接收变量，如果有多个参数值要获取，需要设置多个变量
 	// name参数名称：如"address"
 	// value默认值：如 ""，0
 	// usage对应的元素：如"The address to get balance for"
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
+	getBalanceAsset := getBalanceCmd.String("asset", "", "Asset ID to get balance of, every asset if empty")
+	historyAddress := historyCmd.String("address", "", "The address to list payments for")
+	historyOffset := historyCmd.Int("offset", 0, "Number of newest payments to skip")
+	historyLimit := historyCmd.Int("limit", 20, "Maximum number of payments to list")
 	txFrom := txCmd.String("from", "", "Source wallet address")
-	txTo := txCmd.String("to", "", "Destination wallet address")
-	txAmount := txCmd.Int("amount", 0, "Amount to send")
+	txTo := txCmd.String("to", "", "Destination wallet addresses, separated by commas")
+	txAmount := txCmd.String("amount", "", "Amounts to send, one for each destination")
+	txFee := txCmd.Int("fee", 0, "Fee paid to the block proposer")
+	txChange := txCmd.String("change", "", "Change address, the source address if empty")
+	txStrategy := txCmd.String("strategy", "", "Coin selection: largest, smallest or bnb (exact match); default bnb then largest")
+	txInputs := txCmd.String("inputs", "", "Outputs to spend as TXID:INDEX, separated by commas; disables coin selection")
+	txLockTime := txCmd.Int64("locktime", 0, "Earliest block height (or unix time if >= 500000000) that may include the transaction")
+	txLockBlocks := txCmd.Int64("lockblocks", 0, "Number of blocks the payments stay locked after confirmation")
+	txAsset := txCmd.String("asset", "", "Asset ID to send, BestiCoins if empty")
+	issueFrom := issueCmd.String("from", "", "Issuer wallet address of the asset")
+	issueTo := issueCmd.String("to", "", "Destination wallet addresses, separated by commas")
+	issueAmount := issueCmd.String("amount", "", "Amounts to issue, one for each destination")
+	issueAsset := issueCmd.String("asset", "", "Asset ID to issue")
+	issueFee := issueCmd.Int("fee", 0, "Fee paid to the block proposer")
+	multiSigM := multiSigCmd.Int("m", 0, "Number of signatures required")
+	multiSigAddrs := multiSigCmd.String("addrs", "", "Wallet addresses of the co-signers, separated by commas")
+	multiSigTXM := multiSigTXCmd.Int("m", 0, "Number of signatures required")
+	multiSigTXAddrs := multiSigTXCmd.String("addrs", "", "Wallet addresses of the co-signers, separated by commas")
+	multiSigTXTo := multiSigTXCmd.String("to", "", "Destination wallet addresses, separated by commas")
+	multiSigTXAmount := multiSigTXCmd.String("amount", "", "Amounts to send, one for each destination")
+	multiSigTXFee := multiSigTXCmd.Int("fee", 0, "Fee paid to the block proposer")
+	multiSigTXChange := multiSigTXCmd.String("change", "", "Change address, the multisig address if empty")
+	multiSigTXOut := multiSigTXCmd.String("out", "", "Output file of the unsigned transaction")
+	coSignIn := coSignCmd.String("in", "", "File of the transaction to sign")
+	coSignOut := coSignCmd.String("out", "", "Output file of the signed transaction, the input file if empty")
+	sendTXIn := sendTXCmd.String("in", "", "File of the signed transaction")
+	htlcCreateFrom := htlcCreateCmd.String("from", "", "Source wallet address, refunded after the timeout")
+	htlcCreateTo := htlcCreateCmd.String("to", "", "Receiver wallet address, claims with the preimage")
+	htlcCreateAmount := htlcCreateCmd.Int("amount", 0, "Amount to lock")
+	htlcCreateFee := htlcCreateCmd.Int("fee", 0, "Fee paid to the block proposer")
+	htlcCreateTimeout := htlcCreateCmd.Int64("timeout", 0, "Block height from which the sender can refund")
+	htlcCreateHash := htlcCreateCmd.String("hashlock", "", "SHA-256 hash of the secret (hex); a random secret is generated if empty")
+	htlcClaimHash := htlcClaimCmd.String("hashlock", "", "SHA-256 hash lock of the contract (hex)")
+	htlcClaimReceiver := htlcClaimCmd.String("receiver", "", "Receiver wallet address of the contract")
+	htlcClaimSender := htlcClaimCmd.String("sender", "", "Sender wallet address of the contract")
+	htlcClaimTimeout := htlcClaimCmd.Int64("timeout", 0, "Timeout height of the contract")
+	htlcClaimPreimage := htlcClaimCmd.String("preimage", "", "Secret whose SHA-256 hash is the hash lock (hex)")
+	htlcClaimFee := htlcClaimCmd.Int("fee", 0, "Fee paid to the block proposer")
+	htlcRefundHash := htlcRefundCmd.String("hashlock", "", "SHA-256 hash lock of the contract (hex)")
+	htlcRefundReceiver := htlcRefundCmd.String("receiver", "", "Receiver wallet address of the contract")
+	htlcRefundSender := htlcRefundCmd.String("sender", "", "Sender wallet address of the contract")
+	htlcRefundTimeout := htlcRefundCmd.Int64("timeout", 0, "Timeout height of the contract")
+	htlcRefundFee := htlcRefundCmd.Int("fee", 0, "Fee paid to the block proposer")
+	scriptTemplate := scriptCmd.String("template", "", "Script template: p2a, htlc or timelock")
+	scriptAddr := scriptCmd.String("addr", "", "Wallet address that signs to spend (p2a, timelock)")
+	scriptHash := scriptCmd.String("hashlock", "", "SHA-256 hash of the secret in hex (htlc)")
+	scriptReceiver := scriptCmd.String("receiver", "", "Receiver wallet address, claims with the preimage (htlc)")
+	scriptSender := scriptCmd.String("sender", "", "Sender wallet address, refunded after the timeout (htlc)")
+	scriptTimeout := scriptCmd.Int64("timeout", 0, "Block height from which the sender can refund (htlc)")
+	scriptLockTime := scriptCmd.Int64("locktime", 0, "Block height (or unix time if >= 500000000) from which the address can spend (timelock)")
+	scriptPayFrom := scriptPayCmd.String("from", "", "Source wallet address")
+	scriptPayScript := scriptPayCmd.String("script", "", "Locking script (hex)")
+	scriptPayAmount := scriptPayCmd.Int("amount", 0, "Amount to lock")
+	scriptPayFee := scriptPayCmd.Int("fee", 0, "Fee paid to the block proposer")
+	scriptSpendScript := scriptSpendCmd.String("script", "", "Locking script of the outputs (hex)")
+	scriptSpendTo := scriptSpendCmd.String("to", "", "Destination wallet address")
+	scriptSpendFee := scriptSpendCmd.Int("fee", 0, "Fee paid to the block proposer")
+	scriptSpendUnlock := scriptSpendCmd.String("unlock", "sig", "Unlocking script: sig (p2a, timelock), claim or refund (htlc)")
+	scriptSpendPreimage := scriptSpendCmd.String("preimage", "", "Secret whose SHA-256 hash is the hash lock (hex, claim)")
+	scriptSpendLockTime := scriptSpendCmd.Int64("locktime", 0, "Lock time of the transaction required by the script (timelock, refund)")
+	verifyTXID := verifyTXCmd.String("txid", "", "ID of the transaction to verify")
+	genesisSpec := genesisCmd.String("spec", qblock.GENESIS_SPEC_PATH, "Genesis spec file")
+	genesisOut := genesisCmd.String("out", qblock.GENESIS_BLOCK_PATH, "Output file of the genesis block")
+	exportChainOut := exportChainCmd.String("out", "", "Output file of the blocks")
+	exportChainFrom := exportChainCmd.Int64("from", 0, "Height of the first block to export")
+	importChainIn := importChainCmd.String("in", "", "File of the blocks to import")
+	exportSnapshotOut := exportSnapshotCmd.String("out", "", "Output file of the UTXO snapshot")
+	importSnapshotIn := importSnapshotCmd.String("in", "", "File of the UTXO snapshot to import")
+	importSnapshotHash := importSnapshotCmd.String("statehash", "", "Trusted state hash of the snapshot (hex)")
+	pruneChainDepth := pruneChainCmd.Int64("depth", 0, "Number of newest blocks to keep in full")
+	startNodePrune := startNodeCmd.Int64("prune", 0, "Number of newest blocks to keep in full, 0 keeps all blocks")
 
 	switch os.Args[1] {
 	// 3.利用FlagSet解析命令行参数，解析是从os.Args[2]开始
@@ -63,11 +210,121 @@ func (command *COMM) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "history": // 查询收支记录
+		err := historyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "transaction": // 发起交易
 		err := txCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "issue": // 发行资产
+		err := issueCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "multisig": // 多重签名地址
+		err := multiSigCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "multisigtx": // 构造多重签名交易
+		err := multiSigTXCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "cosign": // 共同签名
+		err := coSignCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "sendtx": // 提交已签名的交易
+		err := sendTXCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "htlccreate": // 创建哈希时间锁合约
+		err := htlcCreateCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "htlcclaim": // 领取合约
+		err := htlcClaimCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "htlcrefund": // 合约退款
+		err := htlcRefundCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "script": // 标准锁定脚本
+		err := scriptCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "scriptpay": // 付款到锁定脚本
+		err := scriptPayCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "scriptspend": // 以解锁脚本花费
+		err := scriptSpendCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifytx": // 校验交易包含证明
+		err := verifyTXCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "genesis": // 生成创世区块
+		err := genesisCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reindex": // 修复UTXO集合
+		err := reindexCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "checkutxo": // UTXO一致性检查
+		err := checkUTXOCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifychain": // 审计账本
+		err := verifyChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "exportchain": // 导出区块
+		err := exportChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importchain": // 导入区块
+		err := importChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "exportsnapshot": // 导出UTXO快照
+		err := exportSnapshotCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importsnapshot": // 由UTXO快照创建账本
+		err := importSnapshotCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "prunechain": // 修剪账本
+		err := pruneChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "startnode":
 		err := startNodeCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -84,17 +341,239 @@ func (command *COMM) Run() {
 			getBalanceCmd.Usage()
 			os.Exit(1)
 		}
-		command.getBalance(*getBalanceAddress, nodeName)
+		command.getBalance(*getBalanceAddress, *getBalanceAsset, nodeName)
+	}
+	if historyCmd.Parsed() {
+		if *historyAddress == "" || *historyOffset < 0 || *historyLimit <= 0 {
+			historyCmd.Usage()
+			os.Exit(1)
+		}
+		command.history(*historyAddress, nodeName, *historyOffset, *historyLimit)
 	}
 	if txCmd.Parsed() {
-		if *txFrom == "" || *txTo == "" || *txAmount <= 0 {
+		req, err := newTXRequest(*txFrom, *txTo, *txAmount, *txFee, *txChange, *txStrategy, *txInputs)
+		req.Lock_time, req.Lock_blocks = *txLockTime, *txLockBlocks
+		req.Asset = *txAsset
+		if err != nil {
+			fmt.Println("ERROR:", err)
 			txCmd.Usage()
 			os.Exit(1)
 		}
-		command.transaction(*txFrom, *txTo, nodeName, *txAmount)
+		command.transaction(req, nodeName)
+	}
+	if issueCmd.Parsed() {
+		req, err := newTXRequest(*issueFrom, *issueTo, *issueAmount, *issueFee, "", "", "")
+		req.Asset, req.Issue = *issueAsset, true
+		if err == nil && *issueAsset == "" {
+			err = errors.New("asset is required")
+		}
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			issueCmd.Usage()
+			os.Exit(1)
+		}
+		command.transaction(req, nodeName)
+	}
+	if multiSigCmd.Parsed() {
+		script, err := newMultiSigScript(*multiSigM, *multiSigAddrs)
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			multiSigCmd.Usage()
+			os.Exit(1)
+		}
+		command.multiSigAddress(script)
+	}
+	if multiSigTXCmd.Parsed() {
+		script, err := newMultiSigScript(*multiSigTXM, *multiSigTXAddrs)
+		var req qbutxo.TXRequest
+		if err == nil {
+			req, err = newTXRequest(qbwallet.ScriptAddress(script), *multiSigTXTo, *multiSigTXAmount, *multiSigTXFee, *multiSigTXChange, "", "")
+			req.Lock_script = script
+		}
+		if err == nil && *multiSigTXOut == "" {
+			err = errors.New("output file is required")
+		}
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			multiSigTXCmd.Usage()
+			os.Exit(1)
+		}
+		command.multiSigTransaction(req, *multiSigTXM, nodeName, *multiSigTXOut)
+	}
+	if coSignCmd.Parsed() {
+		if *coSignIn == "" {
+			coSignCmd.Usage()
+			os.Exit(1)
+		}
+		if *coSignOut == "" {
+			*coSignOut = *coSignIn
+		}
+		command.coSign(nodeName, *coSignIn, *coSignOut)
+	}
+	if sendTXCmd.Parsed() {
+		if *sendTXIn == "" {
+			sendTXCmd.Usage()
+			os.Exit(1)
+		}
+		command.sendTransaction(nodeName, *sendTXIn)
+	}
+	if htlcCreateCmd.Parsed() {
+		var secret string
+		if *htlcCreateHash == "" {
+			secret, *htlcCreateHash = newSecret()
+		}
+		h, err := newHTLC(*htlcCreateHash, *htlcCreateTo, *htlcCreateFrom, *htlcCreateTimeout)
+		var script qbtx.Script
+		if err == nil {
+			script, err = qbtx.HTLCScript(h)
+		}
+		var req qbutxo.TXRequest
+		if err == nil {
+			req, err = newTXRequest(*htlcCreateFrom, qbwallet.ScriptAddress(script), strconv.Itoa(*htlcCreateAmount), *htlcCreateFee, "", "", "")
+			req.Pay_script = script
+		}
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			htlcCreateCmd.Usage()
+			os.Exit(1)
+		}
+		if secret != "" {
+			fmt.Println("Secret (keep it until you claim the counterpart):", secret)
+		}
+		command.htlcCreate(req, h, nodeName)
+	}
+	if htlcClaimCmd.Parsed() {
+		h, err := newHTLC(*htlcClaimHash, *htlcClaimReceiver, *htlcClaimSender, *htlcClaimTimeout)
+		var preimage []byte
+		if err == nil {
+			preimage, err = hex.DecodeString(*htlcClaimPreimage)
+		}
+		if err == nil && len(preimage) == 0 {
+			err = errors.New("preimage is required")
+		}
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			htlcClaimCmd.Usage()
+			os.Exit(1)
+		}
+		command.htlcSpend(h, preimage, *htlcClaimFee, nodeName)
+	}
+	if htlcRefundCmd.Parsed() {
+		h, err := newHTLC(*htlcRefundHash, *htlcRefundReceiver, *htlcRefundSender, *htlcRefundTimeout)
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			htlcRefundCmd.Usage()
+			os.Exit(1)
+		}
+		command.htlcSpend(h, nil, *htlcRefundFee, nodeName)
+	}
+	if scriptCmd.Parsed() {
+		script, err := newScript(scriptParams{
+			template: *scriptTemplate, addr: *scriptAddr,
+			hash_lock: *scriptHash, receiver: *scriptReceiver, sender: *scriptSender, timeout: *scriptTimeout, lock_time: *scriptLockTime,
+		})
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			scriptCmd.Usage()
+			os.Exit(1)
+		}
+		printScript(script)
+	}
+	if scriptPayCmd.Parsed() {
+		script, err := parseScript(*scriptPayScript)
+		var req qbutxo.TXRequest
+		if err == nil {
+			req, err = newTXRequest(*scriptPayFrom, qbwallet.ScriptAddress(script), strconv.Itoa(*scriptPayAmount), *scriptPayFee, "", "", "")
+			req.Pay_script = script
+		}
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			scriptPayCmd.Usage()
+			os.Exit(1)
+		}
+		printScript(script)
+		command.transaction(req, nodeName)
+	}
+	if scriptSpendCmd.Parsed() {
+		script, err := parseScript(*scriptSpendScript)
+		var preimage []byte
+		if err == nil {
+			preimage, err = hex.DecodeString(*scriptSpendPreimage)
+		}
+		var unlock qbutxo.Unlocker
+		if err == nil {
+			unlock, err = newUnlocker(*scriptSpendUnlock, preimage, nodeName)
+		}
+		if err == nil && !qbwallet.ValidateAddress(*scriptSpendTo) {
+			err = fmt.Errorf("address %q is not valid", *scriptSpendTo)
+		}
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			scriptSpendCmd.Usage()
+			os.Exit(1)
+		}
+		command.scriptSpend(script, unlock, *scriptSpendTo, *scriptSpendFee, *scriptSpendLockTime, nodeName)
+	}
+	if verifyTXCmd.Parsed() {
+		if *verifyTXID == "" {
+			verifyTXCmd.Usage()
+			os.Exit(1)
+		}
+		command.verifyTransaction(*verifyTXID, nodeName)
+	}
+	if genesisCmd.Parsed() {
+		command.genesis(*genesisSpec, *genesisOut)
+	}
+	if reindexCmd.Parsed() {
+		command.reindex(nodeName)
+	}
+	if checkUTXOCmd.Parsed() {
+		command.checkUTXO(nodeName)
+	}
+	if verifyChainCmd.Parsed() {
+		command.verifyChain(nodeName)
+	}
+	if exportChainCmd.Parsed() {
+		if *exportChainOut == "" || *exportChainFrom < 0 {
+			exportChainCmd.Usage()
+			os.Exit(1)
+		}
+		command.exportChain(nodeName, *exportChainOut, *exportChainFrom)
+	}
+	if importChainCmd.Parsed() {
+		if *importChainIn == "" {
+			importChainCmd.Usage()
+			os.Exit(1)
+		}
+		command.importChain(nodeName, *importChainIn)
+	}
+	if exportSnapshotCmd.Parsed() {
+		if *exportSnapshotOut == "" {
+			exportSnapshotCmd.Usage()
+			os.Exit(1)
+		}
+		command.exportSnapshot(nodeName, *exportSnapshotOut)
+	}
+	if importSnapshotCmd.Parsed() {
+		if *importSnapshotIn == "" || *importSnapshotHash == "" {
+			importSnapshotCmd.Usage()
+			os.Exit(1)
+		}
+		command.importSnapshot(nodeName, *importSnapshotIn, *importSnapshotHash)
+	}
+	if pruneChainCmd.Parsed() {
+		if *pruneChainDepth < quantumbc.MIN_PRUNE_DEPTH {
+			pruneChainCmd.Usage()
+			os.Exit(1)
+		}
+		command.pruneChain(nodeName, *pruneChainDepth)
 	}
 	if startNodeCmd.Parsed() {
-		command.startNode(nodeName)
+		if *startNodePrune != 0 && *startNodePrune < quantumbc.MIN_PRUNE_DEPTH {
+			startNodeCmd.Usage()
+			os.Exit(1)
+		}
+		command.startNode(nodeName, *startNodePrune)
 	}
 
 }
@@ -0,0 +1,49 @@
+package qbcommand
+
+import (
+	"fmt"
+	"log"
+	"qb/qbvalidate"
+	"qb/qbwallet"
+	"qblock"
+)
+
+// genesis，由创世配置生成确定的创世区块并写入文件，分发给各联盟节点
+func (command *COMM) genesis(specPath, outPath string) {
+	spec, err := qblock.LoadGenesisSpec(specPath)
+	if err != nil {
+		log.Panic(err)
+	}
+	for addr := range spec.Allocations {
+		if !qbwallet.ValidateAddress(addr) {
+			log.Panicf("ERROR: allocation address %s is not valid", addr)
+		}
+	}
+	for asset, issuer := range spec.Asset_issuers {
+		if !qbwallet.ValidateAddress(issuer) {
+			log.Panicf("ERROR: issuer address %s of asset %s is not valid", issuer, asset)
+		}
+	}
+	block := qblock.NewGenesisBlock(spec)
+	err = qblock.WriteGenesisBlock(block, outPath)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Genesis block of chain %s written to %s\n", spec.Chain_id, outPath)
+	fmt.Printf("Hash: %x\n", block.Hash)
+}
+
+// loadGenesis，读取分发的创世区块与其记录的联盟参数，并以其中的资产发行方设置发行交易的校验
+// 返回值：创世区块，联盟参数
+func loadGenesis() (*qblock.Block, *qblock.GenesisParams) {
+	genesis, err := qblock.LoadGenesisBlock(qblock.GENESIS_BLOCK_PATH)
+	if err != nil {
+		log.Panic(err)
+	}
+	params, err := genesis.GenesisParams()
+	if err != nil {
+		log.Panic(err)
+	}
+	qbvalidate.SetAssetIssuers(params.Asset_issuers)
+	return genesis, params
+}
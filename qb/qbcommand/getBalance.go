@@ -4,30 +4,35 @@ import (
 	"fmt"
 	"log"
 	"qb/qbnode"
-	"qb/qbutxo"
 	"qb/qbwallet"
-	"qb/quantumbc"
+	"sort"
 	"utils"
 )
 
-func (command *COMM) getBalance(address, nodeID string) {
+// getBalance，打印地址某一资产的余额，asset为空时打印原生币与各资产的余额
+func (command *COMM) getBalance(address, asset, nodeID string) {
 	file, _ := utils.Init_log(qbnode.NODE_LOG_PATH + nodeID + ".log")
 	log.SetPrefix("[resolve tx error]")
 	defer file.Close()
 	if !qbwallet.ValidateAddress(address) {
 		log.Panic("ERROR: Address is not valid")
 	}
-	bc := quantumbc.NewBlockchain("P1") // 获取当前全账本
-	UTXOSet := qbutxo.UTXOSet{
-		Blockchain: bc,
+	node := qbnode.NewNode(nodeID)
+	balance, assets, err := node.QueryBalances(address) // 由主节点通过地址索引查询余额
+	if err != nil {
+		log.Panic(err)
 	}
-	defer bc.DB.Close()
-
-	balance := 0 // 定义余额
-	UTXOs := UTXOSet.FindUTXO(address)
-
-	for _, out := range UTXOs {
-		balance += out.TX_value
+	if asset != "" {
+		fmt.Printf("Balance of '%s': %d %s\n", address, assets[asset], asset)
+		return
 	}
 	fmt.Printf("Balance of '%s': %d\n", address, balance)
+	ids := make([]string, 0, len(assets))
+	for id := range assets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Printf("  %s: %d\n", id, assets[id])
+	}
 }
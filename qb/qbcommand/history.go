@@ -0,0 +1,37 @@
+package qbcommand
+
+import (
+	"fmt"
+	"log"
+	"qb/qbnode"
+	"qb/qbwallet"
+	"strconv"
+	"utils"
+)
+
+// history，分页打印地址的收支记录，由新到旧排列
+func (command *COMM) history(address, nodeID string, offset, limit int) {
+	file, _ := utils.Init_log(qbnode.NODE_LOG_PATH + nodeID + ".log")
+	log.SetPrefix("[history error]")
+	defer file.Close()
+	if !qbwallet.ValidateAddress(address) {
+		log.Panic("ERROR: Address is not valid")
+	}
+	node := qbnode.NewNode(nodeID)
+	events, total, err := node.QueryHistory(address, offset, limit) // 由主节点查询
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("History of '%s': %d-%d of %d\n", address, offset+1, offset+len(events), total)
+	for _, e := range events {
+		value := strconv.Itoa(e.Value)
+		if e.Asset != "" {
+			value += " " + e.Asset
+		}
+		if e.Spent {
+			fmt.Printf("  block %d  tx %x  sent     %s  (output %x:%d)\n", e.Height, e.TX_id, value, e.Out_tx_id, e.Out_index)
+		} else {
+			fmt.Printf("  block %d  tx %x  received %s  (output %d)\n", e.Height, e.TX_id, value, e.Out_index)
+		}
+	}
+}
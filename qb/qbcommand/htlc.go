@@ -0,0 +1,65 @@
+package qbcommand
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"qb/qbutxo"
+	"qb/qbwallet"
+	"qbtx"
+	"qrng"
+)
+
+// newHTLC，由命令行参数构造哈希时间锁合约，哈希锁以十六进制表示
+func newHTLC(hashLock, receiver, sender string, timeout int64) (*qbtx.HTLC, error) {
+	if !qbwallet.ValidateAddress(receiver) || !qbwallet.ValidateAddress(sender) {
+		return nil, errors.New("receiver and sender must be valid addresses")
+	}
+	lock, err := hex.DecodeString(hashLock)
+	if err != nil {
+		return nil, fmt.Errorf("hash lock %q is not hex", hashLock)
+	}
+	return qbtx.NewHTLC(lock, receiver, sender, timeout)
+}
+
+// newSecret，从默认熵源生成32字节原像
+// 返回值：原像与其SHA-256摘要的十六进制string
+func newSecret() (string, string) {
+	preimage := make([]byte, 32)
+	if _, err := qrng.Read(preimage); err != nil {
+		log.Panic(err)
+	}
+	digest := sha256.Sum256(preimage)
+	return hex.EncodeToString(preimage), hex.EncodeToString(digest[:])
+}
+
+// printHTLC，打印合约的锁定脚本、脚本地址与领取、退款时需要的合约参数
+func printHTLC(h *qbtx.HTLC, script qbtx.Script) {
+	printScript(script)
+	fmt.Printf("  -hashlock %x -receiver %s -sender %s -timeout %d\n", h.Hash_lock, h.Receiver, h.Sender, h.Timeout)
+}
+
+// htlcCreate，以合约的锁定脚本付款到其脚本地址以创建合约，发送方为合约的退款方
+func (command *COMM) htlcCreate(req qbutxo.TXRequest, h *qbtx.HTLC, nodeID string) {
+	printHTLC(h, req.Pay_script)
+	command.transaction(req, nodeID)
+}
+
+// htlcSpend，花费合约脚本地址上的全部输出：出示原像时由接收方领取，否则由发送方在超时后退款，交易锁定至超时高度；扣除手续费后全部付给领取方
+func (command *COMM) htlcSpend(h *qbtx.HTLC, preimage []byte, fee int, nodeID string) {
+	script, err := qbtx.HTLCScript(h)
+	if err != nil {
+		log.Panic(err)
+	}
+	to, unlock, lock_time := h.Sender, "refund", h.Timeout
+	if len(preimage) > 0 {
+		to, unlock, lock_time = h.Receiver, "claim", 0
+	}
+	unlocker, err := newUnlocker(unlock, preimage, nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	command.scriptSpend(script, unlocker, to, fee, lock_time, nodeID)
+}
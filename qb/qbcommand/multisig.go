@@ -0,0 +1,119 @@
+package qbcommand
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"qb/qbnode"
+	"qb/qbutxo"
+	"qb/qbwallet"
+	"qbtx"
+	"strings"
+	"utils"
+)
+
+// newMultiSigScript，由命令行参数构造多重签名锁定脚本，地址以逗号分隔
+func newMultiSigScript(m int, addrs string) (qbtx.Script, error) {
+	if addrs == "" {
+		return nil, errors.New("multisig addresses are required")
+	}
+	list := strings.Split(addrs, ",")
+	for _, addr := range list {
+		if !qbwallet.ValidateAddress(addr) {
+			return nil, fmt.Errorf("address %q is not valid", addr)
+		}
+	}
+	return qbtx.MultiSigScript(m, list)
+}
+
+// multiSigAddress，打印多重签名锁定脚本与其导出的地址，以scriptpay付款到该脚本即创建多重签名输出
+func (command *COMM) multiSigAddress(script qbtx.Script) {
+	printScript(script)
+}
+
+// multiSigTransaction，构造从多重签名脚本地址转出的交易并写入文件。各输入项的解锁脚本尚无签名，由共同签名者依次cosign后提交
+// 参数：交易请求（Lock_script为多重签名脚本），所需签名数，节点名称，输出文件
+func (command *COMM) multiSigTransaction(req qbutxo.TXRequest, m int, nodeID, out string) {
+	node := qbnode.NewNode(nodeID)
+	file, _ := utils.Init_log(qbnode.NODE_LOG_PATH + node.Node_name + ".log")
+	log.SetPrefix("[multisig tx error]")
+	defer file.Close()
+
+	outs, err := node.QuerySpendable(req.From)
+	if err != nil {
+		log.Panic(err)
+	}
+	req.Unlock = func(*qbtx.Transaction, int) (qbtx.Script, error) {
+		return qbtx.UnlockMultiSig(nil), nil
+	}
+	transaction, err := qbutxo.BuildTransaction(req, node.Node_name, outs)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	writeTransaction(transaction, out)
+	transaction.PrintTransaction()
+	fmt.Printf("Unsigned multisig transaction written to %s, %d co-signatures required\n", out, m)
+}
+
+// coSign，当前节点对文件中交易的每个多重签名输入项共同签名，签名追加到解锁脚本，并写回文件
+func (command *COMM) coSign(nodeID, in, out string) {
+	transaction := readTransaction(in)
+	signed := 0
+	for in_id := range transaction.TX_vin {
+		err := transaction.CoSign(in_id, nodeID)
+		if errors.Is(err, qbtx.ErrNotMultiSigInput) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Input %d: %v\n", in_id, err)
+			continue
+		}
+		signed++
+		fmt.Printf("Input %d: co-signed by %s\n", in_id, nodeID)
+	}
+	if signed == 0 {
+		fmt.Println("ERROR: no multisig input was signed by", nodeID)
+		os.Exit(1)
+	}
+	writeTransaction(transaction, out)
+	fmt.Printf("Transaction %s written to %s\n", hex.EncodeToString(transaction.TX_id), out)
+}
+
+// sendTransaction，提交文件中已签名的交易，与transaction命令相同地广播并等待回复
+func (command *COMM) sendTransaction(nodeID, in string) {
+	transaction := readTransaction(in)
+	node := qbnode.NewNode(nodeID)
+	file, _ := utils.Init_log(qbnode.NODE_LOG_PATH + node.Node_name + ".log")
+	log.SetPrefix("[send tx error]")
+	defer file.Close()
+	submit(node, transaction)
+}
+
+// readTransaction，从文件读取json编码的交易
+func readTransaction(path string) *qbtx.Transaction {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Panic(err)
+	}
+	var transaction qbtx.Transaction
+	if err = json.Unmarshal(data, &transaction); err != nil {
+		log.Panic(err)
+	}
+	return &transaction
+}
+
+// writeTransaction，将交易以json编码写入文件
+func writeTransaction(transaction *qbtx.Transaction, path string) {
+	data, err := json.MarshalIndent(transaction, "", "  ")
+	if err != nil {
+		log.Panic(err)
+	}
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		log.Panic(err)
+	}
+}
@@ -0,0 +1,123 @@
+package qbcommand
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"qb/qbnode"
+	"qb/qbutxo"
+	"qb/qbwallet"
+	"qbtx"
+	"utils"
+)
+
+// scriptParams，由命令行给出的标准脚本模板参数。多重签名脚本须收集多个签名，由程序组装解锁脚本，命令行的多重签名使用multisig等命令
+type scriptParams struct {
+	template  string // 模板：p2a、htlc或timelock
+	addr      string // p2a与timelock的地址
+	hash_lock string // htlc的哈希锁（十六进制）
+	receiver  string // htlc的接收方
+	sender    string // htlc的发送方
+	timeout   int64  // htlc的超时高度
+	lock_time int64  // timelock的锁定高度或时间戳
+}
+
+// newScript，按模板构造锁定脚本
+func newScript(p scriptParams) (qbtx.Script, error) {
+	switch p.template {
+	case "p2a", "timelock":
+		if !qbwallet.ValidateAddress(p.addr) {
+			return nil, fmt.Errorf("address %q is not valid", p.addr)
+		}
+		if p.template == "p2a" {
+			return qbtx.PayToAddressScript(p.addr), nil
+		}
+		if p.lock_time <= 0 {
+			return nil, errors.New("lock time must be positive")
+		}
+		return qbtx.TimeLockScript(p.lock_time, p.addr), nil
+	case "htlc":
+		h, err := newHTLC(p.hash_lock, p.receiver, p.sender, p.timeout)
+		if err != nil {
+			return nil, err
+		}
+		return qbtx.HTLCScript(h)
+	}
+	return nil, fmt.Errorf("unknown script template %q", p.template)
+}
+
+// parseScript，解析十六进制的锁定脚本
+func parseScript(script string) (qbtx.Script, error) {
+	data, err := hex.DecodeString(script)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("script %q is not hex", script)
+	}
+	if err = qbtx.Script(data).Validate(); err != nil {
+		return nil, err
+	}
+	return qbtx.Script(data), nil
+}
+
+// printScript，打印脚本的反汇编、十六进制编码与导出的脚本地址
+func printScript(script qbtx.Script) {
+	fmt.Printf("Script: %s\n", script.String())
+	fmt.Printf("  -script %s\n", hex.EncodeToString(script))
+	fmt.Printf("Script address: %s\n", qbwallet.ScriptAddress(script))
+}
+
+// newUnlocker，当前节点以签名及原像生成解锁脚本：sig用于p2a与timelock，claim、refund用于htlc
+func newUnlocker(unlock string, preimage []byte, nodeID string) (qbutxo.Unlocker, error) {
+	if unlock == "claim" && len(preimage) == 0 {
+		return nil, errors.New("preimage is required to claim")
+	}
+	if unlock != "sig" && unlock != "claim" && unlock != "refund" {
+		return nil, fmt.Errorf("unknown unlock %q", unlock)
+	}
+	return func(tx *qbtx.Transaction, in_id int) (qbtx.Script, error) {
+		sig := tx.ScriptSign(in_id, nodeID)
+		switch unlock {
+		case "claim":
+			return qbtx.UnlockHTLCClaim(sig, preimage), nil
+		case "refund":
+			return qbtx.UnlockHTLCRefund(sig), nil
+		}
+		return qbtx.UnlockSign(sig), nil
+	}, nil
+}
+
+// scriptSpend，花费脚本地址上的全部输出，扣除手续费后全部付给to；交易锁定时间由脚本要求给出
+func (command *COMM) scriptSpend(script qbtx.Script, unlock qbutxo.Unlocker, to string, fee int, lock_time int64, nodeID string) {
+	node := qbnode.NewNode(nodeID)
+	file, _ := utils.Init_log(qbnode.NODE_LOG_PATH + node.Node_name + ".log")
+	log.SetPrefix("[script error]")
+	defer file.Close()
+
+	address := qbwallet.ScriptAddress(script)
+	outs, err := node.QuerySpendable(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	outs = outs.OfAsset("") // 只花费原生币输出
+	req := qbutxo.TXRequest{From: address, Fee: fee, Lock_time: lock_time, Lock_script: script, Unlock: unlock}
+	total := 0
+	for _, out := range outs {
+		total += out.Value
+		req.Inputs = append(req.Inputs, qbutxo.OutPoint{TX_id: out.TX_id, Index: out.Index})
+	}
+	req.Payments = []qbutxo.Payment{{To: to, Amount: total - fee}}
+	transaction, err := qbutxo.BuildTransaction(req, node.Node_name, outs)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	submit(node, transaction)
+}
+
+// submit，打印并广播交易，等待回复
+func submit(node *qbnode.Node, transaction *qbtx.Transaction) {
+	transaction.PrintTransaction()
+	node.MsgBroadcast <- transaction
+	node.Httplisten() // 开启http
+}
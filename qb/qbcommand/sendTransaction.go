@@ -2,32 +2,80 @@ package qbcommand
 
 import (
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
+	"os"
 	"qb/qbnode"
 	"qb/qbutxo"
 	"qb/qbwallet"
-	"qb/quantumbc"
+	"strconv"
+	"strings"
 	"utils"
 )
 
-func (command *COMM) transaction(tx_from, tx_to, nodeID string, tx_amount int) {
+// newTXRequest，由命令行参数构造交易请求：收款地址与金额以逗号分隔且一一对应，输入以TXID:INDEX表示
+func newTXRequest(from, to, amounts string, fee int, change, strategy, inputs string) (qbutxo.TXRequest, error) {
+	req := qbutxo.TXRequest{From: from, Fee: fee, Change: change}
+	if from == "" || to == "" || amounts == "" {
+		return req, errors.New("source, destination and amount are required")
+	}
+	tos, values := strings.Split(to, ","), strings.Split(amounts, ",")
+	if len(tos) != len(values) {
+		return req, fmt.Errorf("%d destinations but %d amounts", len(tos), len(values))
+	}
+	for i := range tos {
+		amount, err := strconv.Atoi(values[i])
+		if err != nil {
+			return req, fmt.Errorf("amount %q is not valid", values[i])
+		}
+		req.Payments = append(req.Payments, qbutxo.Payment{To: tos[i], Amount: amount})
+	}
+	if inputs != "" {
+		for _, input := range strings.Split(inputs, ",") {
+			parts := strings.Split(input, ":")
+			if len(parts) != 2 {
+				return req, fmt.Errorf("input %q is not TXID:INDEX", input)
+			}
+			txid, err1 := hex.DecodeString(parts[0])
+			index, err2 := strconv.Atoi(parts[1])
+			if err1 != nil || err2 != nil || len(txid) == 0 || index < 0 {
+				return req, fmt.Errorf("input %q is not TXID:INDEX", input)
+			}
+			req.Inputs = append(req.Inputs, qbutxo.OutPoint{TX_id: txid, Index: index})
+		}
+	}
+	var err error
+	req.Selector, err = qbutxo.SelectorByName(strategy)
+	return req, err
+}
+
+func (command *COMM) transaction(req qbutxo.TXRequest, nodeID string) {
 	node := qbnode.NewNode(nodeID) // 开启节点
 	file, _ := utils.Init_log(qbnode.NODE_LOG_PATH + node.Node_name + ".log")
 	log.SetPrefix("[resolve tx error]")
 	defer file.Close()
-	if !qbwallet.ValidateAddress(tx_from) { // 检验交易发送地址
+	if !qbwallet.ValidateAddress(req.From) { // 检验交易发送地址
 		log.Panic("ERROR: Sender address is not valid")
 	}
-	if !qbwallet.ValidateAddress(tx_to) { // 检验交易目的地址
-		log.Panic("ERROR: Recipient address is not valid")
+	for _, payment := range req.Payments { // 检验交易目的地址
+		if !qbwallet.ValidateAddress(payment.To) {
+			log.Panic("ERROR: Recipient address is not valid")
+		}
+	}
+	if req.Change != "" && !qbwallet.ValidateAddress(req.Change) { // 检验找零地址
+		log.Panic("ERROR: Change address is not valid")
 	}
 
-	bc := quantumbc.NewBlockchain(node.Primary) // 获取账本
-	UTXOSet := qbutxo.UTXOSet{                  // 设置utxo
-		Blockchain: bc,
+	outs, err := node.QuerySpendable(req.From) // 通过主节点查询发送方可花费的输出，已扣除交易池中未上链交易的花费
+	if err != nil {
+		log.Panic(err)
+	}
+	transaction, err := qbutxo.BuildTransaction(req, node.Node_name, outs)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
 	}
-	transaction := qbutxo.NewUTXOTransaction(tx_from, tx_to, node.Node_name, tx_amount, &UTXOSet)
-	bc.DB.Close() // 关闭数据库
 	transaction.PrintTransaction()
 	file, _ = utils.Init_log(utils.SIGN_PATH + nodeID + ".log")
 	log.SetPrefix("[TRANSACTION SIGN]")
@@ -1,40 +1,82 @@
 package qbcommand
 
 import (
-	"fmt"
+	"bytes"
 	"log"
+	"os"
+	"os/signal"
 	"qb/qbnode"
-	"qb/qbutxo"
 	"qb/qbwallet"
 	"qb/quantumbc"
+	"qbtx"
+	"syscall"
 )
 
-func (command *COMM) startNode(nodeID string) {
-	node := qbnode.NewNode(nodeID) // 开启一个联盟节点
-	addresses := make([]string, 0)
+func (command *COMM) startNode(nodeID string, pruneDepth int64) {
+	node := qbnode.NewNode(nodeID)    // 开启一个联盟节点
+	node.Prune_depth = pruneDepth     // 0表示保留全部区块
 	for ID := range node.Node_table { // 钱包地址
 		w := qbwallet.NewWallet(ID)
 		node.Addr_table[string(w.Addr)] = ID
-		addresses = append(addresses, string(w.Addr))
 	}
-	//fmt.Println(addresses)
+	// 读取分发的创世区块，联盟参数须与本节点视图一致
+	genesis, params := loadGenesis()
+	// 启动的节点本身与主节点都须是创世区块中的联盟成员
+	if qbtx.N != 3*uint32(params.F)+1 || !isMember(params.Members, nodeID) || !isMember(params.Members, node.Primary) {
+		log.Panicf("ERROR: view (node %s, primary %s, N=%d) does not match genesis of chain %s (F=%d)",
+			nodeID, node.Primary, qbtx.N, params.Chain_id, params.F)
+	}
 	// 获取区块链数据库名称
-	dbFile := fmt.Sprintf(quantumbc.DBFile, nodeID)
-	// 检查是否已创建数据库，如未创建则现在创建
-	qbc := quantumbc.Blockchain{}
+	dbFile := quantumbc.DBPath(nodeID)
+	// 检查是否已创建数据库，如未创建则现在创建。账本在节点运行期间保持打开，由各线程共享
 	if !quantumbc.DBExists(dbFile) {
 		log.Println("Blockchain didn't exists，have create a new one.")
-		qbc = *quantumbc.CreateBlockchain(addresses, nodeID)
-		// utxo初始化
-		UTXOSet := qbutxo.UTXOSet{
-			Blockchain: &qbc,
-		}
-		UTXOSet.Reindex()
-
-		qbc.DB.Close() // 关闭账本
+		node.Ledger = quantumbc.CreateBlockchain(genesis, nodeID) // 创世区块的UTXO随区块一并写入
 	} else {
 		log.Println("Blockchain already exists.")
+		node.Ledger = quantumbc.NewBlockchain(nodeID)
+		// 本地账本的创世区块必须与分发的创世区块相同，否则拒绝启动
+		genesisHash := node.Ledger.GetGenesisHash()
+		if !bytes.Equal(genesisHash, genesis.Hash) {
+			node.Ledger.DB.Close()
+			log.Panicf("ERROR: local genesis %x differs from genesis %x of chain %s", genesisHash, genesis.Hash, params.Chain_id)
+		}
 	}
+	defer node.Ledger.DB.Close() // 关闭账本
+	log.Printf("Chain %s, genesis %x", params.Chain_id, genesis.Hash)
+	if pruneDepth > 0 {
+		if _, err := node.Ledger.Prune(pruneDepth); err != nil { // 启动时按保留深度修剪一次，之后随新区块修剪
+			log.Panic(err)
+		}
+		log.Printf("Pruned mode: keeping the newest %d blocks, base height %d", pruneDepth, node.Ledger.BaseHeight())
+	}
+	// 恢复上次停止时交易池中的交易，停止节点时再次保存
+	loaded, err := node.LoadMempool()
+	if err != nil {
+		log.Println("Mempool not restored:", err)
+	} else {
+		log.Printf("Restored %d pending transactions", loaded)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		if err := node.SaveMempool(); err != nil {
+			log.Println("Mempool not saved:", err)
+		}
+		node.Ledger.DB.Close()
+		os.Exit(0)
+	}()
 	//quantumbc.PrintBlockChain(nodeID) // 打印当前区块链信息
 	node.Httplisten()
 }
+
+// isMember，判断节点是否为联盟成员
+func isMember(members []string, node_name string) bool {
+	for _, member := range members {
+		if member == node_name {
+			return true
+		}
+	}
+	return false
+}
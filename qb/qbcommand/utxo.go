@@ -0,0 +1,42 @@
+package qbcommand
+
+import (
+	"fmt"
+	"log"
+	"qb/qbnode"
+	"qb/qbutxo"
+	"qb/quantumbc"
+	"utils"
+)
+
+// reindex，修复命令：遍历本节点全链重建UTXO集合与地址索引，须在节点停止时执行
+func (command *COMM) reindex(nodeID string) {
+	file, _ := utils.Init_log(qbnode.NODE_LOG_PATH + nodeID + ".log")
+	log.SetPrefix("[reindex error]")
+	defer file.Close()
+	bc := quantumbc.NewBlockchain(nodeID)
+	defer bc.DB.Close()
+
+	UTXOSet := qbutxo.UTXOSet{
+		Blockchain: bc,
+	}
+	if err := UTXOSet.Reindex(); err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", UTXOSet.CountTransactions())
+}
+
+// checkUTXO，一致性检查：比较本节点增量维护的UTXO集合与全量重建的结果，须在节点停止时执行
+func (command *COMM) checkUTXO(nodeID string) {
+	bc := quantumbc.NewBlockchain(nodeID)
+	defer bc.DB.Close()
+
+	UTXOSet := qbutxo.UTXOSet{
+		Blockchain: bc,
+	}
+	if err := UTXOSet.Check(); err != nil {
+		fmt.Printf("UTXO set of %s is inconsistent: %v\nRun reindex to repair it.\n", nodeID, err)
+		return
+	}
+	fmt.Printf("UTXO set of %s is consistent, %d transactions.\n", nodeID, UTXOSet.CountTransactions())
+}
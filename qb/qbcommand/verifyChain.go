@@ -0,0 +1,37 @@
+package qbcommand
+
+import (
+	"fmt"
+	"os"
+	"qb/qbnode"
+	"qb/quantumbc"
+)
+
+// verifyChain，审计本节点账本，逐条打印发现的问题及所在高度，发现问题时以状态码1退出。须在节点停止时执行
+func (command *COMM) verifyChain(nodeID string) {
+	qbnode.NewNode(nodeID) // 读取视图，确定签名参数
+	bc := quantumbc.NewBlockchain(nodeID)
+	audit := bc.VerifyChain()
+	bc.DB.Close()
+
+	fmt.Printf("Verified %d blocks and %d transactions of %s\n", audit.Blocks, audit.Transactions, nodeID)
+	if !audit.UTXO_checked && audit.Base > 0 {
+		fmt.Printf("UTXO set not checked: blocks below height %d are pruned or not stored\n", audit.Base)
+	}
+	if audit.Certs > 0 {
+		fmt.Printf("Verified the proposer signatures of %d pruned block headers\n", audit.Certs)
+	}
+	if len(audit.Issues) == 0 {
+		fmt.Println("No discrepancies found.")
+		return
+	}
+	for _, issue := range audit.Issues {
+		if issue.Height < 0 {
+			fmt.Printf("  UTXO set: %v\n", issue.Err)
+		} else {
+			fmt.Printf("  block %d: %v\n", issue.Height, issue.Err)
+		}
+	}
+	fmt.Printf("%d discrepancies found.\n", len(audit.Issues))
+	os.Exit(1)
+}
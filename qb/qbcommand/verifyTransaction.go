@@ -0,0 +1,41 @@
+package qbcommand
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"qb/qbnode"
+	"qblock"
+	"utils"
+)
+
+// verifyTransaction，向主节点请求交易包含证明并在本地校验，无需下载区块。
+// 证明中的区块hash须再由主节点以外的F+1个联盟成员确认，联盟成员与F取自分发的创世区块
+func (command *COMM) verifyTransaction(txid, nodeID string) {
+	_, params := loadGenesis()
+	node := qbnode.NewNode(nodeID)
+	file, _ := utils.Init_log(qbnode.NODE_LOG_PATH + nodeID + ".log")
+	log.SetPrefix("[verify tx error]")
+	defer file.Close()
+
+	reply, err := utils.Get(node.Node_table[node.Primary] + "/proof?txid=" + txid)
+	if err != nil { // 交易未上链或主节点无法给出证明，应答中附带原因
+		fmt.Printf("Transaction %s: %v\n", txid, err)
+		return
+	}
+	var proof qblock.TXProof
+	err = json.Unmarshal(reply, &proof)
+	if err != nil {
+		log.Panic(err)
+	}
+	if !proof.Verify() {
+		fmt.Printf("Transaction %s: proof is invalid\n", txid)
+		return
+	}
+	if err = node.ConfirmBlockHash(params.Members, proof.Height, proof.Block_hash, int(params.F)+1); err != nil {
+		fmt.Printf("Transaction %s: %v\n", txid, err)
+		return
+	}
+	fmt.Printf("Transaction %s is included in block %d (%x) at position %d, confirmed by %d replicas\n", txid, proof.Height, proof.Block_hash, proof.Index, params.F+1)
+	proof.TX.PrintTransaction()
+}
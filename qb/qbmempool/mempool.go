@@ -0,0 +1,411 @@
+// qbmempool包，交易池：缓存已通过校验、等待打包的交易
+// 负责按交易ID去重、检测冲突花费、限制容量、淘汰过期交易，并在交易上链后将其移除
+package qbmempool
+
+import (
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"qb/qbvalidate"
+	"qblock"
+	"qbtx"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 交易池默认参数
+const (
+	MAX_SIZE        = 5000             // 交易池最多容纳的交易数量
+	MAX_BLOCK_TXS   = 500              // 单个区块最多打包的交易数量
+	EXPIRY          = 30 * time.Minute // 交易在池中的最长停留时间，超时淘汰
+	PROPOSE_TIMEOUT = 30 * time.Second // 交易被提议后等待上链的时间，超时后可再次打包
+)
+
+// Ordering，打包时交易的排序方式
+type Ordering int
+
+const (
+	ORDER_ARRIVAL Ordering = iota // 按到达顺序
+	ORDER_FEE                     // 按手续费率（手续费/交易字节数）从高到低，相同时按到达顺序
+)
+
+// 交易入池被拒绝的原因
+var (
+	ErrAlreadyInPool = errors.New("transaction is already in the mempool")                     // 重复提交
+	ErrConflict      = errors.New("output is already spent by another transaction in mempool") // 与池中交易花费同一输出
+	ErrMempoolFull   = errors.New("mempool is full")                                           // 交易池已满
+)
+
+// entry，交易池中的一条交易
+type entry struct {
+	tx       *qbtx.Transaction
+	seq      uint64    // 到达序号
+	arrival  time.Time // 到达时间
+	fee      int       // 手续费=输入总额-输出总额
+	size     int       // 交易序列化后的字节数
+	proposed time.Time // 最近一次被打包提议的时间，零值表示未提议
+}
+
+// Mempool，交易池
+type Mempool struct {
+	Max_size        int           // 交易池容量
+	Max_block_txs   int           // 单个区块最多打包的交易数量
+	Expiry          time.Duration // 交易最长停留时间
+	Propose_timeout time.Duration // 提议后等待上链的时间
+	Order           Ordering      // 打包排序方式
+
+	mu      sync.Mutex
+	seq     uint64
+	entries map[string]*entry // key=交易ID的十六进制
+	spends  map[string]string // 池中交易花费的输出，key=outpoint，value=花费它的交易ID
+}
+
+// NewMempool，创建交易池
+// 参数：排序方式Ordering
+// 返回值：交易池*Mempool
+func NewMempool(order Ordering) *Mempool {
+	return &Mempool{
+		Max_size:        MAX_SIZE,
+		Max_block_txs:   MAX_BLOCK_TXS,
+		Expiry:          EXPIRY,
+		Propose_timeout: PROPOSE_TIMEOUT,
+		Order:           order,
+
+		entries: make(map[string]*entry),
+		spends:  make(map[string]string),
+	}
+}
+
+// Add，校验交易并加入交易池。交易可以花费池中其他交易的输出，锁定时间与相对锁定须在下一区块处已到期
+// 参数：交易，已上链的UTXO视图，下一区块的高度与时间qbvalidate.TargetBlock
+// 返回值：拒绝原因error，入池成功时为nil
+func (mp *Mempool) Add(tx *qbtx.Transaction, view qbvalidate.UTXOView, next qbvalidate.TargetBlock) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.add(tx, view, next, time.Now())
+}
+
+// add，校验交易并以给定的到达时间入池，调用方须持有锁
+func (mp *Mempool) add(tx *qbtx.Transaction, view qbvalidate.UTXOView, next qbvalidate.TargetBlock, arrival time.Time) error {
+	if tx == nil {
+		return &qbvalidate.TXRejectError{Err: qbvalidate.ErrTXEmpty}
+	}
+	txid := hex.EncodeToString(tx.TX_id)
+	if _, ok := mp.entries[txid]; ok {
+		return &qbvalidate.TXRejectError{TX_id: tx.TX_id, Err: ErrAlreadyInPool}
+	}
+	for in_id, vin := range tx.TX_vin {
+		if _, ok := mp.spends[outpoint(vin.Refer_tx_id, vin.Refer_tx_id_index)]; ok {
+			return &qbtx.TXInputError{TX_id: tx.TX_id, In_id: in_id, Err: ErrConflict}
+		}
+	}
+	if len(mp.entries) >= mp.Max_size {
+		mp.expire(time.Now())
+		if len(mp.entries) >= mp.Max_size {
+			return &qbvalidate.TXRejectError{TX_id: tx.TX_id, Err: ErrMempoolFull}
+		}
+	}
+
+	fee, err := qbvalidate.TransactionFee(tx, &poolView{pool: mp, base: view}, next)
+	if err != nil {
+		return err
+	}
+
+	mp.seq++
+	mp.entries[txid] = &entry{
+		tx:      tx,
+		seq:     mp.seq,
+		arrival: arrival,
+		fee:     fee,
+		size:    len(tx.SerializeTX()),
+	}
+	for _, vin := range tx.TX_vin {
+		mp.spends[outpoint(vin.Refer_tx_id, vin.Refer_tx_id_index)] = txid
+	}
+	return nil
+}
+
+// Select，按排序方式选出一批待打包交易并标记为已提议；依赖池中其他交易的交易排在其父交易之后，
+// 父交易未被选中时不选。已提议且未超时的交易不会被重复选出
+// 参数：当前时间
+// 返回值：待打包交易数组
+func (mp *Mempool) Select(now time.Time) []*qbtx.Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var candidates []*entry
+	for _, e := range mp.entries {
+		if e.proposed.IsZero() || now.Sub(e.proposed) >= mp.Propose_timeout {
+			candidates = append(candidates, e)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if mp.Order == ORDER_FEE {
+			// 比较fee_i/size_i与fee_j/size_j，交叉相乘避免浮点误差
+			rate_i := candidates[i].fee * candidates[j].size
+			rate_j := candidates[j].fee * candidates[i].size
+			if rate_i != rate_j {
+				return rate_i > rate_j
+			}
+		}
+		return candidates[i].seq < candidates[j].seq
+	})
+
+	var txs []*qbtx.Transaction
+	selected := make(map[string]bool)
+	for progress := true; progress && len(txs) < mp.Max_block_txs; {
+		progress = false
+		for _, e := range candidates {
+			txid := hex.EncodeToString(e.tx.TX_id)
+			if selected[txid] || !mp.parentsSelected(e.tx, selected) {
+				continue
+			}
+			selected[txid] = true
+			txs = append(txs, e.tx)
+			e.proposed = now
+			progress = true
+			if len(txs) >= mp.Max_block_txs {
+				break
+			}
+		}
+	}
+	return txs
+}
+
+// parentsSelected，判断交易所花费的池中交易是否都已被选中
+func (mp *Mempool) parentsSelected(tx *qbtx.Transaction, selected map[string]bool) bool {
+	for _, vin := range tx.TX_vin {
+		parent := hex.EncodeToString(vin.Refer_tx_id)
+		if _, in_pool := mp.entries[parent]; in_pool && !selected[parent] {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveBlock，区块上链后移除其中的交易，并淘汰与区块交易花费同一输出的池中交易及其后代
+// 参数：已提交的区块
+// 返回值：因冲突被淘汰的交易数量int
+func (mp *Mempool) RemoveBlock(block *qblock.Block) int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	for _, tx := range block.Transactions {
+		mp.remove(hex.EncodeToString(tx.TX_id))
+	}
+	evicted := 0
+	for _, tx := range block.Transactions {
+		if tx.IsReserveTX() || tx.IsFeeTX() {
+			continue
+		}
+		for _, vin := range tx.TX_vin {
+			if spender, ok := mp.spends[outpoint(vin.Refer_tx_id, vin.Refer_tx_id_index)]; ok {
+				evicted += mp.removeWithDescendants(spender)
+			}
+		}
+	}
+	return evicted
+}
+
+// Remove，从交易池移除交易及依赖它的交易
+// 参数：交易ID
+// 返回值：移除的交易数量int
+func (mp *Mempool) Remove(txid []byte) int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.removeWithDescendants(hex.EncodeToString(txid))
+}
+
+// Expire，淘汰停留时间超过Expiry的交易及其后代
+// 参数：当前时间
+// 返回值：淘汰的交易数量int
+func (mp *Mempool) Expire(now time.Time) int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.expire(now)
+}
+
+func (mp *Mempool) expire(now time.Time) int {
+	var stale []string
+	for txid, e := range mp.entries {
+		if now.Sub(e.arrival) > mp.Expiry {
+			stale = append(stale, txid)
+		}
+	}
+	count := 0
+	for _, txid := range stale {
+		count += mp.removeWithDescendants(txid)
+	}
+	return count
+}
+
+// Fees，计算一组池中交易的手续费总额，不在池中的交易不计
+// 参数：交易数组
+// 返回值：手续费总额int
+func (mp *Mempool) Fees(txs []*qbtx.Transaction) int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	total := 0
+	for _, tx := range txs {
+		if e, ok := mp.entries[hex.EncodeToString(tx.TX_id)]; ok {
+			total += e.fee
+		}
+	}
+	return total
+}
+
+// Has，判断交易是否在池中
+func (mp *Mempool) Has(txid []byte) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	_, ok := mp.entries[hex.EncodeToString(txid)]
+	return ok
+}
+
+// Pending，按到达顺序返回池中全部交易，供钱包在已上链的输出上叠加未确认的花费与找零
+// 参数：
+// 返回值：交易数组
+func (mp *Mempool) Pending() []*qbtx.Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	entries := make([]*entry, 0, len(mp.entries))
+	for _, e := range mp.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	txs := make([]*qbtx.Transaction, len(entries))
+	for i, e := range entries {
+		txs[i] = e.tx
+	}
+	return txs
+}
+
+// savedTX，保存到文件的池中交易及其到达时间，重启后按原到达时间计算过期
+type savedTX struct {
+	TX      *qbtx.Transaction
+	Arrival time.Time
+}
+
+// Save，按到达顺序保存池中全部交易，节点重启后以Load恢复
+// 参数：输出io.Writer
+// 返回值：error
+func (mp *Mempool) Save(w io.Writer) error {
+	mp.mu.Lock()
+	entries := make([]*entry, 0, len(mp.entries))
+	for _, e := range mp.entries {
+		entries = append(entries, e)
+	}
+	mp.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	saved := make([]savedTX, len(entries))
+	for i, e := range entries {
+		saved[i] = savedTX{TX: e.tx, Arrival: e.arrival}
+	}
+	return gob.NewEncoder(w).Encode(saved)
+}
+
+// Load，恢复Save保存的交易：按到达顺序依据当前账本重新校验后入池，已过期、已上链或与账本冲突的交易被丢弃
+// 参数：输入io.Reader，已上链的UTXO视图，下一区块的高度与时间qbvalidate.TargetBlock
+// 返回值：恢复的交易数int，每笔被丢弃交易的原因[]error，文件无法解码时返回error
+func (mp *Mempool) Load(r io.Reader, view qbvalidate.UTXOView, next qbvalidate.TargetBlock) (int, []error, error) {
+	var saved []savedTX
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return 0, nil, err
+	}
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	now := time.Now()
+	loaded := 0
+	var errs []error
+	for _, s := range saved {
+		if now.Sub(s.Arrival) > mp.Expiry {
+			continue
+		}
+		if err := mp.add(s.TX, view, next, s.Arrival); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		loaded++
+	}
+	return loaded, errs, nil
+}
+
+// Count，池中交易数量
+func (mp *Mempool) Count() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return len(mp.entries)
+}
+
+// remove，移除单笔交易及其花费记录
+func (mp *Mempool) remove(txid string) bool {
+	e, ok := mp.entries[txid]
+	if !ok {
+		return false
+	}
+	for _, vin := range e.tx.TX_vin {
+		key := outpoint(vin.Refer_tx_id, vin.Refer_tx_id_index)
+		if mp.spends[key] == txid {
+			delete(mp.spends, key)
+		}
+	}
+	delete(mp.entries, txid)
+	return true
+}
+
+// removeWithDescendants，移除交易及所有花费其输出的池中交易
+func (mp *Mempool) removeWithDescendants(txid string) int {
+	e, ok := mp.entries[txid]
+	if !ok {
+		return 0
+	}
+	mp.remove(txid)
+	count := 1
+	for out_idx := range e.tx.TX_vout {
+		if child, ok := mp.spends[outpoint(e.tx.TX_id, out_idx)]; ok {
+			count += mp.removeWithDescendants(child)
+		}
+	}
+	return count
+}
+
+// poolView，在已上链UTXO视图上叠加池中交易的输出
+type poolView struct {
+	pool *Mempool
+	base qbvalidate.UTXOView
+}
+
+// GetUTXO，先查池中交易的输出，再查基础视图；池中已被花费的输出由冲突检查拦截
+func (v *poolView) GetUTXO(txid []byte, index int) (qbtx.TXOutput, bool) {
+	if e, ok := v.pool.entries[hex.EncodeToString(txid)]; ok {
+		if index < 0 || index >= len(e.tx.TX_vout) {
+			return qbtx.TXOutput{}, false
+		}
+		return e.tx.TX_vout[index], true
+	}
+	return v.base.GetUTXO(txid, index)
+}
+
+// UTXOHeight，池中交易的输出尚未上链，其余交易查询基础视图
+func (v *poolView) UTXOHeight(txid []byte) (int64, bool) {
+	if _, ok := v.pool.entries[hex.EncodeToString(txid)]; ok {
+		return 0, false
+	}
+	return v.base.UTXOHeight(txid)
+}
+
+// HasTransaction，池中交易尚未上链，其余交易查询基础视图
+func (v *poolView) HasTransaction(txid []byte) bool {
+	if _, ok := v.pool.entries[hex.EncodeToString(txid)]; ok {
+		return false
+	}
+	return qbvalidate.TXExists(v.base, txid)
+}
+
+// outpoint，输出定位键：交易ID:输出编号
+func outpoint(txid []byte, index int) string {
+	return fmt.Sprintf("%s:%d", hex.EncodeToString(txid), index)
+}
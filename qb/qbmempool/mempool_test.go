@@ -0,0 +1,187 @@
+package qbmempool
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"qb/qbvalidate"
+	"qblock"
+	"qbtx"
+	"qkdserv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	addrC1 = "1CG9GcxF2BT1rjxwoMHSLtRP9RTCsSkRyH" // C1的钱包地址
+	addrP1 = "195KpL1PxRzvVKxg33YYbWjgFqxFAbBit9" // P1的钱包地址
+)
+
+// mapView，测试用的UTXO视图
+type mapView map[string]qbtx.TXOutput
+
+func (m mapView) GetUTXO(txid []byte, index int) (qbtx.TXOutput, bool) {
+	out, ok := m[outpoint(txid, index)]
+	return out, ok
+}
+
+func (m mapView) UTXOHeight(txid []byte) (int64, bool) {
+	prefix := hex.EncodeToString(txid) + ":"
+	for key := range m {
+		if strings.HasPrefix(key, prefix) {
+			return 0, true // 测试输出均在创世区块中
+		}
+	}
+	return 0, false
+}
+
+// next，测试交易将被打包进的区块
+var next = qbvalidate.TargetBlock{Height: 1}
+
+// signedTX，以C1身份生成一笔已签名的交易，找零返回C1
+func signedTX(refer []byte, index int, value int, change int) *qbtx.Transaction {
+	tx := &qbtx.Transaction{
+		TX_vin: []qbtx.TXInput{{
+			Refer_tx_id:       refer,
+			Refer_tx_id_index: index,
+			TX_src:            addrC1,
+		}},
+		TX_vout: []qbtx.TXOutput{{TX_value: value, TX_dst: addrP1}},
+	}
+	if change > 0 {
+		tx.TX_vout = append(tx.TX_vout, qbtx.TXOutput{TX_value: change, TX_dst: addrC1})
+	}
+	qkdserv.Node_name = "C1"
+	tx.USSTransactionSign("C1")
+	tx.TX_id = tx.SetID()
+	qkdserv.Node_name = "P1"
+	return tx
+}
+
+func TestMain(m *testing.M) {
+	os.Chdir("..") // 配置文件路径相对于qb目录
+	qkdserv.QKD_sign_random_matrix_pool = make(map[qkdserv.QKDSignMatrixIndex]qkdserv.QKDSignRandomsMatrix)
+	qbtx.N = 4
+	os.Exit(m.Run())
+}
+
+func TestMempool(t *testing.T) {
+	fmt.Println("----------【Mempool】——Add && Select && RemoveBlock && Expire-----------------------------------------------")
+
+	funding := []byte("funding")
+	view := mapView{
+		outpoint(funding, 0): {TX_value: 10, TX_dst: addrC1},
+		outpoint(funding, 1): {TX_value: 10, TX_dst: addrC1},
+		outpoint(funding, 2): {TX_value: 10, TX_dst: addrC1},
+	}
+	mp := NewMempool(ORDER_FEE)
+
+	low := signedTX(funding, 0, 5, 4)       // 手续费1
+	high := signedTX(funding, 1, 5, 2)      // 手续费3
+	child := signedTX(low.TX_id, 1, 4, 0)   // 花费low的找零
+	conflict := signedTX(funding, 0, 10, 0) // 与low花费同一输出
+	if err := mp.Add(low, view, next); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Add(low, view, next); !errors.Is(err, ErrAlreadyInPool) {
+		t.Errorf("duplicate: got %v, want %v", err, ErrAlreadyInPool)
+	}
+	if err := mp.Add(conflict, view, next); !errors.Is(err, ErrConflict) {
+		t.Errorf("conflict: got %v, want %v", err, ErrConflict)
+	}
+	if err := mp.Add(signedTX(funding, 2, 11, 0), view, next); !errors.Is(err, qbvalidate.ErrInsufficientInput) {
+		t.Errorf("insufficient: got %v, want %v", err, qbvalidate.ErrInsufficientInput)
+	}
+	if err := mp.Add(child, view, next); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Add(high, view, next); err != nil {
+		t.Fatal(err)
+	}
+
+	// 按手续费排序，child排在其父交易low之后
+	now := time.Now()
+	txs := mp.Select(now)
+	if len(txs) != 3 || txs[0] != high || txs[1] != low || txs[2] != child {
+		t.Errorf("select order wrong: got %d txs", len(txs))
+	}
+	if len(mp.Select(now)) != 0 {
+		t.Error("proposed transactions selected again before timeout")
+	}
+	if len(mp.Select(now.Add(PROPOSE_TIMEOUT))) != 3 {
+		t.Error("proposed transactions not selected again after timeout")
+	}
+
+	// 区块容量限制
+	mp.Max_block_txs = 1
+	if txs := mp.Select(now.Add(2 * PROPOSE_TIMEOUT)); len(txs) != 1 || txs[0] != high {
+		t.Errorf("block cap: got %d txs", len(txs))
+	}
+	mp.Max_block_txs = MAX_BLOCK_TXS
+
+	// 上链区块中的交易被移除，冲突交易及其后代被淘汰
+	block := &qblock.Block{Transactions: []*qbtx.Transaction{high, conflict}}
+	if evicted := mp.RemoveBlock(block); evicted != 2 || mp.Count() != 0 {
+		t.Errorf("remove block: evicted %d, %d left", evicted, mp.Count())
+	}
+
+	// 交易池容量与过期淘汰
+	mp.Max_size = 1
+	if err := mp.Add(low, view, next); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Add(high, view, next); !errors.Is(err, ErrMempoolFull) {
+		t.Errorf("full: got %v, want %v", err, ErrMempoolFull)
+	}
+	if n := mp.Expire(time.Now().Add(EXPIRY + time.Second)); n != 1 || mp.Has(low.TX_id) {
+		t.Errorf("expire: evicted %d, tx %s still in pool", n, hex.EncodeToString(low.TX_id))
+	}
+	fmt.Println("mempool success")
+}
+
+func TestSaveLoad(t *testing.T) {
+	fmt.Println("----------【Mempool】——Save && Load------------------------------------------------------------------------")
+	funding := []byte("funding")
+	view := mapView{
+		outpoint(funding, 0): {TX_value: 10, TX_dst: addrC1},
+		outpoint(funding, 1): {TX_value: 10, TX_dst: addrC1},
+	}
+	mp := NewMempool(ORDER_FEE)
+	parent := signedTX(funding, 0, 5, 4)
+	child := signedTX(parent.TX_id, 1, 4, 0) // 花费parent的找零，恢复时须排在parent之后
+	spent := signedTX(funding, 1, 5, 4)
+	for _, tx := range []*qbtx.Transaction{parent, child, spent} {
+		if err := mp.Add(tx, view, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var saved bytes.Buffer
+	if err := mp.Save(&saved); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启期间spent花费的输出已在账本中被花费，恢复时重新校验后丢弃
+	delete(view, outpoint(funding, 1))
+	restored := NewMempool(ORDER_FEE)
+	loaded, errs, err := restored.Load(bytes.NewReader(saved.Bytes()), view, next)
+	if err != nil || loaded != 2 || len(errs) != 1 || !errors.Is(errs[0], qbvalidate.ErrMissingOutput) {
+		t.Fatalf("loaded %d, rejected %v: %v", loaded, errs, err)
+	}
+	if !restored.Has(parent.TX_id) || !restored.Has(child.TX_id) || restored.Has(spent.TX_id) {
+		t.Error("restored mempool has the wrong transactions")
+	}
+
+	// 保存后已过期的交易不再恢复
+	restored = NewMempool(ORDER_FEE)
+	restored.Expiry = 0
+	if loaded, _, err = restored.Load(bytes.NewReader(saved.Bytes()), view, next); err != nil || loaded != 0 {
+		t.Errorf("expired transactions restored: %d, %v", loaded, err)
+	}
+	if _, _, err = restored.Load(bytes.NewReader([]byte("not a mempool")), view, next); err == nil {
+		t.Error("malformed mempool file accepted")
+	}
+	fmt.Println("save and load success")
+}
@@ -2,8 +2,14 @@ package qbnode
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 	"pbft"
+	"qb/qbmempool"
+	"qb/qbutxo"
+	"qb/quantumbc"
 	"qbtx"
 	"time"
 	"utils"
@@ -23,7 +29,10 @@ type Node struct {
 	Node_consensus_table map[string]string
 	Addr_table           map[string]string
 
-	TranscationMsgs []*qbtx.Transaction
+	Mempool *qbmempool.Mempool    // 交易池，缓存待打包的交易
+	Ledger  *quantumbc.Blockchain // 本节点账本，联盟节点启动时打开一次并由各线程共享，客户端为nil
+
+	Prune_depth int64 // 修剪模式下保留完整内容的最新区块数，0表示不修剪
 
 	PBFT_url     string
 	Primary      string
@@ -55,7 +64,7 @@ func NewNode(node_name string) *Node {
 		Node_consensus_table: utils.InitConfig(utils.INIT_PATH + "pbft_localhost.txt"),
 		Addr_table:           make(map[string]string),
 
-		TranscationMsgs: make([]*qbtx.Transaction, 0),
+		Mempool: qbmempool.NewMempool(qbmempool.ORDER_FEE),
 
 		PBFT_url:     "",
 		Primary:      "",
@@ -87,3 +96,57 @@ func NewNode(node_name string) *Node {
 	//node.httplisten() // 开启http
 	return node
 }
+
+// MempoolPath，节点交易池文件的路径，与账本位于同一数据目录
+func MempoolPath(nodeID string) string {
+	return filepath.Join(quantumbc.Data_dir, fmt.Sprintf("mempool_%s.dat", nodeID))
+}
+
+// node.SaveMempool，将交易池中的交易保存到文件，先写入临时文件再替换，写入中断时不破坏已保存的文件
+// 参数：无
+// 返回值：error
+func (node *Node) SaveMempool() error {
+	path := MempoolPath(node.Node_name)
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err = node.Mempool.Save(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// node.LoadMempool，启动时恢复保存的交易，依据当前账本重新校验后入池，被丢弃的交易记录到节点日志；没有保存的文件时不做任何事
+// 参数：无
+// 返回值：恢复的交易数int，error
+func (node *Node) LoadMempool() (int, error) {
+	file, err := os.Open(MempoolPath(node.Node_name))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	UTXOSet := qbutxo.UTXOSet{
+		Blockchain: node.Ledger,
+	}
+	loaded, errs, err := node.Mempool.Load(file, &UTXOSet, node.nextBlock())
+	if err != nil {
+		return 0, err
+	}
+	if len(errs) > 0 {
+		logFile, _ := utils.Init_log(NODE_LOG_PATH + node.Node_name + ".log")
+		defer logFile.Close()
+		log.SetPrefix("[reject tx]")
+		for _, err := range errs {
+			log.Println(err)
+		}
+	}
+	return loaded, nil
+}
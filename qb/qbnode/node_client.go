@@ -0,0 +1,151 @@
+package qbnode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"qb/qbutxo"
+	"qb/quantumbc"
+	"qblock"
+	"strconv"
+	"uss"
+	"utils"
+)
+
+// ErrHashUnconfirmed，区块hash未得到足够多节点的确认
+var ErrHashUnconfirmed = errors.New("block hash is not confirmed by enough replicas")
+
+// HeaderReply，区块头查询应答，附带提议者对区块hash的签名；区块已修剪时签名取自修剪时保存的记录，创世区块不签名
+type HeaderReply struct {
+	qblock.BlockHeader
+	Block_uss *uss.USSToeplitzHashSignMsg `json:"BlockUss,omitempty"` // 提议者签名
+}
+
+// BalanceReply，余额查询应答
+type BalanceReply struct {
+	Address string         `json:"address"`
+	Balance int            `json:"balance"`
+	Assets  map[string]int `json:"assets,omitempty"` // 原生币以外各资产的余额
+}
+
+// HistoryReply，收支记录查询应答，Events为本页记录，Total为记录总数
+type HistoryReply struct {
+	Address string                   `json:"address"`
+	Total   int                      `json:"total"`
+	Events  []quantumbc.AddressEvent `json:"events"`
+}
+
+// node.query，向主节点发送查询请求并解析json应答
+// 参数：路径，查询参数，应答结构指针
+// 返回值：请求或解析错误error
+func (node *Node) query(path string, params url.Values, reply interface{}) error {
+	return node.queryNode(node.Primary, path, params, reply)
+}
+
+// node.queryNode，向指定节点发送查询请求并解析json应答
+// 参数：节点名称，路径，查询参数，应答结构指针
+// 返回值：请求或解析错误error
+func (node *Node) queryNode(name, path string, params url.Values, reply interface{}) error {
+	data, err := utils.Get(node.Node_table[name] + path + "?" + params.Encode())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, reply)
+}
+
+// node.QueryBalance，通过主节点查询地址余额，不读取本地账本文件
+// 参数：钱包地址string
+// 返回值：余额int，error
+func (node *Node) QueryBalance(address string) (int, error) {
+	var reply BalanceReply
+	err := node.query("/balance", url.Values{"address": {address}}, &reply)
+	return reply.Balance, err
+}
+
+// node.QueryBalances，通过主节点查询地址各资产的余额
+// 参数：钱包地址string
+// 返回值：原生币余额int，其他资产的余额map[string]int，error
+func (node *Node) QueryBalances(address string) (int, map[string]int, error) {
+	var reply BalanceReply
+	err := node.query("/balance", url.Values{"address": {address}}, &reply)
+	return reply.Balance, reply.Assets, err
+}
+
+// node.QueryHistory，通过主节点分页查询地址收支记录，按时间由新到旧排列
+// 参数：钱包地址string，跳过的记录数int，本页最多记录数int
+// 返回值：本页记录[]quantumbc.AddressEvent，记录总数int，error
+func (node *Node) QueryHistory(address string, offset, limit int) ([]quantumbc.AddressEvent, int, error) {
+	var reply HistoryReply
+	params := url.Values{
+		"address": {address},
+		"offset":  {strconv.Itoa(offset)},
+		"limit":   {strconv.Itoa(limit)},
+	}
+	err := node.query("/history", params, &reply)
+	return reply.Events, reply.Total, err
+}
+
+// node.QueryUTXO，通过主节点查询地址的全部未花费输出，用于在客户端构造交易
+// 参数：钱包地址string
+// 返回值：未花费输出qbutxo.AddressOutputs，error
+func (node *Node) QueryUTXO(address string) (qbutxo.AddressOutputs, error) {
+	var outs qbutxo.AddressOutputs
+	err := node.query("/utxo", url.Values{"address": {address}}, &outs)
+	return outs, err
+}
+
+// node.QuerySpendable，通过主节点查询地址可花费的输出，叠加主节点交易池中未上链的交易：
+// 已被池中交易花费的输出不再返回，池中交易付给该地址的找零等输出标记为Unconfirmed，用于连续发送多笔交易
+// 参数：钱包地址string
+// 返回值：可花费输出qbutxo.AddressOutputs，error
+func (node *Node) QuerySpendable(address string) (qbutxo.AddressOutputs, error) {
+	var outs qbutxo.AddressOutputs
+	err := node.query("/utxo", url.Values{"address": {address}, "pending": {"1"}}, &outs)
+	return outs, err
+}
+
+// node.QueryBlock，通过主节点按高度获取完整区块，用于同步最近的区块；主节点已修剪该区块时返回410错误
+// 参数：区块高度int64
+// 返回值：区块*qblock.Block，error
+func (node *Node) QueryBlock(height int64) (*qblock.Block, error) {
+	var block qblock.Block
+	if err := node.query("/block", url.Values{"height": {strconv.FormatInt(height, 10)}}, &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// node.QueryHeader，向指定节点按高度查询区块头
+// 参数：节点名称string，区块高度int64
+// 返回值：区块头*qblock.BlockHeader，error
+func (node *Node) QueryHeader(name string, height int64) (*qblock.BlockHeader, error) {
+	var reply HeaderReply
+	if err := node.queryNode(name, "/header", url.Values{"height": {strconv.FormatInt(height, 10)}}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply.BlockHeader, nil
+}
+
+// node.ConfirmBlockHash，向主节点以外的联盟成员分别查询该高度的区块头，至少quorum个节点的区块头与其hash一致且等于hash时确认。
+// 主节点提供的交易包含证明只能说明交易在主节点所给的区块中，quorum取F+1时至少一个诚实节点确认了该区块
+// 参数：联盟成员[]string，区块高度int64，待确认的区块hash[]byte，所需确认数int
+// 返回值：确认不足时返回ErrHashUnconfirmed
+func (node *Node) ConfirmBlockHash(members []string, height int64, hash []byte, quorum int) error {
+	confirmed := 0
+	for _, name := range members {
+		if name == node.Primary {
+			continue
+		}
+		header, err := node.QueryHeader(name, height)
+		if err != nil || !bytes.Equal(header.HeaderToResolveHash(), header.Hash) || !bytes.Equal(header.Hash, hash) {
+			continue // 无法访问、没有该区块或给出不同区块的节点不计入确认
+		}
+		confirmed++
+		if confirmed >= quorum {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d of %d at height %d", ErrHashUnconfirmed, confirmed, quorum, height)
+}
@@ -1,12 +1,20 @@
 package qbnode
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"pbft"
+	"qb/qbutxo"
+	"qb/qbvalidate"
+	"qb/quantumbc"
+	"qblock"
 	"qbtx"
+	"strconv"
 	"utils"
 )
 
@@ -15,6 +23,13 @@ func (node *Node) setRoute() {
 	http.HandleFunc("/transaction", node.getTranscation)
 	http.HandleFunc("/reply", node.getReply)
 	http.HandleFunc("/txreply", node.getTXReply)
+	http.HandleFunc("/validate", node.getValidate)
+	http.HandleFunc("/proof", node.getProof)
+	http.HandleFunc("/block", node.getBlock)
+	http.HandleFunc("/header", node.getHeader)
+	http.HandleFunc("/balance", node.getBalance)
+	http.HandleFunc("/history", node.getHistory)
+	http.HandleFunc("/utxo", node.getUTXO)
 }
 
 // getTranscation，解析交易消息
@@ -62,6 +77,153 @@ func (node *Node) getTXReply(writer http.ResponseWriter, request *http.Request)
 
 }
 
+// getValidate，共识节点请求依据本节点账本与UTXO集合完整校验区块，返回拒绝原因
+func (node *Node) getValidate(writer http.ResponseWriter, request *http.Request) {
+	var block qblock.Block
+	err := json.NewDecoder(request.Body).Decode(&block)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = qbvalidate.ValidateBlock(&block, node.Ledger.GetlastHeader(), node.Ledger)
+
+	reply := pbft.ValidateReplyMsg{}
+	if err != nil {
+		reply.Errors = append(reply.Errors, err.Error())
+	}
+	json.NewEncoder(writer).Encode(reply)
+
+	file, _ := utils.Init_log(NODE_LOG_PATH + node.Node_name + ".log")
+	defer file.Close()
+	log.SetPrefix("[validate block]")
+	if err != nil {
+		log.Println(err)
+	} else {
+		log.Printf("block %d is valid\n", block.Height)
+	}
+}
+
+// getProof，返回交易包含证明，请求形式为/proof?txid=交易ID（十六进制）
+func (node *Node) getProof(writer http.ResponseWriter, request *http.Request) {
+	txid, err := hex.DecodeString(request.URL.Query().Get("txid"))
+	if err != nil || len(txid) == 0 {
+		http.Error(writer, "invalid txid", http.StatusBadRequest)
+		return
+	}
+	block, err := node.Ledger.FindTransaction(txid)
+	if err != nil {
+		http.Error(writer, err.Error(), ledgerStatus(err))
+		return
+	}
+	proof, ok := block.NewTXProof(txid)
+	if !ok {
+		for _, tx := range block.Transactions {
+			if bytes.Equal(tx.TX_id, txid) { // 交易在区块中，但区块交易无法组建默克尔树
+				http.Error(writer, fmt.Sprintf("merkle tree of block %d cannot be built", block.Height), http.StatusInternalServerError)
+				return
+			}
+		}
+		// 交易索引指向的区块不含该交易
+		http.Error(writer, fmt.Sprintf("transaction %x is not in block %d", txid, block.Height), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(writer).Encode(proof)
+}
+
+// getBlock，按高度查询完整区块，供同步中的节点获取最近的区块，请求形式为/block?height=区块高度。
+// 已修剪或早于快照的区块返回410，高度超出账本时返回404
+func (node *Node) getBlock(writer http.ResponseWriter, request *http.Request) {
+	height, err := strconv.ParseInt(request.URL.Query().Get("height"), 10, 64)
+	if err != nil || height < 0 {
+		http.Error(writer, "invalid height", http.StatusBadRequest)
+		return
+	}
+	block, err := node.Ledger.GetBlockByHeight(height)
+	if err != nil {
+		http.Error(writer, err.Error(), ledgerStatus(err))
+		return
+	}
+	json.NewEncoder(writer).Encode(block)
+}
+
+// getHeader，按高度查询区块头及提议者签名，供客户端向多个节点核对交易包含证明中的区块hash，请求形式为/header?height=区块高度
+func (node *Node) getHeader(writer http.ResponseWriter, request *http.Request) {
+	height, err := strconv.ParseInt(request.URL.Query().Get("height"), 10, 64)
+	if err != nil || height < 0 {
+		http.Error(writer, "invalid height", http.StatusBadRequest)
+		return
+	}
+	header, err := node.Ledger.GetHeaderByHeight(height)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusNotFound)
+		return
+	}
+	reply := HeaderReply{BlockHeader: *header}
+	if cert, err := node.Ledger.GetBlockCert(header.Hash); err == nil && height > 0 { // 早于快照的区块没有签名，只返回区块头
+		reply.Block_uss = &cert
+	}
+	json.NewEncoder(writer).Encode(reply)
+}
+
+// ledgerStatus，账本查询错误对应的HTTP状态码：区块内容未保存时为410，其余为404
+func ledgerStatus(err error) int {
+	if errors.Is(err, quantumbc.ErrNoHistory) {
+		return http.StatusGone
+	}
+	return http.StatusNotFound
+}
+
+// getBalance，查询地址各资产的余额，请求形式为/balance?address=钱包地址
+func (node *Node) getBalance(writer http.ResponseWriter, request *http.Request) {
+	address := request.URL.Query().Get("address")
+	if address == "" {
+		http.Error(writer, "missing address", http.StatusBadRequest)
+		return
+	}
+	balances := node.Ledger.GetBalances(address)
+	reply := BalanceReply{Address: address, Balance: balances[""]}
+	delete(balances, "")
+	if len(balances) > 0 {
+		reply.Assets = balances
+	}
+	json.NewEncoder(writer).Encode(reply)
+}
+
+// getHistory，分页查询地址收支记录，请求形式为/history?address=钱包地址&offset=跳过条数&limit=本页条数
+func (node *Node) getHistory(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	address := query.Get("address")
+	offset, err1 := strconv.Atoi(query.Get("offset"))
+	limit, err2 := strconv.Atoi(query.Get("limit"))
+	if address == "" || err1 != nil || err2 != nil || offset < 0 || limit <= 0 {
+		http.Error(writer, "invalid address, offset or limit", http.StatusBadRequest)
+		return
+	}
+	events, total := node.Ledger.GetAddressHistory(address, offset, limit)
+	json.NewEncoder(writer).Encode(HistoryReply{address, total, events})
+}
+
+// getUTXO，查询地址的全部未花费输出，请求形式为/utxo?address=钱包地址&pending=1。
+// 带pending参数时叠加本节点交易池：不含已被池中交易花费的输出，并包含池中交易付给该地址的未确认输出
+func (node *Node) getUTXO(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	address := query.Get("address")
+	if address == "" {
+		http.Error(writer, "missing address", http.StatusBadRequest)
+		return
+	}
+	var source qbutxo.OutputSource = &qbutxo.UTXOSet{Blockchain: node.Ledger}
+	if query.Get("pending") != "" && node.Mempool != nil {
+		source = &qbutxo.PendingView{Confirmed: source, Pending: node.Mempool}
+	}
+	outs, err := source.SpendableOutputs(address)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(writer).Encode(outs)
+}
+
 // node.httplisten，开启Http服务器
 // 参数：无
 // 返回值：无
@@ -4,9 +4,11 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
-	"qb/quantumbc"
+	"qb/qbutxo"
+	"qb/qbvalidate"
 	"qblock"
 	"qbtx"
+	"time"
 	"utils"
 )
 
@@ -28,51 +30,99 @@ func (node *Node) blockMsg() {
 	}
 }
 
-// node.startTopbft,将收到的交易信息存储到数组
+// node.startTopbft,校验收到的交易信息并放入交易池
 // 参数：收到的消息
 // 返回值：处理错误error，默认为nil
 func (node *Node) startTopbft(msg interface{}) error {
 	switch msg := msg.(type) {
 	case *qbtx.Transaction:
-		node.TranscationMsgs = append(node.TranscationMsgs, msg)
+		UTXOSet := qbutxo.UTXOSet{
+			Blockchain: node.Ledger,
+		}
+		err := node.Mempool.Add(msg, &UTXOSet, node.nextBlock())
+		if err != nil {
+			file, _ := utils.Init_log(NODE_LOG_PATH + node.Node_name + ".log")
+			defer file.Close()
+			log.SetPrefix("[reject tx]")
+			log.Println(err)
+		}
 	}
 	return nil
 }
 
-// node.blockWhenClock,当时间片到时，将收到的交易信息打包
+// node.blockWhenClock,当时间片到时，从交易池中选取交易打包
 // 参数：无
 // 返回值：处理错误error，默认为nil
 func (node *Node) blockWhenClock() error {
-	if len(node.TranscationMsgs) >= qblock.BLOCK_LENGTH {
-		msgs := make([]*qbtx.Transaction, len(node.TranscationMsgs))
-		copy(msgs, node.TranscationMsgs) // 复制缓冲数据
-		request := node.block(msgs)
-		node.TranscationMsgs = make([]*qbtx.Transaction, 0) // 清空重置
+	now := time.Now()
+	node.Mempool.Expire(now) // 淘汰过期交易
+	if node.Mempool.Count() < qblock.BLOCK_LENGTH {
+		return nil
+	}
+	msgs := node.validateTX(node.Mempool.Select(now)) // 再次依据最新账本校验
+	if len(msgs) < qblock.BLOCK_LENGTH {
+		return nil
+	}
+	request := node.block(msgs)
 
-		file, _ := utils.Init_log(utils.SIGN_PATH + node.Node_name + ".log")
-		log.SetPrefix("[BLOCK           SIGN]")
-		log.Printf("block Height:%d\n", request.Height)
-		defer file.Close()
-		log.Println("Index of uss:", hex.EncodeToString(request.Block_uss.Sign_index.Sign_task_sn[:]))
-		log.Println("plaintext:", hex.EncodeToString(request.Block_uss.USS_message))
-		log.Println("signature:", hex.EncodeToString(request.Block_uss.USS_signature))
-		log.Printf("Sign of block success\n\n\n")
+	file, _ := utils.Init_log(utils.SIGN_PATH + node.Node_name + ".log")
+	log.SetPrefix("[BLOCK           SIGN]")
+	log.Printf("block Height:%d\n", request.Height)
+	defer file.Close()
+	log.Println("Index of uss:", hex.EncodeToString(request.Block_uss.Sign_index.Sign_task_sn[:]))
+	log.Println("plaintext:", hex.EncodeToString(request.Block_uss.USS_message))
+	log.Println("signature:", hex.EncodeToString(request.Block_uss.USS_signature))
+	log.Printf("Sign of block success\n\n\n")
 
-		file, _ = utils.Init_log(utils.FLOW_PATH + node.Node_name + ".log")
+	file, _ = utils.Init_log(utils.FLOW_PATH + node.Node_name + ".log")
+	defer file.Close()
+	log.SetPrefix("BLOCK-------------------")
+	log.Println("collect enough transactions, create a block")
+	node.MsgBroadcast <- request
+	return nil
+}
+
+// node.validateTX,打包前依据UTXO集合校验交易，记录被拒绝的交易并将其移出交易池
+// 参数：待打包交易
+// 返回值：通过校验的交易
+func (node *Node) validateTX(txs []*qbtx.Transaction) []*qbtx.Transaction {
+	UTXOSet := qbutxo.UTXOSet{
+		Blockchain: node.Ledger,
+	}
+	valid, errs := qbvalidate.ValidateTransactions(txs, &UTXOSet, node.nextBlock())
+
+	if len(errs) != 0 {
+		file, _ := utils.Init_log(NODE_LOG_PATH + node.Node_name + ".log")
 		defer file.Close()
-		log.SetPrefix("BLOCK-------------------")
-		log.Println("collect enough transactions, create a block")
-		node.MsgBroadcast <- request
+		log.SetPrefix("[reject tx]")
+		for _, err := range errs {
+			log.Println(err)
+		}
+		accepted := make(map[*qbtx.Transaction]bool)
+		for _, tx := range valid {
+			accepted[tx] = true
+		}
+		for _, tx := range txs {
+			if !accepted[tx] {
+				node.Mempool.Remove(tx.TX_id)
+			}
+		}
 	}
-	return nil
+	return valid
+}
+
+// node.nextBlock，本节点下一个区块的高度与最新区块的时间，用于校验交易的锁定时间
+// 返回值：qbvalidate.TargetBlock
+func (node *Node) nextBlock() qbvalidate.TargetBlock {
+	last := node.Ledger.GetlastHeader()
+	return qbvalidate.TargetBlock{Height: last.Height + 1, Time_stamp: last.Time_stamp}
 }
 
 func (node *Node) block(txs []*qbtx.Transaction) *qblock.Block {
 	var block *qblock.Block
-	bc := quantumbc.NewBlockchain(node.Node_name)
-	preHash := bc.GetlastHash()
-	lastHeight := bc.GetlastHeight()
-	bc.DB.Close() // 关闭数据库
-	block = qblock.NewBlock(txs, preHash, lastHeight+1)
+	preHash := node.Ledger.GetlastHash()
+	lastHeight := node.Ledger.GetlastHeight()
+	// 手续费支付给本节点
+	block = qblock.NewBlock(txs, preHash, lastHeight+1, node.Mempool.Fees(txs))
 	return block
 }
@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"log"
 	"pbft"
-	"qb/qbutxo"
-	"qb/quantumbc"
 	"qblock"
 	"qbtx"
 	"utils"
@@ -17,17 +15,13 @@ func (node *Node) broadcastMsg() {
 	for {
 		msg := <-node.MsgBroadcast
 		switch msg := msg.(type) {
-		case *qbtx.Transaction: // 客户端发送交易
-			if node.CurrentState == Idle { // 如果未共识
-				jsonMsg, err := json.Marshal(msg) // 将msg信息编码成json格式
-				if err != nil {
-					fmt.Println(err)
-				}
-				utils.Send(node.Node_table[node.Primary]+"/transaction", jsonMsg)
-				node.CurrentState = TX // 更改状态
-			} else {
-				fmt.Println("The last transaction didn't finish,please wait")
+		case *qbtx.Transaction: // 客户端发送交易，无需等待上一笔交易上链，输入由主节点交易池视图选择，不会与未上链的交易冲突
+			jsonMsg, err := json.Marshal(msg) // 将msg信息编码成json格式
+			if err != nil {
+				fmt.Println(err)
 			}
+			utils.Send(node.Node_table[node.Primary]+"/transaction", jsonMsg)
+			node.CurrentState = TX // 更改状态
 		case *qblock.Block:
 			node.broadcastBlock(msg)
 		case *pbft.ReplyMsg:
@@ -55,14 +49,30 @@ func (node *Node) broadcastBlock(msg *qblock.Block) error {
 }
 
 func (node *Node) addBlock(block *qblock.Block) {
-	bc := quantumbc.NewBlockchain(node.Node_name) // 获取账本
-	UTXOSet := qbutxo.UTXOSet{                    // 设置utxo
-		Blockchain: bc,
+	// 非法区块不写入账本，合法区块连同UTXO更新一并写入
+	if err := node.Ledger.AddBlock(block); err != nil {
+		file, _ := utils.Init_log(NODE_LOG_PATH + node.Node_name + ".log")
+		defer file.Close()
+		log.SetPrefix("[reject block]")
+		log.Println(err)
+		return
+	}
+	node.Mempool.RemoveBlock(block) // 移除已上链的交易及与之冲突的交易
+	if node.Prune_depth > 0 {       // 修剪模式下删除超出保留深度的区块内容
+		if _, err := node.Ledger.Prune(node.Prune_depth); err != nil {
+			file, _ := utils.Init_log(NODE_LOG_PATH + node.Node_name + ".log")
+			defer file.Close()
+			log.SetPrefix("[prune]")
+			log.Println(err)
+		}
+	}
+	// 每个区块后保存交易池，节点异常退出时只丢失最近一个区块之后收到的交易
+	if err := node.SaveMempool(); err != nil {
+		file, _ := utils.Init_log(NODE_LOG_PATH + node.Node_name + ".log")
+		defer file.Close()
+		log.SetPrefix("[mempool]")
+		log.Println(err)
 	}
-	bc.AddBlock(block)
-	defer bc.DB.Close() // 关闭数据库
-	UTXOSet.Update(block)
-	UTXOSet.Reindex()
 
 	if node.Node_name == node.Primary {
 		file, _ := utils.Init_log(utils.FLOW_PATH + node.Node_name + ".log")
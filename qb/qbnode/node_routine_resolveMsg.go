@@ -4,9 +4,7 @@ import (
 	"fmt"
 	"log"
 	"pbft"
-	"qb/qbutxo"
 	"qb/qbwallet"
-	"qb/quantumbc"
 	"qbtx"
 	"utils"
 )
@@ -44,18 +42,11 @@ func (node *Node) resolveTXreply(msg *pbft.ReplyMsg) {
 	for _, tx := range msg.Request.Transactions {
 		if string(w.Addr) == tx.TX_vin[0].TX_src {
 			fmt.Println("transaction success")
-			// 获取余额
-			bc := quantumbc.NewBlockchain("P1") // 获取当前全账本
-			UTXOSet := qbutxo.UTXOSet{
-				Blockchain: bc,
-			}
-			defer bc.DB.Close()
-
-			balance := 0 // 定义余额
-			UTXOs := UTXOSet.FindUTXO(string(w.Addr))
-
-			for _, out := range UTXOs {
-				balance += out.TX_value
+			// 通过主节点查询余额
+			balance, err := node.QueryBalance(string(w.Addr))
+			if err != nil {
+				fmt.Println(err)
+				return
 			}
 			fmt.Printf("Balance of '%s': %d\n", w.Addr, balance)
 		}
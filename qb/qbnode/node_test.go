@@ -0,0 +1,244 @@
+package qbnode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"qb/qbmempool"
+	"qb/qbstore"
+	"qb/qbutxo"
+	"qb/quantumbc"
+	"qblock"
+	"qbtx"
+	"qkdserv"
+	"strings"
+	"testing"
+)
+
+const (
+	addrC1 = "1CG9GcxF2BT1rjxwoMHSLtRP9RTCsSkRyH" // C1的钱包地址，创世区块中分配20
+	addrP1 = "195KpL1PxRzvVKxg33YYbWjgFqxFAbBit9" // P1的钱包地址
+)
+
+func TestMain(m *testing.M) {
+	os.Chdir("..") // 配置文件路径相对于qb目录
+	qkdserv.QKD_sign_random_matrix_pool = make(map[qkdserv.QKDSignMatrixIndex]qkdserv.QKDSignRandomsMatrix)
+	qkdserv.Node_name = "P1"
+	qbtx.N = 4
+	os.Exit(m.Run())
+}
+
+// newQueryServer，以内存账本启动只提供查询接口的主节点，并返回指向它的客户端节点
+func newQueryServer(t *testing.T) (*Node, *Node) {
+	genesis, err := qblock.LoadGenesisBlock(qblock.GENESIS_BLOCK_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := &Node{
+		Node_name: "P1",
+		Ledger:    quantumbc.InitBlockchain(qbstore.NewMemStore(), genesis),
+		Mempool:   qbmempool.NewMempool(qbmempool.ORDER_FEE),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/balance", primary.getBalance)
+	mux.HandleFunc("/history", primary.getHistory)
+	mux.HandleFunc("/utxo", primary.getUTXO)
+	mux.HandleFunc("/block", primary.getBlock)
+	mux.HandleFunc("/header", primary.getHeader)
+	mux.HandleFunc("/proof", primary.getProof)
+	server := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		server.Close()
+		primary.Ledger.DB.Close()
+	})
+	client := &Node{
+		Node_name:  "C1",
+		Primary:    "P1",
+		Node_table: map[string]string{"P1": strings.TrimPrefix(server.URL, "http://")},
+	}
+	return primary, client
+}
+
+func TestQuery(t *testing.T) {
+	fmt.Println("----------【Node】——balance, history and UTXO queries through the primary---------------------------------")
+	primary, client := newQueryServer(t)
+
+	balance, err := client.QueryBalance(addrC1)
+	if err != nil || balance != primary.Ledger.GetBalance(addrC1) || balance != 20 {
+		t.Fatalf("balance = %d, %v", balance, err)
+	}
+	events, total, err := client.QueryHistory(addrC1, 0, 10)
+	if err != nil || total != 1 || len(events) != 1 || events[0].Value != 20 || events[0].Spent {
+		t.Fatalf("history = %v, %d, %v", events, total, err)
+	}
+	outs, err := client.QueryUTXO(addrC1)
+	if err != nil || len(outs) != 1 {
+		t.Fatalf("utxo = %v, %v", outs, err)
+	}
+	acc, spendable := outs.FindSpendableOutputs(addrC1, 5)
+	if acc != 20 || len(spendable) != 1 {
+		t.Errorf("spendable outputs = %d, %v", acc, spendable)
+	}
+
+	if _, _, err = client.QueryHistory(addrC1, 0, 0); err == nil {
+		t.Error("invalid limit accepted")
+	}
+	if _, err = client.QueryBalance(""); err == nil {
+		t.Error("empty address accepted")
+	}
+}
+
+func TestQueryBlock(t *testing.T) {
+	fmt.Println("----------【Node】——recent blocks from a pruned primary--------------------------------------------------")
+	primary, client := newQueryServer(t)
+	for i := 0; i < 3; i++ { // 空区块即可，修剪只看高度
+		last := primary.Ledger.GetlastHeader()
+		if err := primary.Ledger.AddBlock(qblock.NewBlock(nil, last.Hash, last.Height+1, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := primary.Ledger.Prune(2); err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := client.QueryBlock(3)
+	if err != nil || block.Height != 3 || !bytes.Equal(block.Hash, primary.Ledger.GetlastHash()) {
+		t.Fatalf("recent block = %v, %v", block, err)
+	}
+	if _, err = client.QueryBlock(1); err == nil || !strings.Contains(err.Error(), "410") {
+		t.Errorf("pruned block: got %v, want 410", err)
+	}
+	if _, err = client.QueryBlock(4); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("block above the tip: got %v, want 404", err)
+	}
+	// 已修剪区块的区块头仍附带提议者签名
+	var reply HeaderReply
+	err = client.queryNode("P1", "/header", url.Values{"height": {"1"}}, &reply)
+	if err != nil || reply.Block_uss == nil || !bytes.Equal(reply.Block_uss.USS_message, reply.Hash) {
+		t.Errorf("header of a pruned block = %+v, %v", reply, err)
+	}
+}
+
+func TestQueryProof(t *testing.T) {
+	fmt.Println("----------【Node】——transaction proofs and their errors----------------------------------------------------")
+	primary, client := newQueryServer(t)
+	genesis, _ := primary.Ledger.GetBlockByHeight(0)
+	proof := func(txid []byte) (*qblock.TXProof, error) {
+		var p qblock.TXProof
+		err := client.queryNode("P1", "/proof", url.Values{"txid": {fmt.Sprintf("%x", txid)}}, &p)
+		return &p, err
+	}
+	if p, err := proof(genesis.Transactions[0].TX_id); err != nil || !p.Verify() {
+		t.Fatalf("proof of a genesis transaction: %v", err)
+	}
+
+	// 交易索引指向不含该交易的区块时返回404及原因，而不是空的证明
+	orphan := []byte("not in the block")
+	err := primary.Ledger.DB.Update(func(tx qbstore.Tx) error {
+		index := tx.Bucket("txindex")
+		return index.Put(orphan, index.Get(genesis.Transactions[0].TX_id))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = proof(orphan); err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "not in block 0") {
+		t.Errorf("transaction missing from its block: got %v, want 404 with the reason", err)
+	}
+}
+
+func TestConfirmBlockHash(t *testing.T) {
+	fmt.Println("----------【Node】——block hash of a proof confirmed by replicas other than the primary-------------------")
+	primary, client := newQueryServer(t)
+	last := primary.Ledger.GetlastHeader()
+	block := qblock.NewBlock(nil, last.Hash, last.Height+1, 0)
+	if err := primary.Ledger.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	// serve，以handler提供区块头查询，并加入客户端的节点索引表
+	serve := func(name string, handler http.HandlerFunc) {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+		client.Node_table[name] = strings.TrimPrefix(server.URL, "http://")
+	}
+	serve("P2", primary.getHeader) // 与主节点账本相同的节点
+	genesis, err := qblock.LoadGenesisBlock(qblock.GENESIS_BLOCK_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lagging := &Node{Ledger: quantumbc.InitBlockchain(qbstore.NewMemStore(), genesis)}
+	t.Cleanup(func() { lagging.Ledger.DB.Close() })
+	serve("P3", lagging.getHeader)                                        // 尚未收到该区块的节点
+	serve("P4", func(writer http.ResponseWriter, request *http.Request) { // 给出该区块hash但区块头被篡改的节点
+		header := *block.Header()
+		header.Merkle_root = []byte("forged root")
+		json.NewEncoder(writer).Encode(header)
+	})
+	members := []string{"P1", "P2", "P3", "P4"}
+
+	if err := client.ConfirmBlockHash(members, 1, block.Hash, 1); err != nil {
+		t.Errorf("one replica: %v", err)
+	}
+	if err := client.ConfirmBlockHash(members, 1, block.Hash, 2); !errors.Is(err, ErrHashUnconfirmed) {
+		t.Errorf("lagging and forged replicas: got %v, want %v", err, ErrHashUnconfirmed)
+	}
+	if err := lagging.Ledger.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ConfirmBlockHash(members, 1, block.Hash, 2); err != nil {
+		t.Errorf("two replicas: %v", err)
+	}
+	// 主节点自身不计入确认
+	if err := client.ConfirmBlockHash(members, 1, block.Hash, 3); !errors.Is(err, ErrHashUnconfirmed) {
+		t.Errorf("primary counted: got %v, want %v", err, ErrHashUnconfirmed)
+	}
+	if err := client.ConfirmBlockHash(members, 1, last.Hash, 1); !errors.Is(err, ErrHashUnconfirmed) {
+		t.Errorf("other block: got %v, want %v", err, ErrHashUnconfirmed)
+	}
+}
+
+func TestQuerySpendable(t *testing.T) {
+	fmt.Println("----------【Node】——back-to-back payments through the primary mempool----------------------------------")
+	primary, client := newQueryServer(t)
+	confirmed := &qbutxo.UTXOSet{Blockchain: primary.Ledger}
+
+	// send，以C1身份按主节点的交易池视图构造交易并提交到交易池
+	send := func(amount int) *qbtx.Transaction {
+		outs, err := client.QuerySpendable(addrC1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := qbutxo.TXRequest{From: addrC1, Payments: []qbutxo.Payment{{To: addrP1, Amount: amount}}, Fee: 1}
+		qkdserv.Node_name = "C1"
+		tx, err := qbutxo.BuildTransaction(req, "C1", outs)
+		qkdserv.Node_name = "P1"
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = primary.Mempool.Add(tx, confirmed, primary.nextBlock()); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	tx1 := send(5)
+	tx2 := send(3) // 第一笔未上链时即可发送，花费其找零
+	if string(tx2.TX_vin[0].Refer_tx_id) != string(tx1.TX_id) {
+		t.Errorf("second payment does not spend the unconfirmed change")
+	}
+
+	outs, err := client.QuerySpendable(addrC1)
+	if err != nil || len(outs) != 1 || outs[0].Value != 10 || !outs[0].Unconfirmed {
+		t.Errorf("spendable = %+v, %v", outs, err)
+	}
+	if outs, err = client.QueryUTXO(addrC1); err != nil || len(outs) != 1 || outs[0].Value != 20 || outs[0].Unconfirmed {
+		t.Errorf("confirmed = %+v, %v", outs, err)
+	}
+	if txs := primary.Mempool.Pending(); len(txs) != 2 || txs[0] != tx1 || txs[1] != tx2 {
+		t.Error("pending transactions are not in arrival order")
+	}
+}
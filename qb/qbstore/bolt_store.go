@@ -0,0 +1,111 @@
+package qbstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Open_timeout，等待数据库文件锁的最长时间：节点运行期间独占账本文件，离线命令超时后报错而不是一直等待
+var Open_timeout = 3 * time.Second
+
+// ErrInUse，账本文件被其他进程（如运行中的节点）占用
+var ErrInUse = errors.New("ledger is in use by another process, stop the node first")
+
+// boltStore，基于bolt数据库文件的存储
+type boltStore struct {
+	db *bolt.DB
+}
+
+// OpenBolt，打开bolt数据库文件，文件或所在目录不存在时创建
+// 参数：数据库文件路径
+// 返回值：存储Store，文件被占用超过Open_timeout时返回ErrInUse
+func OpenBolt(path string) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: Open_timeout}) // 0600，仅限本用户可读可写
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("%w: %s", ErrInUse, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &boltStore{db}, nil
+}
+
+// View，只读事务
+func (s *boltStore) View(fn func(tx Tx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+// Update，读写事务
+func (s *boltStore) Update(fn func(tx Tx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+// Close，关闭数据库文件
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltTx) Bucket(name string) Bucket {
+	b := t.tx.Bucket([]byte(name))
+	if b == nil {
+		return nil
+	}
+	return boltBucket{b}
+}
+
+func (t boltTx) CreateBucketIfNotExists(name string) (Bucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists([]byte(name))
+	if err != nil {
+		return nil, err
+	}
+	return boltBucket{b}, nil
+}
+
+func (t boltTx) DeleteBucket(name string) error {
+	err := t.tx.DeleteBucket([]byte(name))
+	if err == bolt.ErrBucketNotFound {
+		return nil
+	}
+	return err
+}
+
+type boltBucket struct {
+	b *bolt.Bucket
+}
+
+// Get，bolt返回的切片只在事务内有效，因此返回副本
+func (b boltBucket) Get(key []byte) []byte {
+	value := b.b.Get(key)
+	if value == nil {
+		return nil
+	}
+	return append([]byte{}, value...)
+}
+
+func (b boltBucket) Put(key, value []byte) error {
+	return b.b.Put(key, value)
+}
+
+func (b boltBucket) Delete(key []byte) error {
+	return b.b.Delete(key)
+}
+
+func (b boltBucket) Cursor() Cursor {
+	return b.b.Cursor()
+}
@@ -0,0 +1,198 @@
+package qbstore
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// 内存存储的错误
+var (
+	ErrReadOnly = errors.New("write in a read-only transaction") // 在只读事务中写入
+	ErrClosed   = errors.New("store is closed")                  // 存储已关闭
+)
+
+// memStore，内存存储，用于测试与模拟。读写事务在数据副本上执行，成功后整体替换，失败时丢弃；
+// 各bucket在事务中第一次写入时才复制，未写入的bucket与原数据共享
+type memStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+	closed  bool
+}
+
+// NewMemStore，创建空的内存存储
+// 参数：
+// 返回值：存储Store
+func NewMemStore() Store {
+	return &memStore{buckets: make(map[string]map[string][]byte)}
+}
+
+// View，只读事务
+func (s *memStore) View(fn func(tx Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return fn(&memTx{buckets: s.buckets})
+}
+
+// Update，读写事务：复制bucket名称表后执行，bucket在写入时复制，fn成功时替换原数据
+func (s *memStore) Update(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	buckets := make(map[string]map[string][]byte, len(s.buckets))
+	for name, b := range s.buckets {
+		buckets[name] = b
+	}
+	tx := &memTx{buckets: buckets, writable: true, owned: make(map[string]bool)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.buckets = buckets
+	return nil
+}
+
+// Close，关闭存储
+func (s *memStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+type memTx struct {
+	buckets  map[string]map[string][]byte
+	writable bool
+	owned    map[string]bool // 本事务中已复制或新建、可直接修改的bucket
+}
+
+func (t *memTx) Bucket(name string) Bucket {
+	if _, ok := t.buckets[name]; !ok {
+		return nil
+	}
+	return &memBucket{t, name}
+}
+
+func (t *memTx) CreateBucketIfNotExists(name string) (Bucket, error) {
+	if !t.writable {
+		return nil, ErrReadOnly
+	}
+	if _, ok := t.buckets[name]; !ok {
+		t.buckets[name] = make(map[string][]byte)
+		t.owned[name] = true
+	}
+	return t.Bucket(name), nil
+}
+
+func (t *memTx) DeleteBucket(name string) error {
+	if !t.writable {
+		return ErrReadOnly
+	}
+	delete(t.buckets, name)
+	delete(t.owned, name)
+	return nil
+}
+
+// own，第一次写入bucket时复制，之后在副本上修改，原数据不受影响
+func (t *memTx) own(name string) map[string][]byte {
+	if !t.owned[name] {
+		src := t.buckets[name]
+		copied := make(map[string][]byte, len(src))
+		for k, v := range src {
+			copied[k] = v // 值写入后不再修改，可共享
+		}
+		t.buckets[name] = copied
+		t.owned[name] = true
+	}
+	return t.buckets[name]
+}
+
+// memBucket，事务中bucket的句柄，每次访问时按名称查找，写入复制后的句柄仍读到最新数据
+type memBucket struct {
+	tx   *memTx
+	name string
+}
+
+func (b *memBucket) Get(key []byte) []byte {
+	value, ok := b.tx.buckets[b.name][string(key)]
+	if !ok {
+		return nil
+	}
+	return append([]byte{}, value...)
+}
+
+func (b *memBucket) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return ErrReadOnly
+	}
+	b.tx.own(b.name)[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (b *memBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return ErrReadOnly
+	}
+	if _, ok := b.tx.buckets[b.name][string(key)]; ok { // 不存在的key不触发复制
+		delete(b.tx.own(b.name), string(key))
+	}
+	return nil
+}
+
+// Cursor，创建游标时对key排序，遍历期间读取最新的值
+func (b *memBucket) Cursor() Cursor {
+	data := b.tx.buckets[b.name]
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return &memCursor{bucket: b, keys: keys, pos: -1}
+}
+
+type memCursor struct {
+	bucket *memBucket
+	keys   []string
+	pos    int
+}
+
+// at，返回当前位置的键值对，越界时返回nil
+func (c *memCursor) at() ([]byte, []byte) {
+	if c.pos < 0 || c.pos >= len(c.keys) {
+		return nil, nil
+	}
+	k := c.keys[c.pos]
+	return []byte(k), c.bucket.Get([]byte(k))
+}
+
+func (c *memCursor) First() ([]byte, []byte) {
+	c.pos = 0
+	return c.at()
+}
+
+func (c *memCursor) Last() ([]byte, []byte) {
+	c.pos = len(c.keys) - 1
+	return c.at()
+}
+
+func (c *memCursor) Next() ([]byte, []byte) {
+	c.pos++
+	return c.at()
+}
+
+func (c *memCursor) Prev() ([]byte, []byte) {
+	c.pos--
+	return c.at()
+}
+
+func (c *memCursor) Seek(seek []byte) ([]byte, []byte) {
+	c.pos = sort.Search(len(c.keys), func(i int) bool {
+		return bytes.Compare([]byte(c.keys[i]), seek) >= 0
+	})
+	return c.at()
+}
@@ -0,0 +1,34 @@
+// qbstore包，定义账本存储接口：区块、元数据、UTXO与各项索引均存放在命名bucket的键值对中，
+// 读写事务保证一批写入原子生效。提供bolt文件存储与内存存储两种实现
+package qbstore
+
+// Store，账本存储
+type Store interface {
+	View(fn func(tx Tx) error) error   // 只读事务
+	Update(fn func(tx Tx) error) error // 读写事务，fn返回错误时全部写入回滚，成功时原子生效
+	Close() error                      // 关闭存储
+}
+
+// Tx，存储事务
+type Tx interface {
+	Bucket(name string) Bucket                           // 获取bucket，不存在时返回nil
+	CreateBucketIfNotExists(name string) (Bucket, error) // 获取bucket，不存在时创建，只读事务中返回错误
+	DeleteBucket(name string) error                      // 删除bucket，不存在时不做处理
+}
+
+// Bucket，键值对集合，key按字节序排列
+type Bucket interface {
+	Get(key []byte) []byte       // 查询，不存在时返回nil
+	Put(key, value []byte) error // 写入
+	Delete(key []byte) error     // 删除，key不存在时不做处理
+	Cursor() Cursor              // 按key顺序遍历的游标
+}
+
+// Cursor，bucket游标，遍历结束时返回的key为nil
+type Cursor interface {
+	First() (key, value []byte)           // 第一个键值对
+	Last() (key, value []byte)            // 最后一个键值对
+	Next() (key, value []byte)            // 下一个键值对
+	Prev() (key, value []byte)            // 上一个键值对
+	Seek(seek []byte) (key, value []byte) // 第一个不小于seek的键值对
+}
@@ -0,0 +1,160 @@
+package qbstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testStore，两种存储实现共用的行为测试
+func testStore(t *testing.T, s Store) {
+	defer s.Close()
+	err := s.Update(func(tx Tx) error {
+		b, err := tx.CreateBucketIfNotExists("blocks")
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"b", "d", "a", "c"} {
+			if err = b.Put([]byte(k), []byte("v"+k)); err != nil {
+				return err
+			}
+		}
+		return b.Delete([]byte("d"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 写入出错时整批回滚
+	failed := errors.New("failed")
+	err = s.Update(func(tx Tx) error {
+		tx.Bucket("blocks").Put([]byte("e"), []byte("ve"))
+		tx.CreateBucketIfNotExists("other")
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("got %v, want %v", err, failed)
+	}
+
+	err = s.View(func(tx Tx) error {
+		if tx.Bucket("other") != nil {
+			t.Error("bucket of failed update exists")
+		}
+		b := tx.Bucket("blocks")
+		if !bytes.Equal(b.Get([]byte("a")), []byte("va")) || b.Get([]byte("d")) != nil || b.Get([]byte("e")) != nil {
+			t.Error("get returns wrong values")
+		}
+		if b.Put([]byte("f"), []byte("vf")) == nil {
+			t.Error("put in a read-only transaction succeeds")
+		}
+
+		// 游标按key顺序遍历
+		var keys string
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys += string(k)
+		}
+		if keys != "abc" {
+			t.Errorf("cursor order: got %s", keys)
+		}
+		if k, _ := c.Seek([]byte("bb")); string(k) != "c" {
+			t.Errorf("seek: got %s", k)
+		}
+		if k, _ := c.Prev(); string(k) != "b" {
+			t.Errorf("prev: got %s", k)
+		}
+		if k, _ := c.Seek([]byte("z")); k != nil {
+			t.Errorf("seek past the end: got %s", k)
+		}
+		if k, v := c.Last(); string(k) != "c" || string(v) != "vc" {
+			t.Errorf("last: got %s", k)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Update(func(tx Tx) error {
+		if err := tx.DeleteBucket("blocks"); err != nil {
+			return err
+		}
+		return tx.DeleteBucket("missing")
+	})
+	if err != nil {
+		t.Errorf("delete bucket: %v", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	fmt.Println("----------【Store】——bolt && memory-----------------------------------------------------------------------")
+	bolt, err := OpenBolt(t.TempDir() + "/data/blockchain.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, bolt)
+	testStore(t, NewMemStore())
+	fmt.Println("store success")
+}
+
+func TestBoltInUse(t *testing.T) {
+	fmt.Println("----------【Store】——bolt file locked by another open store----------------------------------------------")
+	path := t.TempDir() + "/blockchain.db"
+	s, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	timeout := Open_timeout
+	Open_timeout = 100 * time.Millisecond
+	defer func() { Open_timeout = timeout }()
+	if _, err = OpenBolt(path); !errors.Is(err, ErrInUse) {
+		t.Errorf("got %v, want %v", err, ErrInUse)
+	}
+}
+
+func TestMemStoreCopyOnWrite(t *testing.T) {
+	fmt.Println("----------【Store】——memory store copies only the buckets written in a transaction------------------------")
+	s := NewMemStore().(*memStore)
+	err := s.Update(func(tx Tx) error {
+		for _, name := range []string{"blocks", "utxo"} {
+			b, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			if err = b.Put([]byte("k"), []byte("v")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, utxo := s.buckets["blocks"], s.buckets["utxo"]
+	err = s.Update(func(tx Tx) error {
+		b := tx.Bucket("utxo")
+		if err := b.Put([]byte("k2"), []byte("v2")); err != nil {
+			return err
+		}
+		if !bytes.Equal(b.Get([]byte("k2")), []byte("v2")) || !bytes.Equal(tx.Bucket("utxo").Get([]byte("k")), []byte("v")) {
+			t.Error("written bucket does not read its own writes")
+		}
+		if utxo["k2"] != nil {
+			t.Error("write is visible before the transaction commits")
+		}
+		return tx.Bucket("blocks").Delete([]byte("missing"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.ValueOf(s.buckets["blocks"]).Pointer() != reflect.ValueOf(blocks).Pointer() {
+		t.Error("untouched bucket was copied")
+	}
+	if reflect.ValueOf(s.buckets["utxo"]).Pointer() == reflect.ValueOf(utxo).Pointer() || len(s.buckets["utxo"]) != 2 {
+		t.Error("written bucket was not copied")
+	}
+}
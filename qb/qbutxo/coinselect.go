@@ -0,0 +1,135 @@
+package qbutxo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// 分支定界搜索的最大尝试次数，超出后视为没有恰好相等的组合
+const MAX_BNB_TRIES = 100000
+
+// 选择输入时的错误
+var (
+	ErrInsufficientFunds = errors.New("not enough funds")                                     // 可用输出总额不足
+	ErrNoExactMatch      = errors.New("no combination of outputs matches the amount exactly") // 分支定界未找到恰好相等的组合
+	ErrUnknownSelector   = errors.New("unknown coin selection strategy")                      // 未知的选择策略名称
+)
+
+// CoinSelector，输入选择策略：从发送方的未花费输出中选出总额不小于target的一组输出
+type CoinSelector interface {
+	SelectCoins(outs AddressOutputs, target int) (AddressOutputs, error)
+}
+
+// LargestFirst，按金额从大到小选择，输入数最少
+type LargestFirst struct{}
+
+// SmallestFirst，按金额从小到大选择，优先合并零钱
+type SmallestFirst struct{}
+
+// BranchAndBound，分支定界搜索总额恰好等于target的组合，交易无需找零；
+// 找不到时使用Fallback，Fallback为nil时返回ErrNoExactMatch
+type BranchAndBound struct {
+	Fallback CoinSelector
+}
+
+// DefaultSelector，未指定策略时使用：优先恰好相等的组合，否则从大到小选择
+var DefaultSelector CoinSelector = BranchAndBound{Fallback: LargestFirst{}}
+
+// SelectorByName，由名称取得选择策略，供命令行使用
+// 参数：策略名称string，largest、smallest、bnb或空（默认策略）
+// 返回值：CoinSelector，error
+func SelectorByName(name string) (CoinSelector, error) {
+	switch name {
+	case "":
+		return DefaultSelector, nil
+	case "largest":
+		return LargestFirst{}, nil
+	case "smallest":
+		return SmallestFirst{}, nil
+	case "bnb":
+		return BranchAndBound{}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownSelector, name)
+}
+
+// SelectCoins，按金额从大到小累加直至满足target
+func (LargestFirst) SelectCoins(outs AddressOutputs, target int) (AddressOutputs, error) {
+	return accumulate(sortedOutputs(outs, true), target)
+}
+
+// SelectCoins，按金额从小到大累加直至满足target
+func (SmallestFirst) SelectCoins(outs AddressOutputs, target int) (AddressOutputs, error) {
+	return accumulate(sortedOutputs(outs, false), target)
+}
+
+// SelectCoins，深度优先搜索总额恰好为target的组合，输出按金额从大到小排列，
+// 当前总额超过target或加上剩余全部输出仍不足时剪枝
+func (s BranchAndBound) SelectCoins(outs AddressOutputs, target int) (AddressOutputs, error) {
+	sorted := sortedOutputs(outs, true)
+	remaining := make([]int, len(sorted)+1) // remaining[i]为第i个及之后输出的总额
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Value
+	}
+	if remaining[0] < target {
+		return nil, fmt.Errorf("%w: have %d, need %d", ErrInsufficientFunds, remaining[0], target)
+	}
+
+	var chosen []int
+	tries := 0
+	var search func(i, sum int) bool
+	search = func(i, sum int) bool {
+		if sum == target {
+			return true
+		}
+		tries++
+		if i == len(sorted) || sum > target || sum+remaining[i] < target || tries > MAX_BNB_TRIES {
+			return false
+		}
+		chosen = append(chosen, i) // 先尝试包含第i个输出
+		if search(i+1, sum+sorted[i].Value) {
+			return true
+		}
+		chosen = chosen[:len(chosen)-1]
+		return search(i+1, sum)
+	}
+	if search(0, 0) {
+		selected := make(AddressOutputs, len(chosen))
+		for k, i := range chosen {
+			selected[k] = sorted[i]
+		}
+		return selected, nil
+	}
+	if s.Fallback != nil {
+		return s.Fallback.SelectCoins(outs, target)
+	}
+	return nil, fmt.Errorf("%w: %d", ErrNoExactMatch, target)
+}
+
+// sortedOutputs，复制并按金额排序，金额相同时按交易ID与输出编号排序，保证结果确定
+func sortedOutputs(outs AddressOutputs, descending bool) AddressOutputs {
+	sorted := append(AddressOutputs(nil), outs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Value != sorted[j].Value {
+			return (sorted[i].Value > sorted[j].Value) == descending
+		}
+		if c := bytes.Compare(sorted[i].TX_id, sorted[j].TX_id); c != 0 {
+			return c < 0
+		}
+		return sorted[i].Index < sorted[j].Index
+	})
+	return sorted
+}
+
+// accumulate，按顺序累加输出直至总额不小于target
+func accumulate(outs AddressOutputs, target int) (AddressOutputs, error) {
+	sum := 0
+	for i, out := range outs {
+		sum += out.Value
+		if sum >= target {
+			return outs[:i+1], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: have %d, need %d", ErrInsufficientFunds, sum, target)
+}
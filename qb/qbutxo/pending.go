@@ -0,0 +1,90 @@
+package qbutxo
+
+import (
+	"fmt"
+	"qb/quantumbc"
+	"qbtx"
+)
+
+// PendingSource，提供已提交但尚未上链的交易，交易池与记录已发送交易的钱包均可实现
+type PendingSource interface {
+	Pending() []*qbtx.Transaction
+}
+
+// PendingTXs，钱包自行记录的已发送交易
+type PendingTXs []*qbtx.Transaction
+
+// Pending，返回记录的交易
+func (txs PendingTXs) Pending() []*qbtx.Transaction {
+	return txs
+}
+
+// PendingView，在已上链的未花费输出上叠加未上链交易：被未上链交易花费的输出视为已预留，不再选用；
+// 未上链交易付给该地址且尚未被花费、未设相对锁定的输出（如找零）标记为Unconfirmed后可继续花费，使钱包能连续发送多笔交易而不冲突
+type PendingView struct {
+	Confirmed OutputSource  // 已上链的未花费输出
+	Pending   PendingSource // 未上链的交易，按提交顺序排列
+}
+
+// SpendableOutputs，地址可花费的输出：未被预留的已上链输出在前，未上链的输出在后
+func (v *PendingView) SpendableOutputs(address string) (AddressOutputs, error) {
+	confirmed, err := v.Confirmed.SpendableOutputs(address)
+	if err != nil {
+		return nil, err
+	}
+	pending := v.Pending.Pending()
+	reserved := reservedOutpoints(pending)
+
+	var outs AddressOutputs
+	known := make(map[string]bool) // 已列出的输出，钱包记录的交易上链后其输出不重复列出
+	for _, out := range confirmed {
+		key := outpointKey(out.TX_id, out.Index)
+		known[key] = true
+		if !reserved[key] {
+			outs = append(outs, out)
+		}
+	}
+	for _, tx := range pending {
+		for i, out := range tx.TX_vout {
+			key := outpointKey(tx.TX_id, i)
+			if out.TX_dst != address || reserved[key] || known[key] || out.Lock_blocks > 0 { // 相对锁定的输出须上链后才开始计算
+				continue
+			}
+			known[key] = true
+			outs = append(outs, quantumbc.AddressUTXO{TX_id: tx.TX_id, Index: i, Value: out.TX_value, Unconfirmed: true, Asset: out.Asset})
+		}
+	}
+	return outs, nil
+}
+
+// Reserved，地址已上链的输出中被未上链交易花费的部分
+func (v *PendingView) Reserved(address string) (AddressOutputs, error) {
+	confirmed, err := v.Confirmed.SpendableOutputs(address)
+	if err != nil {
+		return nil, err
+	}
+	reserved := reservedOutpoints(v.Pending.Pending())
+	var outs AddressOutputs
+	for _, out := range confirmed {
+		if reserved[outpointKey(out.TX_id, out.Index)] {
+			outs = append(outs, out)
+		}
+	}
+	return outs, nil
+}
+
+// reservedOutpoints，未上链交易花费的全部输出
+func reservedOutpoints(txs []*qbtx.Transaction) map[string]bool {
+	reserved := make(map[string]bool)
+	for _, tx := range txs {
+		for _, vin := range tx.TX_vin {
+			reserved[outpointKey(vin.Refer_tx_id, vin.Refer_tx_id_index)] = true
+		}
+	}
+	return reserved
+}
+
+// outpointKey，输出定位键：交易ID:输出编号
+func outpointKey(txid []byte, index int) string {
+	return fmt.Sprintf("%x:%d", txid, index)
+}
@@ -1,16 +1,16 @@
 package qbutxo
 
 import (
+	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"qb/qbstore"
+	"qb/qbwallet"
 	"qb/quantumbc"
-	"qblock"
 	"qbtx"
 	"uss"
-
-	"github.com/boltdb/bolt"
 )
 
 const utxoBucket = "chainstate"
@@ -20,204 +20,343 @@ type UTXOSet struct {
 	Blockchain *quantumbc.Blockchain
 }
 
-// NewUTXOTransaction，创建普通交易
-func NewUTXOTransaction(from, to, nodeID string, amount int, UTXOSet *UTXOSet) *qbtx.Transaction {
-	// 需要组合输入项和输出项
-	var inputs []qbtx.TXInput
-	var outputs []qbtx.TXOutput
+// OutputSource，提供发送方的未花费输出：UTXOSet直接读取账本，客户端可用从节点查询到的AddressOutputs
+type OutputSource interface {
+	SpendableOutputs(address string) (AddressOutputs, error)
+}
 
-	// 查询最小utxo
-	acc, validOutputs := UTXOSet.FindSpendableOutputs(from, amount)
+// AddressOutputs，某一地址的未花费输出，通常由客户端向节点查询得到
+type AddressOutputs []quantumbc.AddressUTXO
 
-	if acc < amount { // 如果余额不足
-		fmt.Println("ERROR: Not enough funds")
-		os.Exit(1)
-	}
+// 构造交易时的错误
+var (
+	ErrNoRecipients  = errors.New("transaction has no recipients")                                    // 没有收款方
+	ErrInvalidAmount = errors.New("amounts must be positive, the fee and locks must not be negative") // 金额、手续费或锁定不合法
+	ErrInputNotFound = errors.New("input is not an unspent output of the sender")                     // 手动指定的输入不属于发送方或已花费
+	ErrNotScript     = errors.New("address is not the address of the locking script")                 // 发送方或收款地址不是锁定脚本导出的地址
+	ErrNoUnlocker    = errors.New("spending a locking script needs an unlocker")                      // 从脚本地址转出时没有给出解锁脚本
+)
+
+// Payment，一笔付款
+type Payment struct {
+	To     string // 收款地址
+	Amount int    // 金额
+}
+
+// Unlocker，为花费脚本输出的输入项生成解锁脚本，在交易的输入与输出确定后按输入项依次调用
+type Unlocker func(tx *qbtx.Transaction, in_id int) (qbtx.Script, error)
+
+// OutPoint，引用一个交易输出，用于手动指定输入
+type OutPoint struct {
+	TX_id []byte // 输出所在交易ID
+	Index int    // 输出编号
+}
+
+// TXRequest，构造交易的请求
+type TXRequest struct {
+	From     string       // 发送方地址，输入均属于该地址
+	Payments []Payment    // 收款方与金额，至少一项
+	Fee      int          // 手续费，不设输出，由区块提议者收取
+	Change   string       // 找零地址，为空时找零给发送方
+	Inputs   []OutPoint   // 手动指定的输入，非空时不做自动选择，须全部为发送方的未花费输出且总额足够
+	Selector CoinSelector // 自动选择输入的策略，为nil时使用DefaultSelector
+
+	Lock_time   int64 // 交易的锁定时间，小于qbtx.LOCK_TIME_THRESHOLD时为区块高度，否则为Unix时间，0表示不锁定
+	Lock_blocks int64 // 付款输出的相对锁定区块数，找零不锁定
+
+	Pay_script  qbtx.Script // 付款输出的锁定脚本，非空时付款到脚本导出的地址，收款地址为空或须为该地址；找零不加锁定脚本
+	Lock_script qbtx.Script // 从脚本地址转出时被花费输出的锁定脚本，From为空时取其导出的地址；交易不签名，由Unlock生成解锁脚本，找零到该地址时同样加锁定脚本
+	Unlock      Unlocker    // 生成各输入项的解锁脚本，Lock_script非空时必须给出
+
+	Asset string // 付款的资产编号，为空时为原生币；手续费总以原生币支付
+	Issue bool   // 发行交易：发送方须为创世区块记录的Asset发行方，付款为增发的资产，不需要该资产的输入
+}
 
-	// 构建输入项
-	for txid, outs := range validOutputs {
-		txID, err := hex.DecodeString(txid)
-		if err != nil {
-			log.Panic(err)
+// BuildTransaction，按请求选择输入、构造输出并以nodeID签名。输出依次为各笔付款与各资产的找零，某资产的输入总额恰好等于所需金额时不找零
+// 参数：交易请求TXRequest，签名节点名称string，未花费输出来源OutputSource
+// 返回值：已签名的交易*qbtx.Transaction（脚本交易带解锁脚本），error
+func BuildTransaction(req TXRequest, nodeID string, source OutputSource) (*qbtx.Transaction, error) {
+	if req.Lock_script != nil {
+		address := qbwallet.ScriptAddress(req.Lock_script)
+		if req.From == "" {
+			req.From = address
+		} else if req.From != address {
+			return nil, fmt.Errorf("%w: %s", ErrNotScript, req.From)
 		}
+		if req.Unlock == nil {
+			return nil, ErrNoUnlocker
+		}
+	}
+	if len(req.Payments) == 0 {
+		return nil, ErrNoRecipients
+	}
+	if req.Fee < 0 || req.Lock_time < 0 || req.Lock_blocks < 0 {
+		return nil, fmt.Errorf("%w: fee %d, lock time %d, lock blocks %d", ErrInvalidAmount, req.Fee, req.Lock_time, req.Lock_blocks)
+	}
+	if req.Asset != "" {
+		if err := qbtx.ValidateAssetID(req.Asset); err != nil {
+			return nil, err
+		}
+	} else if req.Issue {
+		return nil, fmt.Errorf("%w: issue needs an asset", qbtx.ErrAssetID)
+	}
+	if req.Pay_script != nil {
+		if err := req.Pay_script.Validate(); err != nil {
+			return nil, err
+		}
+		address := qbwallet.ScriptAddress(req.Pay_script)
+		req.Payments = append([]Payment(nil), req.Payments...) // 不修改调用者的付款列表
+		for i, payment := range req.Payments {
+			if payment.To == "" {
+				req.Payments[i].To = address
+			} else if payment.To != address {
+				return nil, fmt.Errorf("%w: %s", ErrNotScript, payment.To)
+			}
+		}
+	}
+	amount := 0 // 付款总额，以req.Asset计
+	for _, payment := range req.Payments {
+		if payment.Amount <= 0 {
+			return nil, fmt.Errorf("%w: %d to %s", ErrInvalidAmount, payment.Amount, payment.To)
+		}
+		amount += payment.Amount
+	}
+	target := map[string]int{"": req.Fee} // 各资产的输入须覆盖的总额，手续费总以原生币支付
+	if !req.Issue {                       // 发行交易增发的资产不需要输入
+		target[req.Asset] += amount
+	}
 
-		for _, out := range outs {
-			input := qbtx.TXInput{
-				Refer_tx_id:       txID,
-				Refer_tx_id_index: out,
-				TX_uss_sign:       uss.USSToeplitzHashSignMsg{},
-				TX_src:            from,
+	outs, err := source.SpendableOutputs(req.From)
+	if err != nil {
+		return nil, err
+	}
+	var selected AddressOutputs
+	if len(req.Inputs) > 0 {
+		if selected, err = outs.pick(req.Inputs); err != nil {
+			return nil, err
+		}
+	} else {
+		selector := req.Selector
+		if selector == nil {
+			selector = DefaultSelector
+		}
+		if req.Asset != "" && !req.Issue {
+			tokens, err := selector.SelectCoins(outs.OfAsset(req.Asset), target[req.Asset])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", req.Asset, err)
+			}
+			selected = append(selected, tokens...)
+		}
+		if target[""] > 0 {
+			coins, err := selector.SelectCoins(outs.OfAsset(""), target[""])
+			if err != nil {
+				return nil, err
 			}
-			inputs = append(inputs, input)
+			selected = append(selected, coins...)
+		} else if len(selected) == 0 { // 不付手续费的发行交易仍须以发行方的一个输入授权
+			if selected = outs.OfAsset(""); len(selected) == 0 {
+				return nil, fmt.Errorf("%w: issue needs an input of the issuer", ErrInsufficientFunds)
+			}
+			selected = selected[:1]
+		}
+	}
+	acc := make(map[string]int) // 各资产已选输入的总额
+	var assets []string         // 已选输入的资产，按首次出现的顺序
+	for _, out := range selected {
+		if _, ok := acc[out.Asset]; !ok {
+			assets = append(assets, out.Asset)
+		}
+		acc[out.Asset] += out.Value
+	}
+	for asset, need := range target {
+		if acc[asset] < need {
+			return nil, fmt.Errorf("%w: have %d, need %d %s", ErrInsufficientFunds, acc[asset], need, qbtx.AssetName(asset))
 		}
 	}
 
-	// 构建输出项
-	outputs = append(outputs, qbtx.NewTXOutput(amount, to))
-	if acc > amount { // 需要找零
-		outputs = append(outputs, qbtx.NewTXOutput(acc-amount, from)) // 需要找零
+	// 构建输入项与输出项
+	var inputs []qbtx.TXInput
+	for _, out := range selected {
+		inputs = append(inputs, qbtx.TXInput{
+			Refer_tx_id:       out.TX_id,
+			Refer_tx_id_index: out.Index,
+			TX_uss_sign:       uss.USSToeplitzHashSignMsg{},
+			TX_src:            req.From,
+		})
+	}
+	var outputs []qbtx.TXOutput
+	for _, payment := range req.Payments {
+		output := qbtx.NewTXOutput(payment.Amount, payment.To)
+		output.Asset = req.Asset
+		output.Lock_blocks = req.Lock_blocks
+		output.Lock_script = req.Pay_script
+		outputs = append(outputs, output)
+	}
+	change := req.Change
+	if change == "" {
+		change = req.From
+	}
+	for _, asset := range assets { // 各资产分别找零
+		if acc[asset] > target[asset] {
+			output := qbtx.NewTXOutput(acc[asset]-target[asset], change)
+			output.Asset = asset
+			if change == req.From {
+				output.Lock_script = req.Lock_script // 找零回脚本地址时仍由原锁定脚本花费
+			}
+			outputs = append(outputs, output)
+		}
 	}
 
 	// 交易生成
 	tx := &qbtx.Transaction{
-		TX_id:   nil,
-		TX_vin:  inputs,
-		TX_vout: outputs,
+		TX_id:     nil,
+		TX_vin:    inputs,
+		TX_vout:   outputs,
+		Lock_time: req.Lock_time,
+	}
+	if req.Issue {
+		tx.Issue_asset = req.Asset
+	}
+	if req.Lock_script != nil { // 解锁脚本中的签名覆盖修剪后的交易，各输入项互不影响
+		for in_id := range tx.TX_vin {
+			unlock, err := req.Unlock(tx, in_id)
+			if err != nil {
+				return nil, err
+			}
+			tx.TX_vin[in_id].Unlock_script = unlock
+		}
+	} else {
+		tx.USSTransactionSign(nodeID) // 输入项签名
 	}
-	tx.USSTransactionSign(nodeID) // 输入项签名
 	tx.TX_id = tx.SetID()
-	return tx
+	return tx, nil
 }
 
-// FindSpendableOutputs，获取部分满足交易的utxo
-//
-// 返回值：余额int，可使用/未花费的交易map[string][]int
-func (u *UTXOSet) FindSpendableOutputs(address string, amount int) (int, map[string][]int) {
-	unspentOutputs := make(map[string][]int) // 可使用交易
-	accumulated := 0                         // 记录余额
-	db := u.Blockchain.DB
-
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket)) // 获取bucket
-		c := b.Cursor()
-
-		for k, v := c.First(); k != nil; k, v = c.Next() { // 遍历key
-			txID := hex.EncodeToString(k)
-			outs := qbtx.DeserializeOutputs(v)
+// NewUTXOTransaction，创建普通交易，以默认策略选择输入，输入总额超出转账金额与手续费的部分找零给发送方
+// 参数：发送方地址，收款地址，签名节点名称，金额，手续费，未花费输出来源
+// 返回值：已签名的交易*qbtx.Transaction，余额不足等情况返回error
+func NewUTXOTransaction(from, to, nodeID string, amount, fee int, source OutputSource) (*qbtx.Transaction, error) {
+	req := TXRequest{From: from, Payments: []Payment{{to, amount}}, Fee: fee}
+	return BuildTransaction(req, nodeID, source)
+}
 
-			for outIdx, out := range outs.Outputs {
-				if address == out.TX_dst && accumulated < amount {
-					accumulated += out.TX_value
-					unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
-				}
-			}
+// OfAsset，筛选某一资产的输出
+// 参数：资产编号string，原生币为空
+// 返回值：该资产的输出AddressOutputs
+func (outs AddressOutputs) OfAsset(asset string) AddressOutputs {
+	var filtered AddressOutputs
+	for _, out := range outs {
+		if out.Asset == asset {
+			filtered = append(filtered, out)
 		}
-
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
 	}
-
-	return accumulated, unspentOutputs
+	return filtered
 }
 
-// Reindex,更新UTXO
-func (u *UTXOSet) Reindex() {
-	db := u.Blockchain.DB
-	bucketName := []byte(utxoBucket)
+// SpendableOutputs，AddressOutputs本身即为该地址的未花费输出
+func (outs AddressOutputs) SpendableOutputs(address string) (AddressOutputs, error) {
+	return outs, nil
+}
 
-	err := db.Update(func(tx *bolt.Tx) error { // 更新数据库
-		err := tx.DeleteBucket(bucketName) // 删除bucket
-		if err != nil && err != bolt.ErrBucketNotFound {
-			log.Panic(err)
+// pick，按引用取出手动指定的输入，重复引用或引用不在outs中时返回ErrInputNotFound
+func (outs AddressOutputs) pick(points []OutPoint) (AddressOutputs, error) {
+	var picked AddressOutputs
+	used := make(map[string]bool)
+	for _, point := range points {
+		key := outpointKey(point.TX_id, point.Index)
+		if used[key] {
+			return nil, fmt.Errorf("%w: %s is referenced twice", ErrInputNotFound, key)
 		}
-
-		_, err = tx.CreateBucket(bucketName) // 创建bucket
-		if err != nil {
-			log.Panic(err)
+		used[key] = true
+		found := false
+		for _, out := range outs {
+			if bytes.Equal(out.TX_id, point.TX_id) && out.Index == point.Index {
+				picked = append(picked, out)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrInputNotFound, key)
 		}
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
 	}
+	return picked, nil
+}
 
-	UTXO := u.Blockchain.FindUTXO() // 查找未花费交易
+// GetUTXO，查询未花费输出，使UTXOSet可作为校验视图
+// 参数：交易ID[]byte，输出编号int
+// 返回值：输出项，是否存在且未花费bool
+func (u *UTXOSet) GetUTXO(txid []byte, index int) (qbtx.TXOutput, bool) {
+	return u.Blockchain.GetUTXO(txid, index)
+}
 
-	_ = db.Update(func(tx *bolt.Tx) error { // 更新数据库
-		b := tx.Bucket(bucketName) // 获取已有bucket
+// UTXOHeight，查询交易的未花费输出所在区块的高度
+func (u *UTXOSet) UTXOHeight(txid []byte) (int64, bool) {
+	return u.Blockchain.UTXOHeight(txid)
+}
 
-		for txID, outs := range UTXO { // 遍历未花费交易并存入数据库
-			key, err := hex.DecodeString(txID)
-			if err != nil {
-				log.Panic(err)
-			}
+// HasTransaction，查询交易是否已上链
+func (u *UTXOSet) HasTransaction(txid []byte) bool {
+	return u.Blockchain.HasTransaction(txid)
+}
 
-			err = b.Put(key, outs.SerializeOutputs()) // 存入数据库，key：txID，value:TXOutputs
-			if err != nil {
-				log.Panic(err)
-			}
+// SpendableOutputs，通过地址索引读取该地址在账本中的未花费输出，相对锁定在下一区块处仍未到期的输出不列出
+func (u *UTXOSet) SpendableOutputs(address string) (AddressOutputs, error) {
+	next := u.Blockchain.GetlastHeight() + 1
+	var outs AddressOutputs
+	for _, utxo := range u.Blockchain.GetAddressUTXO(address) {
+		out, _ := u.Blockchain.GetUTXO(utxo.TX_id, utxo.Index)
+		if confirmed, _ := u.Blockchain.UTXOHeight(utxo.TX_id); out.SpendableAt(confirmed, next) {
+			outs = append(outs, utxo)
 		}
-		return nil
-	})
+	}
+	return outs, nil
 }
 
-// Update updates the UTXO set with transactions from the Block
-// The Block is considered to be the tip of a blockchain
-func (u *UTXOSet) Update(block *qblock.Block) {
-	db := u.Blockchain.DB
-
-	err := db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-
-		for _, tx := range block.Transactions {
-			if !tx.IsReserveTX() {
-				for _, vin := range tx.TX_vin {
-					updatedOuts := qbtx.TXOutputs{}
-					outsBytes := b.Get(vin.Refer_tx_id)
-					outs := qbtx.DeserializeOutputs(outsBytes)
-
-					for outIdx, out := range outs.Outputs {
-						if outIdx != vin.Refer_tx_id_index {
-							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
-						}
-					}
-
-					if len(updatedOuts.Outputs) == 0 {
-						err := b.Delete(vin.Refer_tx_id)
-						if err != nil {
-							log.Panic(err)
-						}
-					} else {
-						err := b.Put(vin.Refer_tx_id, updatedOuts.SerializeOutputs())
-						if err != nil {
-							log.Panic(err)
-						}
-					}
-
-				}
-			}
+// FindSpendableOutputs，获取部分满足交易的utxo，通过地址索引只读取该地址的未花费输出
+//
+// 返回值：余额int，可使用/未花费的交易map[string][]int
+func (u *UTXOSet) FindSpendableOutputs(address string, amount int) (int, map[string][]int) {
+	return AddressOutputs(u.Blockchain.GetAddressUTXO(address)).FindSpendableOutputs(address, amount)
+}
 
-			newOutputs := qbtx.TXOutputs{}
-			for _, out := range tx.TX_vout {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
-			}
+// FindSpendableOutputs，按顺序累加未花费输出直至满足金额，outs须均属于address
+//
+// 返回值：余额int，可使用/未花费的交易map[string][]int
+func (outs AddressOutputs) FindSpendableOutputs(address string, amount int) (int, map[string][]int) {
+	unspentOutputs := make(map[string][]int) // 可使用交易
+	accumulated := 0                         // 记录余额
 
-			err := b.Put(tx.TX_id, newOutputs.SerializeOutputs())
-			if err != nil {
-				log.Panic(err)
-			}
+	for _, out := range outs {
+		if accumulated >= amount {
+			break
 		}
-
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
+		txID := hex.EncodeToString(out.TX_id)
+		accumulated += out.Value
+		unspentOutputs[txID] = append(unspentOutputs[txID], out.Index)
 	}
+
+	return accumulated, unspentOutputs
 }
 
-// FindUTXO，返回所有用户未使用的交易输出
-func (u *UTXOSet) FindUTXO(address string) []qbtx.TXOutput {
-	var UTXOs []qbtx.TXOutput
-	db := u.Blockchain.DB
+// Reindex,修复用：遍历全链重建UTXO集合与地址索引。区块连接时UTXO已由Blockchain.AddBlock增量更新
+func (u *UTXOSet) Reindex() error {
+	return u.Blockchain.ReindexUTXO()
+}
 
-	err := db.View(func(tx *bolt.Tx) error { // 查看账本，启动一个只读事务
-		b := tx.Bucket([]byte(utxoBucket)) // 获取bucket
-		c := b.Cursor()                    //要遍历 key，我们将使用一个 Cursor
+// Check，一致性检查：比较增量维护的UTXO集合与全量重建的结果
+func (u *UTXOSet) Check() error {
+	return u.Blockchain.CheckUTXO()
+}
 
-		for k, v := c.First(); k != nil; k, v = c.Next() { // 遍历
-			outs := qbtx.DeserializeOutputs(v) // 反序列化交易输出
-			for _, out := range outs.Outputs {
-				if address == out.TX_dst {
-					UTXOs = append(UTXOs, out) // 获取所有交易输出项信息
-				}
-			}
+// FindUTXO，返回所有用户未使用的交易输出，通过地址索引只读取该地址的未花费输出。
+// 返回UTXO集合中保存的完整输出，包括相对锁定与锁定脚本
+func (u *UTXOSet) FindUTXO(address string) []qbtx.TXOutput {
+	var UTXOs []qbtx.TXOutput
+	for _, utxo := range u.Blockchain.GetAddressUTXO(address) {
+		if out, ok := u.Blockchain.GetUTXO(utxo.TX_id, utxo.Index); ok {
+			UTXOs = append(UTXOs, out)
 		}
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
 	}
 	return UTXOs
 }
@@ -227,8 +366,8 @@ func (u *UTXOSet) CountTransactions() int {
 	db := u.Blockchain.DB
 	counter := 0
 
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
+	err := db.View(func(tx qbstore.Tx) error {
+		b := tx.Bucket(utxoBucket)
 		c := b.Cursor()
 
 		for k, _ := c.First(); k != nil; k, _ = c.Next() {
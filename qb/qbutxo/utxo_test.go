@@ -0,0 +1,298 @@
+package qbutxo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"qb/qbstore"
+	"qb/qbwallet"
+	"qb/quantumbc"
+	"qblock"
+	"qbtx"
+	"qkdserv"
+	"testing"
+)
+
+const (
+	addrC1 = "1CG9GcxF2BT1rjxwoMHSLtRP9RTCsSkRyH" // C1的钱包地址
+	addrP1 = "195KpL1PxRzvVKxg33YYbWjgFqxFAbBit9" // P1的钱包地址
+)
+
+func TestMain(m *testing.M) {
+	os.Chdir("..") // 配置文件路径相对于qb目录
+	qkdserv.QKD_sign_random_matrix_pool = make(map[qkdserv.QKDSignMatrixIndex]qkdserv.QKDSignRandomsMatrix)
+	qkdserv.Node_name = "C1"
+	qbtx.N = 4
+	os.Exit(m.Run())
+}
+
+// testOutputs，C1的未花费输出，金额分别为values
+func testOutputs(values ...int) AddressOutputs {
+	var outs AddressOutputs
+	for i, value := range values {
+		outs = append(outs, quantumbc.AddressUTXO{TX_id: []byte{byte(i + 1)}, Index: i, Value: value})
+	}
+	return outs
+}
+
+// valuesOf，选出输出的金额
+func valuesOf(outs AddressOutputs) []int {
+	var values []int
+	for _, out := range outs {
+		values = append(values, out.Value)
+	}
+	return values
+}
+
+func TestCoinSelection(t *testing.T) {
+	fmt.Println("----------【UTXO】——coin selection strategies----------------------------------------------------------")
+	outs := testOutputs(5, 1, 8, 3, 2)
+	cases := []struct {
+		selector CoinSelector
+		target   int
+		want     string
+	}{
+		{LargestFirst{}, 9, "[8 5]"},
+		{SmallestFirst{}, 4, "[1 2 3]"},
+		{BranchAndBound{}, 10, "[8 2]"},
+		{BranchAndBound{}, 19, "[8 5 3 2 1]"},
+		{DefaultSelector, 9, "[8 1]"},
+	}
+	for _, c := range cases {
+		selected, err := c.selector.SelectCoins(outs, c.target)
+		if got := fmt.Sprint(valuesOf(selected)); err != nil || got != c.want {
+			t.Errorf("%T(%d) = %s, %v; want %s", c.selector, c.target, got, err, c.want)
+		}
+	}
+
+	// 没有恰好相等的组合时，BranchAndBound按Fallback选择
+	if _, err := (BranchAndBound{}).SelectCoins(testOutputs(4, 6), 5); !errors.Is(err, ErrNoExactMatch) {
+		t.Errorf("got %v, want %v", err, ErrNoExactMatch)
+	}
+	if selected, err := DefaultSelector.SelectCoins(testOutputs(4, 6), 5); err != nil || fmt.Sprint(valuesOf(selected)) != "[6]" {
+		t.Errorf("fallback selected %v, %v", valuesOf(selected), err)
+	}
+	for _, selector := range []CoinSelector{LargestFirst{}, SmallestFirst{}, BranchAndBound{}, DefaultSelector} {
+		if _, err := selector.SelectCoins(outs, 20); !errors.Is(err, ErrInsufficientFunds) {
+			t.Errorf("%T: got %v, want %v", selector, err, ErrInsufficientFunds)
+		}
+	}
+	if _, err := SelectorByName("random"); !errors.Is(err, ErrUnknownSelector) {
+		t.Errorf("got %v, want %v", err, ErrUnknownSelector)
+	}
+}
+
+func TestBuildTransaction(t *testing.T) {
+	fmt.Println("----------【UTXO】——multiple recipients, change address and manual inputs-------------------------------")
+	outs := testOutputs(5, 1, 8, 3, 2)
+
+	// 两个收款方，找零到指定地址
+	req := TXRequest{
+		From:     addrC1,
+		Payments: []Payment{{addrP1, 4}, {addrC1, 2}},
+		Fee:      1,
+		Change:   addrP1,
+		Selector: LargestFirst{},
+	}
+	tx, err := BuildTransaction(req, "C1", outs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TX_vin) != 1 || tx.TX_vin[0].Refer_tx_id_index != 2 || len(tx.TX_vout) != 3 {
+		t.Fatalf("unexpected transaction %+v", tx)
+	}
+	if tx.TX_vout[0].TX_value != 4 || tx.TX_vout[1].TX_value != 2 || tx.TX_vout[2].TX_value != 1 || tx.TX_vout[2].TX_dst != addrP1 {
+		t.Errorf("unexpected outputs %+v", tx.TX_vout)
+	}
+	qkdserv.Node_name = "P1" // 签名者不能验证自己的签名，以P1身份验证
+	if errs := tx.VerifyUSSTransactionSign(); len(errs) != 0 {
+		t.Errorf("signature: %v", errs)
+	}
+	qkdserv.Node_name = "C1"
+
+	// 恰好相等时不找零
+	req = TXRequest{From: addrC1, Payments: []Payment{{addrP1, 9}}, Fee: 1}
+	if tx, err = BuildTransaction(req, "C1", outs); err != nil || len(tx.TX_vout) != 1 {
+		t.Errorf("exact match has change: %v, %v", tx, err)
+	}
+
+	// 手动指定输入
+	req.Inputs = []OutPoint{{outs[0].TX_id, outs[0].Index}, {outs[4].TX_id, outs[4].Index}}
+	if _, err = BuildTransaction(req, "C1", outs); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want %v", err, ErrInsufficientFunds)
+	}
+	req.Inputs = append(req.Inputs, OutPoint{outs[3].TX_id, outs[3].Index})
+	if tx, err = BuildTransaction(req, "C1", outs); err != nil || len(tx.TX_vin) != 3 || len(tx.TX_vout) != 1 {
+		t.Errorf("manual inputs: %v, %v", tx, err)
+	}
+	req.Inputs = append(req.Inputs, req.Inputs[0])
+	if _, err = BuildTransaction(req, "C1", outs); !errors.Is(err, ErrInputNotFound) {
+		t.Errorf("got %v, want %v", err, ErrInputNotFound)
+	}
+	req.Inputs = []OutPoint{{[]byte("unknown"), 0}}
+	if _, err = BuildTransaction(req, "C1", outs); !errors.Is(err, ErrInputNotFound) {
+		t.Errorf("got %v, want %v", err, ErrInputNotFound)
+	}
+
+	// 请求不合法或余额不足时返回错误，不退出进程
+	invalid := []TXRequest{
+		{From: addrC1, Fee: 1},
+		{From: addrC1, Payments: []Payment{{addrP1, 0}}},
+		{From: addrC1, Payments: []Payment{{addrP1, 1}}, Fee: -1},
+	}
+	for _, req := range invalid {
+		if _, err = BuildTransaction(req, "C1", outs); err == nil {
+			t.Errorf("invalid request %+v accepted", req)
+		}
+	}
+	if _, err = NewUTXOTransaction(addrC1, addrP1, "C1", 19, 1, outs); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want %v", err, ErrInsufficientFunds)
+	}
+
+	// 付款到锁定脚本导出的地址，找零不加脚本；从脚本地址转出时由Unlock生成解锁脚本，不做普通签名
+	script := qbtx.PayToAddressScript(addrP1)
+	req = TXRequest{From: addrC1, Payments: []Payment{{"", 6}}, Fee: 1, Selector: LargestFirst{}, Pay_script: script}
+	if tx, err = BuildTransaction(req, "C1", outs); err != nil || len(tx.TX_vout) != 2 || tx.TX_vout[0].TX_dst != qbwallet.ScriptAddress(script) ||
+		!bytes.Equal(tx.TX_vout[0].Lock_script, script) || tx.TX_vout[1].Lock_script != nil || req.Payments[0].To != "" {
+		t.Errorf("pay to script: %+v, %v", tx, err)
+	}
+	req.Payments = []Payment{{addrP1, 4}}
+	if _, err = BuildTransaction(req, "C1", outs); !errors.Is(err, ErrNotScript) {
+		t.Errorf("got %v, want %v", err, ErrNotScript)
+	}
+	unlock := func(tx *qbtx.Transaction, in_id int) (qbtx.Script, error) {
+		return qbtx.Script{}.AddInt(int64(in_id)), nil
+	}
+	req = TXRequest{Payments: []Payment{{addrP1, 9}}, Fee: 1, Lock_script: script, Unlock: unlock}
+	if tx, err = BuildTransaction(req, "C1", outs); err != nil || tx.TX_vin[0].TX_src != qbwallet.ScriptAddress(script) ||
+		tx.TX_vin[0].Unlock_script == nil || tx.TX_vin[0].TX_uss_sign.USS_signature != nil {
+		t.Errorf("spend script: %+v, %v", tx, err)
+	}
+	req.Unlock = nil
+	if _, err = BuildTransaction(req, "C1", outs); !errors.Is(err, ErrNoUnlocker) {
+		t.Errorf("got %v, want %v", err, ErrNoUnlocker)
+	}
+	// 找零回脚本地址时加原锁定脚本，否则无人能够花费
+	req = TXRequest{Payments: []Payment{{addrP1, 4}}, Fee: 1, Selector: LargestFirst{}, Lock_script: script, Unlock: unlock}
+	if tx, err = BuildTransaction(req, "C1", outs); err != nil || len(tx.TX_vout) != 2 ||
+		tx.TX_vout[1].TX_dst != qbwallet.ScriptAddress(script) || !bytes.Equal(tx.TX_vout[1].Lock_script, script) {
+		t.Errorf("change to script: %+v, %v", tx, err)
+	}
+
+	// 资产转账：付款与找零按资产分别计算，手续费以原生币支付
+	tokens := append(AddressOutputs{}, outs...)
+	tokens = append(tokens,
+		quantumbc.AddressUTXO{TX_id: []byte("bond"), Index: 0, Value: 30, Asset: "BOND"},
+		quantumbc.AddressUTXO{TX_id: []byte("bond"), Index: 1, Value: 20, Asset: "BOND"},
+	)
+	req = TXRequest{From: addrC1, Payments: []Payment{{addrP1, 25}}, Fee: 1, Selector: LargestFirst{}, Asset: "BOND"}
+	if tx, err = BuildTransaction(req, "C1", tokens); err != nil || len(tx.TX_vin) != 2 || len(tx.TX_vout) != 3 {
+		t.Fatalf("asset transfer: %+v, %v", tx, err)
+	}
+	if !tx.TX_vout[0].Equal(qbtx.TXOutput{TX_value: 25, TX_dst: addrP1, Asset: "BOND"}) ||
+		!tx.TX_vout[1].Equal(qbtx.TXOutput{TX_value: 5, TX_dst: addrC1, Asset: "BOND"}) ||
+		!tx.TX_vout[2].Equal(qbtx.TXOutput{TX_value: 7, TX_dst: addrC1}) {
+		t.Errorf("asset outputs %+v", tx.TX_vout)
+	}
+	req.Payments = []Payment{{addrP1, 51}}
+	if _, err = BuildTransaction(req, "C1", tokens); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want %v", err, ErrInsufficientFunds)
+	}
+
+	// 发行：不需要该资产的输入，以发送方的一个原生币输入授权
+	req = TXRequest{From: addrC1, Payments: []Payment{{addrP1, 100}}, Asset: "BOND", Issue: true}
+	if tx, err = BuildTransaction(req, "C1", tokens); err != nil || tx.Issue_asset != "BOND" || len(tx.TX_vin) != 1 ||
+		!tx.TX_vout[0].Equal(qbtx.TXOutput{TX_value: 100, TX_dst: addrP1, Asset: "BOND"}) || tx.TX_vout[1].Asset != "" {
+		t.Errorf("issue: %+v, %v", tx, err)
+	}
+	if _, err = BuildTransaction(req, "C1", tokens.OfAsset("BOND")); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want %v", err, ErrInsufficientFunds)
+	}
+	for _, req := range []TXRequest{
+		{From: addrC1, Payments: []Payment{{addrP1, 1}}, Issue: true},
+		{From: addrC1, Payments: []Payment{{addrP1, 1}}, Asset: "bond"},
+	} {
+		if _, err = BuildTransaction(req, "C1", tokens); !errors.Is(err, qbtx.ErrAssetID) {
+			t.Errorf("got %v, want %v", err, qbtx.ErrAssetID)
+		}
+	}
+}
+
+func TestPendingView(t *testing.T) {
+	fmt.Println("----------【UTXO】——reserved outputs and unconfirmed change of pending transactions---------------------")
+	confirmed := AddressOutputs{
+		{TX_id: []byte("a"), Index: 0, Value: 10},
+		{TX_id: []byte("b"), Index: 0, Value: 5},
+	}
+	var pending PendingTXs
+	view := &PendingView{Confirmed: confirmed, Pending: &pending}
+
+	// 第一笔交易花费10，找零6
+	req := TXRequest{From: addrC1, Payments: []Payment{{addrP1, 4}}, Selector: LargestFirst{}}
+	tx1, err := BuildTransaction(req, "C1", view)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending = append(pending, tx1)
+	outs, _ := view.SpendableOutputs(addrC1)
+	if fmt.Sprint(valuesOf(outs)) != "[5 6]" || outs[0].Unconfirmed || !outs[1].Unconfirmed {
+		t.Fatalf("spendable after one payment: %+v", outs)
+	}
+
+	// 第二笔交易在第一笔上链前花费其找零，不与之冲突
+	req.Payments = []Payment{{addrP1, 9}}
+	tx2, err := BuildTransaction(req, "C1", view)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vin := range tx2.TX_vin {
+		for _, prev := range tx1.TX_vin {
+			if string(vin.Refer_tx_id) == string(prev.Refer_tx_id) && vin.Refer_tx_id_index == prev.Refer_tx_id_index {
+				t.Fatal("second payment spends an output reserved by the first")
+			}
+		}
+	}
+	pending = append(pending, tx2)
+	outs, _ = view.SpendableOutputs(addrC1)
+	if fmt.Sprint(valuesOf(outs)) != "[2]" || !outs[0].Unconfirmed {
+		t.Errorf("spendable after two payments: %+v", outs)
+	}
+	if reserved, _ := view.Reserved(addrC1); len(reserved) != 2 {
+		t.Errorf("reserved = %+v", reserved)
+	}
+	if _, err = BuildTransaction(req, "C1", view); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want %v", err, ErrInsufficientFunds)
+	}
+}
+
+func TestFindUTXO(t *testing.T) {
+	fmt.Println("----------【UTXO】——FindUTXO returns the stored outputs with their locks--------------------------------------")
+	genesis, err := qblock.LoadGenesisBlock(qblock.GENESIS_BLOCK_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &UTXOSet{quantumbc.InitBlockchain(qbstore.NewMemStore(), genesis)}
+	script := qbtx.PayToAddressScript(addrP1)
+
+	// C1向P1付款4，输出相对锁定2个区块；再向P1的脚本地址付款3
+	for _, req := range []TXRequest{
+		{From: addrC1, Payments: []Payment{{addrP1, 4}}, Lock_blocks: 2},
+		{From: addrC1, Payments: []Payment{{"", 3}}, Pay_script: script},
+	} {
+		tx, err := BuildTransaction(req, "C1", u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := u.Blockchain.GetlastHeader()
+		if err = u.Blockchain.AddBlock(qblock.NewBlock([]*qbtx.Transaction{tx}, last.Hash, last.Height+1, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if outs := u.FindUTXO(addrP1); len(outs) != 1 || outs[0].TX_value != 4 || outs[0].Lock_blocks != 2 {
+		t.Errorf("locked output: %+v", outs)
+	}
+	if outs := u.FindUTXO(qbwallet.ScriptAddress(script)); len(outs) != 1 || !bytes.Equal(outs[0].Lock_script, script) {
+		t.Errorf("script output: %+v", outs)
+	}
+}
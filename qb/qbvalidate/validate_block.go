@@ -0,0 +1,146 @@
+package qbvalidate
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"qblock"
+	"qbtx"
+	"time"
+	"uss"
+	"utils"
+)
+
+// 区块时间戳最多可超前本地时间的秒数
+const MAX_FUTURE_BLOCK_TIME = 10 * 60
+
+// 区块被拒绝的原因
+var (
+	ErrBlockHashMismatch   = errors.New("block hash does not match its header")                           // 区块hash与区块头不符
+	ErrBlockVersion        = errors.New("block version is unknown or lower than its parent")              // 区块版本未知或低于父区块
+	ErrBlockPrevMismatch   = errors.New("block does not extend the local tip")                            // 前一区块hash不是本地最新区块
+	ErrBlockHeightMismatch = errors.New("block height is not parent height plus one")                     // 区块高度不等于父区块高度加一
+	ErrBlockTimeTooOld     = errors.New("block timestamp is earlier than its parent")                     // 区块时间早于父区块
+	ErrBlockTimeTooNew     = errors.New("block timestamp is too far in the future")                       // 区块时间超前本地时间过多
+	ErrBlockMerkleMismatch = errors.New("block merkle root does not match its transactions")              // 默克尔树根与区块交易不符
+	ErrBlockTXInvalid      = errors.New("block contains invalid or conflicting transactions")             // 区块包含非法或冲突的交易
+	ErrBlockFeeNotProposer = errors.New("block fee is not paid to the block proposer")                    // 手续费交易的收款方不是区块提议者
+	ErrGenesisInvalid      = errors.New("genesis block must have height 0 and only reserve transactions") // 创世区块不合法
+	ErrBlockSignUnknown    = errors.New("block signer is not a known node")                               // 区块签名者不是已知节点
+	ErrBlockSignMalformed  = errors.New("block signature parameters are malformed")                       // 区块签名参数与签名长度不符
+	ErrBlockSignMessage    = errors.New("block signature does not sign the block hash")                   // 区块签名消息不是区块hash
+	ErrBlockSignInvalid    = errors.New("block signature is invalid")                                     // 区块签名无效
+)
+
+// BlockError，区块校验错误，指明被拒绝的区块及原因；交易不合法时TX_errors记录每笔被拒绝交易的原因
+type BlockError struct {
+	Hash      []byte  // 区块hash
+	Height    int64   // 区块高度
+	Err       error   // 拒绝原因
+	TX_errors []error // 被拒绝交易的原因，仅在Err为ErrBlockTXInvalid时非空
+}
+
+// Error，错误信息
+func (e *BlockError) Error() string {
+	msg := fmt.Sprintf("block %d %s: %v", e.Height, hex.EncodeToString(e.Hash), e.Err)
+	for _, err := range e.TX_errors {
+		msg += "; " + err.Error()
+	}
+	return msg
+}
+
+// Unwrap，获取拒绝原因，便于errors.Is判断
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateBlock，完整校验一个区块：区块hash与区块头一致、版本、衔接父区块（前一区块hash与高度）、时间戳合理、
+// 默克尔树根与交易一致、区块内每笔交易依据UTXO视图合法且互不冲突、手续费支付给区块提议者。签名由VerifyBlockSign校验，不在此处校验
+// 参数：待校验区块，父区块的区块头（校验创世区块时为nil），父区块之上的UTXO视图
+// 返回值：拒绝原因error（*BlockError），通过时为nil
+func ValidateBlock(block *qblock.Block, parent *qblock.BlockHeader, view UTXOView) error {
+	if block == nil {
+		return &BlockError{Err: ErrBlockHashMismatch}
+	}
+	reject := func(err error) error {
+		return &BlockError{Hash: block.Hash, Height: block.Height, Err: err}
+	}
+
+	if !bytes.Equal(block.Hash, block.BlockToResolveHash()) {
+		return reject(ErrBlockHashMismatch)
+	}
+	if block.Version < qblock.BLOCK_VERSION_1 || block.Version > qblock.BLOCK_VERSION {
+		return reject(ErrBlockVersion)
+	}
+	// 先按父区块校验版本，再计算默克尔树根：创世区块之后只接受新版区块，旧版构造只适用于少量交易
+	if parent != nil && (block.Version < qblock.BLOCK_VERSION_2 || block.Version < parent.Version) {
+		return reject(ErrBlockVersion)
+	}
+	// 新版区块必须在区块头中记录默克尔树根
+	if (block.Version >= qblock.BLOCK_VERSION_2 && len(block.Merkle_root) == 0) || !block.VerifyMerkleRoot() {
+		return reject(ErrBlockMerkleMismatch)
+	}
+
+	if parent == nil { // 创世区块只能包含准备金交易
+		if block.Height != 0 || len(block.Prev_block_hash) != 0 {
+			return reject(ErrGenesisInvalid)
+		}
+		for _, tx := range block.Transactions {
+			if !tx.IsReserveTX() {
+				return reject(ErrGenesisInvalid)
+			}
+		}
+		return nil
+	}
+
+	if !bytes.Equal(block.Prev_block_hash, parent.Hash) {
+		return reject(ErrBlockPrevMismatch)
+	}
+	if block.Height != parent.Height+1 {
+		return reject(ErrBlockHeightMismatch)
+	}
+	if block.Time_stamp < parent.Time_stamp {
+		return reject(ErrBlockTimeTooOld)
+	}
+	if block.Time_stamp > time.Now().Unix()+MAX_FUTURE_BLOCK_TIME {
+		return reject(ErrBlockTimeTooNew)
+	}
+
+	target := TargetBlock{Height: block.Height, Time_stamp: parent.Time_stamp}
+	if _, errs := ValidateTransactions(block.Transactions, view, target); len(errs) != 0 {
+		return &BlockError{Hash: block.Hash, Height: block.Height, Err: ErrBlockTXInvalid, TX_errors: errs}
+	}
+	// 手续费只能支付给区块提议者，区块上链与导入时同样校验，不只依赖共识过程
+	if len(block.Transactions) > 0 && block.Transactions[0].IsFeeTX() {
+		owner := utils.GetAddrOwner(block.Transactions[0].TX_vout[0].TX_dst)
+		if owner == "" || owner != block.Proposer() {
+			return reject(ErrBlockFeeNotProposer)
+		}
+	}
+	return nil
+}
+
+// VerifyBlockSign，校验区块提议者的无条件安全签名：签名者为已知节点、签名参数与长度一致、签名消息为区块hash、签名有效。
+// 签名者无法以验签者身份验证自己的签名，本节点提议的区块以相同签名索引重新签名后比较
+// 参数：区块
+// 返回值：校验错误error，通过时为nil
+func VerifyBlockSign(block *qblock.Block) error {
+	sign := block.Block_uss
+	signer := block.Proposer()
+	signer_id := utils.GetNodeID(signer)
+	if signer == "" || signer_id == ([16]byte{}) || signer_id != sign.Sign_index.Sign_dev_id {
+		return ErrBlockSignUnknown
+	}
+	if sign.Main_row_num.Sign_node_name != signer || sign.USS_counts != qbtx.N-1 || sign.Main_row_num.Random_row_counts != sign.USS_counts || sign.USS_unit_len != 16 ||
+		len(sign.USS_signature) != int(sign.USS_counts*sign.USS_counts*sign.USS_unit_len) {
+		return ErrBlockSignMalformed
+	}
+	if !bytes.Equal(sign.USS_message, block.Hash) {
+		return ErrBlockSignMessage
+	}
+	if !uss.VerifySign(sign) {
+		return ErrBlockSignInvalid
+	}
+	return nil
+}
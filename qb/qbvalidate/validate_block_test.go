@@ -0,0 +1,133 @@
+package qbvalidate
+
+import (
+	"errors"
+	"fmt"
+	"qblock"
+	"qbtx"
+	"qkdserv"
+	"testing"
+)
+
+func TestValidateBlock(t *testing.T) {
+	fmt.Println("----------【Block】——ValidateBlock-------------------------------------------------------------------------")
+	funding := []byte("funding")
+	view := mapView{
+		outpointKey(funding, 0): {TX_value: 10, TX_dst: addrC1},
+	}
+	genesis := qblock.NewBlock([]*qbtx.Transaction{qbtx.NewReserveTX([]string{addrC1}, "")}, []byte{}, 0, 0)
+	if err := ValidateBlock(genesis, nil, view); err != nil {
+		t.Fatalf("genesis rejected: %v", err)
+	}
+	spend := signedTX(funding, 0, addrC1, 10, addrP1)
+	block := qblock.NewBlock([]*qbtx.Transaction{spend}, genesis.Hash, 1, 0)
+	if err := ValidateBlock(block, genesis.Header(), view); err != nil {
+		t.Fatalf("valid block rejected: %v", err)
+	}
+
+	tampered := *block
+	tampered.Height = 5 // 区块头被篡改，hash不再一致
+	merkle := *block
+	merkle.Transactions = []*qbtx.Transaction{signedTX(funding, 0, addrC1, 9, addrP1)}
+	// 旧版区块的默克尔树只支持少量交易，创世区块之后的旧版区块先于默克尔树根被拒绝
+	legacy := qblock.NewBlock([]*qbtx.Transaction{spend, spend, spend, spend, spend}, genesis.Hash, 1, 0)
+	legacy.Version, legacy.Merkle_root = qblock.BLOCK_VERSION_1, nil
+	legacy.Hash = legacy.BlockToResolveHash()
+	future := genesis.Header()
+	future.Time_stamp = block.Time_stamp + 1
+	// 按时间锁定的交易与父区块的时间戳比较，提议者调大区块时间戳不能提前打包
+	lock_time := genesis.Time_stamp + 1
+	timeLocked := &qbtx.Transaction{
+		TX_vin:    []qbtx.TXInput{{Refer_tx_id: funding, Refer_tx_id_index: 0, TX_src: addrC1}},
+		TX_vout:   []qbtx.TXOutput{{TX_value: 10, TX_dst: addrP1}},
+		Lock_time: lock_time,
+	}
+	qkdserv.Node_name = "C1"
+	timeLocked.USSTransactionSign("C1")
+	timeLocked.TX_id = timeLocked.SetID()
+	qkdserv.Node_name = "P1"
+	early := qblock.NewBlock([]*qbtx.Transaction{timeLocked}, genesis.Hash, 1, 0)
+	early.Time_stamp = lock_time
+	early.Hash = early.BlockToResolveHash()
+	unlocked := genesis.Header()
+	unlocked.Time_stamp = lock_time
+	if err := ValidateBlock(early, unlocked, view); err != nil {
+		t.Errorf("time lock reached by parent: %v", err)
+	}
+	// 手续费交易支付给提议者以外的节点
+	paying := signedTX(funding, 0, addrC1, 9, addrP1)
+	if err := ValidateBlock(qblock.NewBlock([]*qbtx.Transaction{paying}, genesis.Hash, 1, 1), genesis.Header(), view); err != nil {
+		t.Errorf("fee paid to proposer rejected: %v", err)
+	}
+	stolen := qblock.NewBlock([]*qbtx.Transaction{qbtx.NewFeeTX(1, addrP2, 1), paying}, genesis.Hash, 1, 0)
+	cases := []struct {
+		name   string
+		block  *qblock.Block
+		parent *qblock.BlockHeader
+		want   error
+	}{
+		{"hash mismatch", &tampered, genesis.Header(), ErrBlockHashMismatch},
+		{"merkle mismatch", &merkle, genesis.Header(), ErrBlockMerkleMismatch},
+		{"legacy version", legacy, genesis.Header(), ErrBlockVersion},
+		{"prev mismatch", qblock.NewBlock([]*qbtx.Transaction{spend}, []byte("other"), 1, 0), genesis.Header(), ErrBlockPrevMismatch},
+		{"height mismatch", qblock.NewBlock([]*qbtx.Transaction{spend}, genesis.Hash, 2, 0), genesis.Header(), ErrBlockHeightMismatch},
+		{"time too old", block, future, ErrBlockTimeTooOld},
+		{"time locked", early, genesis.Header(), ErrBlockTXInvalid},
+		{"invalid tx", qblock.NewBlock([]*qbtx.Transaction{spend, spend}, genesis.Hash, 1, 0), genesis.Header(), ErrBlockTXInvalid},
+		{"fee not paid", qblock.NewBlock([]*qbtx.Transaction{spend}, genesis.Hash, 1, 1), genesis.Header(), ErrBlockTXInvalid},
+		{"fee not to proposer", stolen, genesis.Header(), ErrBlockFeeNotProposer},
+		{"not genesis", block, nil, ErrGenesisInvalid},
+	}
+	for _, c := range cases {
+		err := ValidateBlock(c.block, c.parent, view)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+		var block_err *BlockError
+		if !errors.As(err, &block_err) {
+			t.Errorf("%s: error is not a *BlockError", c.name)
+		}
+	}
+	fmt.Println("validate block success")
+}
+
+func TestVerifyBlockSign(t *testing.T) {
+	fmt.Println("----------【Block】——VerifyBlockSign-----------------------------------------------------------------------")
+	block := qblock.NewBlock(nil, []byte("parent"), 1, 0) // 由P1提议并签名
+	if err := VerifyBlockSign(block); err != nil {
+		t.Fatalf("own block rejected: %v", err)
+	}
+	qkdserv.Node_name = "P2" // 以其他联盟节点的身份验签
+	defer func() { qkdserv.Node_name = "P1" }()
+	if err := VerifyBlockSign(block); err != nil {
+		t.Fatalf("block of P1 rejected by P2: %v", err)
+	}
+
+	forged := *block
+	forged.Block_uss.USS_signature = append([]byte{}, block.Block_uss.USS_signature...)
+	for i := range forged.Block_uss.USS_signature {
+		forged.Block_uss.USS_signature[i] ^= 0xff
+	}
+	other := *block
+	other.Hash = []byte("other")
+	unknown := *block
+	unknown.Block_uss.Main_row_num.Sign_node_name = "P99"
+	short := *block
+	short.Block_uss.USS_signature = block.Block_uss.USS_signature[1:]
+	cases := []struct {
+		name  string
+		block *qblock.Block
+		want  error
+	}{
+		{"forged", &forged, ErrBlockSignInvalid},
+		{"other message", &other, ErrBlockSignMessage},
+		{"unknown signer", &unknown, ErrBlockSignUnknown},
+		{"short signature", &short, ErrBlockSignMalformed},
+	}
+	for _, c := range cases {
+		if err := VerifyBlockSign(c.block); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+	fmt.Println("verify block sign success")
+}
@@ -0,0 +1,443 @@
+// qbvalidate包，交易与区块的校验：交易依据UTXO视图校验，区块在交易之外还须正确衔接父区块
+// 共识、区块上链与区块导入均使用同一套校验，保证非法区块不会被写入账本
+package qbvalidate
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"qb/qbwallet"
+	"qbtx"
+	"sort"
+)
+
+// 交易被拒绝的原因
+var (
+	ErrTXEmpty           = errors.New("transaction has no inputs or outputs")                      // 交易没有输入项或输出项
+	ErrTXIDMismatch      = errors.New("transaction id does not match its content")                 // 交易ID与交易内容不符
+	ErrReserveNotAllowed = errors.New("reserve transaction is only allowed in the genesis block")  // 准备金交易只能出现在创世区块
+	ErrInvalidOutput     = errors.New("output value must be positive and sent to a valid address") // 输出金额非正或接收地址无效
+	ErrScriptMismatch    = errors.New("locking script does not hash to the output address")        // 锁定脚本导出的地址与输出的接收方不符
+	ErrDuplicateInput    = errors.New("output is referenced twice in one transaction")             // 同一交易重复引用同一输出
+	ErrMissingOutput     = errors.New("referenced output does not exist or is already spent")      // 引用的输出不存在或已花费
+	ErrSrcMismatch       = errors.New("input source does not match the referenced output address") // 输入来源与被引用输出的接收方不符
+	ErrTXLocked          = errors.New("transaction lock time has not been reached")                // 交易锁定的高度或时间未到
+	ErrOutputLocked      = errors.New("referenced output is still locked")                         // 被引用输出的相对锁定未到期
+	ErrInsufficientInput = errors.New("input value is less than output value")                     // 输入金额小于输出金额
+	ErrAssetNotConserved = errors.New("asset inputs and outputs do not balance")                   // 非发行交易中资产的输入与输出总额不等
+	ErrUnknownAsset      = errors.New("asset has no issuer in the genesis block")                  // 发行的资产在创世区块中没有发行方
+	ErrNotIssuer         = errors.New("issue transaction has no input from the asset issuer")      // 发行交易没有来自发行方地址的输入项
+	ErrDuplicateTX       = errors.New("transaction appears twice in one block")                    // 同一区块中重复的交易
+	ErrDoubleSpend       = errors.New("output is spent by another transaction in the same block")  // 同一区块中的其他交易已花费该输出
+	ErrFeeTXMisplaced    = errors.New("fee transaction must be the first transaction of a block")  // 手续费交易只能作为区块的第一笔交易
+	ErrFeeMismatch       = errors.New("fee transaction does not pay the fees of the block")        // 手续费交易金额与区块手续费总额不符
+	ErrFeeTXMalformed    = errors.New("fee transaction is not the one of this block")              // 手续费交易的来源不是本区块或带有锁定、发行等选项
+	ErrTXExists          = errors.New("transaction id is already in the ledger")                   // 交易ID与已上链的交易相同
+)
+
+// TXRejectError，交易校验错误，指明被拒绝的交易及原因；与某个输入项相关的错误以*qbtx.TXInputError表示
+type TXRejectError struct {
+	TX_id []byte // 交易ID
+	Err   error  // 拒绝原因
+}
+
+// Error，错误信息
+func (e *TXRejectError) Error() string {
+	return fmt.Sprintf("tx %s: %v", hex.EncodeToString(e.TX_id), e.Err)
+}
+
+// Unwrap，获取拒绝原因，便于errors.Is判断
+func (e *TXRejectError) Unwrap() error {
+	return e.Err
+}
+
+// UTXOView，未花费交易输出视图，交易校验通过它查询被引用的输出，*qbutxo.UTXOSet与*quantumbc.Blockchain均实现该接口
+type UTXOView interface {
+	GetUTXO(txid []byte, index int) (qbtx.TXOutput, bool) // 查询未花费输出，已花费或不存在时返回false
+	UTXOHeight(txid []byte) (int64, bool)                 // 查询交易的未花费输出所在区块的高度，尚未上链时返回false
+}
+
+// TXIndex，已上链交易的索引，UTXO视图实现该接口时，校验可拒绝与已花费完的已上链交易ID相同的交易；*quantumbc.Blockchain实现该接口
+type TXIndex interface {
+	HasTransaction(txid []byte) bool // 查询交易是否已上链
+}
+
+// TXExists，判断交易ID是否已在账本中：交易仍有未花费输出，或视图实现TXIndex且交易已上链。
+// 上链时交易的输出按交易ID写入UTXO集合，相同ID的交易会覆盖已有的输出，须在校验时拒绝
+// 参数：UTXO视图，交易ID[]byte
+// 返回值：是否已在账本中bool
+func TXExists(view UTXOView, txid []byte) bool {
+	if _, ok := view.UTXOHeight(txid); ok {
+		return true
+	}
+	if index, ok := view.(TXIndex); ok {
+		return index.HasTransaction(txid)
+	}
+	return false
+}
+
+// TargetBlock，交易所在或将被打包进的区块的高度与父区块的时间戳，用于校验交易的锁定时间与输出的相对锁定。
+// 区块时间戳由提议者选择，按时间的锁定与父区块（已上链的最新区块）的时间戳比较，提议者无法借此提前花费
+type TargetBlock struct {
+	Height     int64 // 区块高度
+	Time_stamp int64 // 父区块时间戳
+}
+
+// UTXOOverlay，在基础视图上叠加一组尚未上链交易的效果：被花费的输出不再可见，新交易的输出可被后续交易引用
+type UTXOOverlay struct {
+	base    UTXOView
+	spent   map[string]bool          // 已被叠加交易花费的输出，key=outpointKey
+	added   map[string]qbtx.TXOutput // 叠加交易新产生的输出，key=outpointKey
+	created map[string]bool          // 叠加的交易，key=交易ID的十六进制
+}
+
+// NewUTXOOverlay，创建叠加视图
+// 参数：基础视图UTXOView
+// 返回值：叠加视图*UTXOOverlay
+func NewUTXOOverlay(base UTXOView) *UTXOOverlay {
+	return &UTXOOverlay{
+		base:    base,
+		spent:   make(map[string]bool),
+		added:   make(map[string]qbtx.TXOutput),
+		created: make(map[string]bool),
+	}
+}
+
+// GetUTXO，查询未花费输出：先查叠加层，再查基础视图
+func (o *UTXOOverlay) GetUTXO(txid []byte, index int) (qbtx.TXOutput, bool) {
+	key := outpointKey(txid, index)
+	if o.spent[key] {
+		return qbtx.TXOutput{}, false
+	}
+	if out, ok := o.added[key]; ok {
+		return out, true
+	}
+	return o.base.GetUTXO(txid, index)
+}
+
+// UTXOHeight，叠加交易的输出尚未上链，其余交易查询基础视图
+func (o *UTXOOverlay) UTXOHeight(txid []byte) (int64, bool) {
+	if o.created[hex.EncodeToString(txid)] {
+		return 0, false
+	}
+	return o.base.UTXOHeight(txid)
+}
+
+// HasTransaction，叠加交易尚未上链，查询基础视图
+func (o *UTXOOverlay) HasTransaction(txid []byte) bool {
+	return !o.created[hex.EncodeToString(txid)] && TXExists(o.base, txid)
+}
+
+// IsSpent，判断输出是否已被叠加层中的交易花费
+func (o *UTXOOverlay) IsSpent(txid []byte, index int) bool {
+	return o.spent[outpointKey(txid, index)]
+}
+
+// Apply，将交易叠加到视图上：标记其输入为已花费，加入其输出
+// 参数：已通过校验的交易
+// 返回值：无
+func (o *UTXOOverlay) Apply(tx *qbtx.Transaction) {
+	if !tx.IsReserveTX() && !tx.IsFeeTX() {
+		for _, vin := range tx.TX_vin {
+			key := outpointKey(vin.Refer_tx_id, vin.Refer_tx_id_index)
+			delete(o.added, key)
+			o.spent[key] = true
+		}
+	}
+	for out_idx, out := range tx.TX_vout {
+		o.added[outpointKey(tx.TX_id, out_idx)] = out
+	}
+	o.created[hex.EncodeToString(tx.TX_id)] = true
+}
+
+// outpointKey，输出定位键：交易ID:输出编号
+func outpointKey(txid []byte, index int) string {
+	return fmt.Sprintf("%s:%d", hex.EncodeToString(txid), index)
+}
+
+// ValidateTransaction，依据UTXO视图校验一笔普通交易：交易ID、锁定时间已到、输出金额与地址、被引用输出存在、未花费且相对锁定已到期、
+// 输入来源与被引用输出的接收方一致、解锁脚本满足锁定脚本（多重签名与哈希时间锁合约均以脚本表达）、签名有效、原生币输入总额不小于输出总额、
+// 其余资产输入与输出相等（发行交易须由发行方授权，所发行的资产除外）
+// 参数：待校验交易，UTXO视图，交易所在或将被打包进的区块TargetBlock
+// 返回值：拒绝原因error（*TXRejectError或*qbtx.TXInputError），通过时为nil
+func ValidateTransaction(tx *qbtx.Transaction, view UTXOView, target TargetBlock) error {
+	_, err := TransactionFee(tx, view, target)
+	return err
+}
+
+// TransactionFee，校验一笔普通交易并计算其手续费：手续费=原生币输入总额-原生币输出总额，其余资产须守恒
+// 参数：待校验交易，UTXO视图，交易所在或将被打包进的区块TargetBlock
+// 返回值：手续费int，拒绝原因error，通过时为nil
+func TransactionFee(tx *qbtx.Transaction, view UTXOView, target TargetBlock) (int, error) {
+	if tx == nil || len(tx.TX_vin) == 0 || len(tx.TX_vout) == 0 {
+		var txid []byte
+		if tx != nil {
+			txid = tx.TX_id
+		}
+		return 0, &TXRejectError{TX_id: txid, Err: ErrTXEmpty}
+	}
+	if tx.IsReserveTX() {
+		return 0, &TXRejectError{TX_id: tx.TX_id, Err: ErrReserveNotAllowed}
+	}
+	if tx.IsFeeTX() {
+		return 0, &TXRejectError{TX_id: tx.TX_id, Err: ErrFeeTXMisplaced}
+	}
+	if !bytes.Equal(tx.TX_id, tx.SetID()) {
+		return 0, &TXRejectError{TX_id: tx.TX_id, Err: ErrTXIDMismatch}
+	}
+	if TXExists(view, tx.TX_id) {
+		return 0, &TXRejectError{TX_id: tx.TX_id, Err: ErrTXExists}
+	}
+	if tx.Lock_time < 0 {
+		return 0, &TXRejectError{TX_id: tx.TX_id, Err: fmt.Errorf("%w: negative lock time %d", ErrTXLocked, tx.Lock_time)}
+	}
+	if !tx.IsFinal(target.Height, target.Time_stamp) {
+		return 0, &TXRejectError{TX_id: tx.TX_id, Err: fmt.Errorf("%w: locked until %d", ErrTXLocked, tx.Lock_time)}
+	}
+
+	// 1.校验输出项，按资产分别累计金额
+	value_out := make(map[string]int)
+	for _, out := range tx.TX_vout {
+		if out.TX_value <= 0 || out.TX_value > math.MaxInt64-value_out[out.Asset] || out.Lock_blocks < 0 || !qbwallet.ValidateAddress(out.TX_dst) {
+			return 0, &TXRejectError{TX_id: tx.TX_id, Err: ErrInvalidOutput}
+		}
+		if out.Asset != "" {
+			if err := qbtx.ValidateAssetID(out.Asset); err != nil {
+				return 0, &TXRejectError{TX_id: tx.TX_id, Err: fmt.Errorf("%w: %v", ErrInvalidOutput, err)}
+			}
+		}
+		if len(out.Lock_script) > 0 { // 锁定脚本须可解析，接收方为脚本导出的地址
+			if err := out.Lock_script.Validate(); err != nil {
+				return 0, &TXRejectError{TX_id: tx.TX_id, Err: fmt.Errorf("%w: %v", ErrInvalidOutput, err)}
+			}
+			if qbwallet.ScriptAddress(out.Lock_script) != out.TX_dst {
+				return 0, &TXRejectError{TX_id: tx.TX_id, Err: ErrScriptMismatch}
+			}
+		}
+		value_out[out.Asset] += out.TX_value
+	}
+	if err := validateIssue(tx); err != nil {
+		return 0, &TXRejectError{TX_id: tx.TX_id, Err: err}
+	}
+
+	// 2.校验输入项引用的输出
+	value_in := make(map[string]int)
+	refered := make(map[string]bool)
+	for in_id, vin := range tx.TX_vin {
+		key := outpointKey(vin.Refer_tx_id, vin.Refer_tx_id_index)
+		if refered[key] {
+			return 0, &qbtx.TXInputError{TX_id: tx.TX_id, In_id: in_id, Err: ErrDuplicateInput}
+		}
+		refered[key] = true
+
+		out, ok := view.GetUTXO(vin.Refer_tx_id, vin.Refer_tx_id_index)
+		if !ok {
+			return 0, &qbtx.TXInputError{TX_id: tx.TX_id, In_id: in_id, Err: ErrMissingOutput}
+		}
+		confirmed, ok := view.UTXOHeight(vin.Refer_tx_id)
+		if !ok { // 尚未上链的输出至多与本交易在同一区块
+			confirmed = target.Height
+		}
+		if !out.SpendableAt(confirmed, target.Height) {
+			err := fmt.Errorf("%w: until height %d", ErrOutputLocked, confirmed+out.Lock_blocks)
+			return 0, &qbtx.TXInputError{TX_id: tx.TX_id, In_id: in_id, Err: err}
+		}
+		if vin.TX_src != out.TX_dst { // 只能花费属于自己地址的输出
+			return 0, &qbtx.TXInputError{TX_id: tx.TX_id, In_id: in_id, Err: ErrSrcMismatch}
+		}
+		if err := VerifyInputScript(tx, in_id, out, target); err != nil {
+			return 0, &qbtx.TXInputError{TX_id: tx.TX_id, In_id: in_id, Err: err}
+		}
+		value_in[out.Asset] += out.TX_value
+	}
+
+	// 3.校验签名：签名者须是输入来源地址的所有者，带解锁脚本的输入项已在上一步校验
+	if errs := tx.VerifyUSSTransactionSign(); len(errs) != 0 {
+		return 0, errs[0]
+	}
+
+	// 4.校验金额：原生币的输入不小于输出，差额为手续费；其余资产输入输出相等，发行交易所发行的资产除外
+	if value_in[""] < value_out[""] {
+		return 0, &TXRejectError{TX_id: tx.TX_id, Err: ErrInsufficientInput}
+	}
+	if err := checkConservation(tx, value_in, value_out); err != nil {
+		return 0, &TXRejectError{TX_id: tx.TX_id, Err: err}
+	}
+	return value_in[""] - value_out[""], nil
+}
+
+// asset_issuers，各资产的发行方钱包地址，取自创世区块记录的联盟参数
+var asset_issuers map[string]string
+
+// SetAssetIssuers，设置资产发行方表。启动时以创世区块记录的发行方调用一次，须在开始校验交易之前
+// 参数：资产编号到发行方钱包地址的map[string]string
+func SetAssetIssuers(issuers map[string]string) {
+	asset_issuers = issuers
+}
+
+// validateIssue，校验发行交易：资产编号合法且创世区块记录了其发行方，至少一个输入项花费发行方地址的输出。
+// 输入项的签名或花费条件随后照常校验，因此发行方的授权即其对该输入项的签名；发行方也可以是多重签名或脚本地址
+// 参数：交易
+// 返回值：拒绝原因error，非发行交易或通过时为nil
+func validateIssue(tx *qbtx.Transaction) error {
+	if !tx.IsIssueTX() {
+		return nil
+	}
+	if err := qbtx.ValidateAssetID(tx.Issue_asset); err != nil {
+		return err
+	}
+	issuer := asset_issuers[tx.Issue_asset]
+	if issuer == "" {
+		return fmt.Errorf("%w: %s", ErrUnknownAsset, tx.Issue_asset)
+	}
+	for _, vin := range tx.TX_vin {
+		if vin.TX_src == issuer {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotIssuer, issuer)
+}
+
+// checkConservation，检查原生币以外的每种资产输入与输出总额相等；发行交易所发行的资产由发行方增发或回收，不受此约束
+// 参数：交易，各资产的输入总额，各资产的输出总额
+// 返回值：不守恒时返回ErrAssetNotConserved
+func checkConservation(tx *qbtx.Transaction, value_in, value_out map[string]int) error {
+	assets := make([]string, 0, len(value_in)+len(value_out))
+	for asset := range value_in {
+		assets = append(assets, asset)
+	}
+	for asset := range value_out {
+		if _, ok := value_in[asset]; !ok {
+			assets = append(assets, asset)
+		}
+	}
+	sort.Strings(assets) // 按编号依次检查，拒绝原因与map遍历顺序无关
+	for _, asset := range assets {
+		if asset == "" || asset == tx.Issue_asset {
+			continue
+		}
+		if value_in[asset] != value_out[asset] {
+			return fmt.Errorf("%w: %s in %d, out %d", ErrAssetNotConserved, asset, value_in[asset], value_out[asset])
+		}
+	}
+	return nil
+}
+
+// VerifyInputScript，花费带锁定脚本的输出时执行解锁脚本与锁定脚本；普通输出不接受解锁脚本，以免跳过签名校验。
+// VerifyUSSTransactionSign不校验带解锁脚本的输入项，校验交易或审计账本时须对每个输入项调用
+// 参数：交易，输入项编号int，被花费的输出，交易所在或将被打包进的区块TargetBlock
+// 返回值：校验错误error，通过时为nil
+func VerifyInputScript(tx *qbtx.Transaction, in_id int, out qbtx.TXOutput, target TargetBlock) error {
+	unlock := tx.TX_vin[in_id].Unlock_script
+	if len(out.Lock_script) == 0 {
+		if len(unlock) > 0 {
+			return qbtx.ErrScriptUnexpected
+		}
+		return nil
+	}
+	if len(unlock) == 0 {
+		return qbtx.ErrScriptMissing
+	}
+	ctx := qbtx.ScriptContext{Tx: tx, In_id: in_id, Height: target.Height, Time_stamp: target.Time_stamp}
+	return qbtx.VerifyScript(unlock, out.Lock_script, ctx)
+}
+
+// ValidateTransactions，按顺序校验一组将打包进同一区块的交易：后面的交易可以花费前面交易的输出，
+// 但同一输出不能被两笔交易花费，同一交易不能出现两次。第一笔交易可以是手续费交易，其金额须等于其余交易的手续费之和
+// 参数：交易数组，UTXO视图，交易所在或将被打包进的区块TargetBlock
+// 返回值：通过校验的交易数组，每笔被拒绝交易对应的错误数组
+func ValidateTransactions(txs []*qbtx.Transaction, view UTXOView, target TargetBlock) ([]*qbtx.Transaction, []error) {
+	var valid []*qbtx.Transaction
+	var errs []error
+	var fee_tx *qbtx.Transaction
+	overlay := NewUTXOOverlay(view)
+	seen := make(map[string]bool)
+	fees := 0
+
+	for i, tx := range txs {
+		if tx == nil {
+			errs = append(errs, &TXRejectError{Err: ErrTXEmpty})
+			continue
+		}
+		if tx.IsFeeTX() {
+			if i != 0 {
+				errs = append(errs, &TXRejectError{TX_id: tx.TX_id, Err: ErrFeeTXMisplaced})
+			} else {
+				fee_tx = tx // 待其余交易校验完成后核对金额
+			}
+			continue
+		}
+		txid := hex.EncodeToString(tx.TX_id)
+		if seen[txid] {
+			errs = append(errs, &TXRejectError{TX_id: tx.TX_id, Err: ErrDuplicateTX})
+			continue
+		}
+		if in_id, conflict := conflictInput(tx, overlay); conflict {
+			errs = append(errs, &qbtx.TXInputError{TX_id: tx.TX_id, In_id: in_id, Err: ErrDoubleSpend})
+			continue
+		}
+		fee, err := TransactionFee(tx, overlay, target)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		seen[txid] = true
+		overlay.Apply(tx)
+		valid = append(valid, tx)
+		fees += fee
+	}
+
+	if fee_tx != nil {
+		if err := validateFeeTX(fee_tx, fees, view, target); err != nil {
+			errs = append(errs, err)
+		} else {
+			valid = append([]*qbtx.Transaction{fee_tx}, valid...)
+		}
+	}
+	return valid, errs
+}
+
+// validateFeeTX，校验手续费交易：交易ID正确且不在账本中，来源为本区块的手续费，不带锁定与发行选项，
+// 只有一个原生币输出，金额等于区块手续费总额，接收地址有效且不带锁定；收款方是否为提议者由ValidateBlock校验
+// 参数：手续费交易，区块手续费总额int，UTXO视图，交易所在或将被打包进的区块TargetBlock
+// 返回值：拒绝原因error，通过时为nil
+func validateFeeTX(tx *qbtx.Transaction, fees int, view UTXOView, target TargetBlock) error {
+	if !bytes.Equal(tx.TX_id, tx.SetID()) {
+		return &TXRejectError{TX_id: tx.TX_id, Err: ErrTXIDMismatch}
+	}
+	if TXExists(view, tx.TX_id) {
+		return &TXRejectError{TX_id: tx.TX_id, Err: ErrTXExists}
+	}
+	vin := tx.TX_vin[0]
+	if vin.TX_src != fmt.Sprintf("fee of block %d", target.Height) || len(vin.Unlock_script) != 0 || tx.Lock_time != 0 || tx.Issue_asset != "" {
+		return &TXRejectError{TX_id: tx.TX_id, Err: ErrFeeTXMalformed}
+	}
+	if len(tx.TX_vout) != 1 {
+		return &TXRejectError{TX_id: tx.TX_id, Err: ErrInvalidOutput}
+	}
+	out := tx.TX_vout[0]
+	if !qbwallet.ValidateAddress(out.TX_dst) || out.Asset != "" || out.Lock_blocks != 0 || len(out.Lock_script) != 0 {
+		return &TXRejectError{TX_id: tx.TX_id, Err: ErrInvalidOutput}
+	}
+	if out.TX_value != fees {
+		return &TXRejectError{TX_id: tx.TX_id, Err: ErrFeeMismatch}
+	}
+	return nil
+}
+
+// conflictInput，检查交易是否花费了叠加层中已被花费的输出
+// 参数：交易，叠加视图
+// 返回值：冲突的输入项编号int，是否冲突bool
+func conflictInput(tx *qbtx.Transaction, overlay *UTXOOverlay) (int, bool) {
+	if tx.IsReserveTX() || tx.IsFeeTX() {
+		return 0, false
+	}
+	for in_id, vin := range tx.TX_vin {
+		if overlay.IsSpent(vin.Refer_tx_id, vin.Refer_tx_id_index) {
+			return in_id, true
+		}
+	}
+	return 0, false
+}
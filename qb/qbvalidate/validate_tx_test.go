@@ -0,0 +1,489 @@
+package qbvalidate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"qb/qbwallet"
+	"qbtx"
+	"qkdserv"
+	"strings"
+	"testing"
+)
+
+const (
+	addrC1 = "1CG9GcxF2BT1rjxwoMHSLtRP9RTCsSkRyH" // C1的钱包地址
+	addrP1 = "195KpL1PxRzvVKxg33YYbWjgFqxFAbBit9" // P1的钱包地址
+	addrP2 = "1GXGEbz9aJpkL96DzUCxi8WdttJhzMeR3r" // P2的钱包地址
+	addrP3 = "1NnLuxC3JxzqmD752Gp5qtfDCskRHXWYn6" // P3的钱包地址
+)
+
+// mapView，测试用的UTXO视图
+type mapView map[string]qbtx.TXOutput
+
+func (m mapView) GetUTXO(txid []byte, index int) (qbtx.TXOutput, bool) {
+	out, ok := m[outpointKey(txid, index)]
+	return out, ok
+}
+
+func (m mapView) UTXOHeight(txid []byte) (int64, bool) {
+	prefix := hex.EncodeToString(txid) + ":"
+	for key := range m {
+		if strings.HasPrefix(key, prefix) {
+			return 0, true // 测试输出均在创世区块中
+		}
+	}
+	return 0, false
+}
+
+// indexView，带交易索引的测试视图
+type indexView struct {
+	mapView
+	txs map[string]bool
+}
+
+func (v indexView) HasTransaction(txid []byte) bool {
+	return v.txs[hex.EncodeToString(txid)]
+}
+
+// next，测试交易将被打包进的区块
+var next = TargetBlock{Height: 1}
+
+// signedTX，以C1身份生成一笔已签名的交易
+func signedTX(refer []byte, index int, src string, value int, dst string) *qbtx.Transaction {
+	tx := &qbtx.Transaction{
+		TX_vin: []qbtx.TXInput{{
+			Refer_tx_id:       refer,
+			Refer_tx_id_index: index,
+			TX_src:            src,
+		}},
+		TX_vout: []qbtx.TXOutput{{TX_value: value, TX_dst: dst}},
+	}
+	qkdserv.Node_name = "C1"
+	tx.USSTransactionSign("C1")
+	tx.TX_id = tx.SetID()
+	qkdserv.Node_name = "P1"
+	return tx
+}
+
+func TestMain(m *testing.M) {
+	os.Chdir("..") // 配置文件路径相对于qb目录
+	qkdserv.QKD_sign_random_matrix_pool = make(map[qkdserv.QKDSignMatrixIndex]qkdserv.QKDSignRandomsMatrix)
+	qkdserv.Node_name = "P1"
+	qbtx.N = 4
+	os.Exit(m.Run())
+}
+
+func TestValidateTransactions(t *testing.T) {
+	fmt.Println("----------【UTXO】——ValidateTransaction && ValidateTransactions---------------------------------------------")
+
+	funding := []byte("funding")
+	view := mapView{
+		outpointKey(funding, 0): {TX_value: 10, TX_dst: addrC1},
+		outpointKey(funding, 1): {TX_value: 5, TX_dst: addrP1},
+	}
+
+	// 合法交易
+	ok := signedTX(funding, 0, addrC1, 10, addrP1)
+	if err := ValidateTransaction(ok, view, next); err != nil {
+		t.Fatalf("valid tx rejected: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		tx   *qbtx.Transaction
+		want error
+	}{
+		{"missing output", signedTX(funding, 7, addrC1, 1, addrP1), ErrMissingOutput},
+		{"src mismatch", signedTX(funding, 1, addrC1, 1, addrP1), ErrSrcMismatch},
+		{"insufficient input", signedTX(funding, 0, addrC1, 11, addrP1), ErrInsufficientInput},
+		{"invalid output", signedTX(funding, 0, addrC1, 1, "P1"), ErrInvalidOutput},
+		{"reserve tx", qbtx.NewReserveTX([]string{addrC1}, ""), ErrReserveNotAllowed},
+	}
+	for _, c := range cases {
+		if err := ValidateTransaction(c.tx, view, next); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	// 同一区块内：重复交易、双花，以及花费前一笔交易的输出
+	spend := signedTX(funding, 0, addrC1, 4, addrC1)
+	double := signedTX(funding, 0, addrC1, 3, addrP1)
+	chained := signedTX(spend.TX_id, 0, addrC1, 4, addrP1)
+	valid, errs := ValidateTransactions([]*qbtx.Transaction{spend, spend, double, chained}, view, next)
+	if len(valid) != 2 || valid[0] != spend || valid[1] != chained {
+		t.Errorf("valid txs: got %d, want spend and chained", len(valid))
+	}
+	if len(errs) != 2 || !errors.Is(errs[0], ErrDuplicateTX) || !errors.Is(errs[1], ErrDoubleSpend) {
+		t.Errorf("block errors: got %v, want [%v %v]", errs, ErrDuplicateTX, ErrDoubleSpend)
+	}
+
+	// 手续费：输入10，输出8，手续费交易须位于首位且金额等于2
+	paying := signedTX(funding, 0, addrC1, 8, addrP1)
+	if fee, err := TransactionFee(paying, view, next); err != nil || fee != 2 {
+		t.Errorf("fee: got %d %v, want 2", fee, err)
+	}
+	valid, errs = ValidateTransactions([]*qbtx.Transaction{qbtx.NewFeeTX(2, addrP1, 1), paying}, view, next)
+	if len(valid) != 2 || len(errs) != 0 {
+		t.Errorf("fee tx rejected: %v", errs)
+	}
+	_, errs = ValidateTransactions([]*qbtx.Transaction{qbtx.NewFeeTX(3, addrP1, 1), paying}, view, next)
+	if len(errs) != 1 || !errors.Is(errs[0], ErrFeeMismatch) {
+		t.Errorf("fee mismatch: got %v, want %v", errs, ErrFeeMismatch)
+	}
+	_, errs = ValidateTransactions([]*qbtx.Transaction{paying, qbtx.NewFeeTX(2, addrP1, 1)}, view, next)
+	if len(errs) != 1 || !errors.Is(errs[0], ErrFeeTXMisplaced) {
+		t.Errorf("misplaced fee tx: got %v, want %v", errs, ErrFeeTXMisplaced)
+	}
+	// 手续费交易须是本区块的，且不带锁定
+	_, errs = ValidateTransactions([]*qbtx.Transaction{qbtx.NewFeeTX(2, addrP1, 2), paying}, view, next)
+	if len(errs) != 1 || !errors.Is(errs[0], ErrFeeTXMalformed) {
+		t.Errorf("fee tx of another block: got %v, want %v", errs, ErrFeeTXMalformed)
+	}
+	locked_fee := qbtx.NewFeeTX(2, addrP1, 1)
+	locked_fee.TX_vout[0].Lock_blocks = 1
+	locked_fee.TX_id = locked_fee.SetID()
+	_, errs = ValidateTransactions([]*qbtx.Transaction{locked_fee, paying}, view, next)
+	if len(errs) != 1 || !errors.Is(errs[0], ErrInvalidOutput) {
+		t.Errorf("locked fee output: got %v, want %v", errs, ErrInvalidOutput)
+	}
+
+	// 与已上链交易ID相同的交易会覆盖其输出：仍有未花费输出或在交易索引中的交易均被拒绝
+	view[outpointKey(paying.TX_id, 0)] = paying.TX_vout[0]
+	if err := ValidateTransaction(paying, view, next); !errors.Is(err, ErrTXExists) {
+		t.Errorf("tx with unspent outputs: got %v, want %v", err, ErrTXExists)
+	}
+	delete(view, outpointKey(paying.TX_id, 0))
+	indexed := indexView{mapView: view, txs: map[string]bool{hex.EncodeToString(paying.TX_id): true}}
+	if _, errs = ValidateTransactions([]*qbtx.Transaction{paying}, indexed, next); len(errs) != 1 || !errors.Is(errs[0], ErrTXExists) {
+		t.Errorf("tx in tx index: got %v, want %v", errs, ErrTXExists)
+	}
+	fmt.Println("validate transactions against utxo success")
+}
+
+// multiSigTX，花费多重签名脚本输出的交易，依次由signers共同签名
+func multiSigTX(refer []byte, src string, signers ...string) *qbtx.Transaction {
+	tx := &qbtx.Transaction{
+		TX_vin:  []qbtx.TXInput{{Refer_tx_id: refer, TX_src: src, Unlock_script: qbtx.UnlockMultiSig(nil)}},
+		TX_vout: []qbtx.TXOutput{{TX_value: 10, TX_dst: addrC1}},
+	}
+	tx.TX_id = tx.SetID()
+	for _, signer := range signers {
+		qkdserv.Node_name = signer
+		if err := tx.CoSign(0, signer); err != nil {
+			panic(err)
+		}
+	}
+	qkdserv.Node_name = "P4"
+	return tx
+}
+
+func TestValidateMultiSig(t *testing.T) {
+	fmt.Println("----------【UTXO】——multisig outputs spent with co-signatures-----------------------------------------------")
+	script, _ := qbtx.MultiSigScript(2, []string{addrC1, addrP2, addrP3})
+	address := qbwallet.ScriptAddress(script)
+	if !qbwallet.ValidateAddress(address) || address == addrC1 {
+		t.Fatalf("multisig address %s", address)
+	}
+	funding := []byte("multisig funding")
+	view := mapView{outpointKey(funding, 0): {TX_value: 10, TX_dst: address, Lock_script: script}}
+	defer func() { qkdserv.Node_name = "P1" }()
+
+	if err := ValidateTransaction(multiSigTX(funding, address, "C1", "P3"), view, next); err != nil {
+		t.Fatalf("2 of 3 rejected: %v", err)
+	}
+	if err := ValidateTransaction(multiSigTX(funding, address, "P2"), view, next); !errors.Is(err, qbtx.ErrScriptFailed) {
+		t.Errorf("1 of 3: got %v, want %v", err, qbtx.ErrScriptFailed)
+	}
+	// 非成员的共同签名不计入门限
+	if err := ValidateTransaction(multiSigTX(funding, address, "P2", "P1"), view, next); !errors.Is(err, qbtx.ErrScriptFailed) {
+		t.Errorf("signer outside the set: got %v, want %v", err, qbtx.ErrScriptFailed)
+	}
+	// 普通签名不能花费多重签名输出
+	if err := ValidateTransaction(signedTX(funding, 0, address, 10, addrC1), view, next); !errors.Is(err, qbtx.ErrScriptMissing) {
+		t.Errorf("single signature: got %v, want %v", err, qbtx.ErrScriptMissing)
+	}
+}
+
+func TestLockTime(t *testing.T) {
+	fmt.Println("----------【UTXO】——lock time of transactions && relative lock of outputs---------------------------------")
+	funding := []byte("locked funding")
+	view := mapView{
+		outpointKey(funding, 0): {TX_value: 10, TX_dst: addrC1},
+		outpointKey(funding, 1): {TX_value: 10, TX_dst: addrC1, Lock_blocks: 3},
+	}
+	// locked，以C1身份生成锁定时间为lock_time的交易
+	locked := func(index int, lock_time int64) *qbtx.Transaction {
+		tx := &qbtx.Transaction{
+			TX_vin:    []qbtx.TXInput{{Refer_tx_id: funding, Refer_tx_id_index: index, TX_src: addrC1}},
+			TX_vout:   []qbtx.TXOutput{{TX_value: 10, TX_dst: addrP1}},
+			Lock_time: lock_time,
+		}
+		qkdserv.Node_name = "C1"
+		tx.USSTransactionSign("C1")
+		tx.TX_id = tx.SetID()
+		qkdserv.Node_name = "P1"
+		return tx
+	}
+
+	// 按高度锁定
+	byHeight := locked(0, 5)
+	if err := ValidateTransaction(byHeight, view, TargetBlock{Height: 4}); !errors.Is(err, ErrTXLocked) {
+		t.Errorf("height 4: got %v, want %v", err, ErrTXLocked)
+	}
+	if err := ValidateTransaction(byHeight, view, TargetBlock{Height: 5}); err != nil {
+		t.Errorf("height 5: %v", err)
+	}
+	// 按时间锁定
+	byTime := locked(0, qbtx.LOCK_TIME_THRESHOLD+100)
+	if err := ValidateTransaction(byTime, view, TargetBlock{Height: 100, Time_stamp: qbtx.LOCK_TIME_THRESHOLD + 99}); !errors.Is(err, ErrTXLocked) {
+		t.Errorf("before lock time: got %v, want %v", err, ErrTXLocked)
+	}
+	if err := ValidateTransaction(byTime, view, TargetBlock{Height: 1, Time_stamp: qbtx.LOCK_TIME_THRESHOLD + 100}); err != nil {
+		t.Errorf("at lock time: %v", err)
+	}
+	// 负的锁定时间与负的相对锁定均无效
+	if err := ValidateTransaction(locked(0, -1), view, next); !errors.Is(err, ErrTXLocked) {
+		t.Errorf("negative lock time: got %v, want %v", err, ErrTXLocked)
+	}
+	negative := signedTX(funding, 0, addrC1, 10, addrP1)
+	negative.TX_vout[0].Lock_blocks = -1
+	qkdserv.Node_name = "C1"
+	negative.USSTransactionSign("C1")
+	negative.TX_id = negative.SetID()
+	qkdserv.Node_name = "P1"
+	if err := ValidateTransaction(negative, view, next); !errors.Is(err, ErrInvalidOutput) {
+		t.Errorf("negative lock blocks: got %v, want %v", err, ErrInvalidOutput)
+	}
+	// 锁定时间参与签名，签名后修改则签名无效
+	byHeight.Lock_time = 1
+	byHeight.TX_id = byHeight.SetID()
+	if err := ValidateTransaction(byHeight, view, next); !errors.Is(err, qbtx.ErrSignMessageMismatch) {
+		t.Errorf("changed lock time: got %v, want %v", err, qbtx.ErrSignMessageMismatch)
+	}
+
+	// 输出在高度0上链，相对锁定3个区块
+	relative := locked(1, 0)
+	if err := ValidateTransaction(relative, view, TargetBlock{Height: 2}); !errors.Is(err, ErrOutputLocked) {
+		t.Errorf("height 2: got %v, want %v", err, ErrOutputLocked)
+	}
+	if err := ValidateTransaction(relative, view, TargetBlock{Height: 3}); err != nil {
+		t.Errorf("height 3: %v", err)
+	}
+	// 同一区块中新产生的锁定输出不能立即花费
+	lockedOut := signedTX(funding, 0, addrC1, 10, addrC1)
+	lockedOut.TX_vout[0].Lock_blocks = 1
+	qkdserv.Node_name = "C1"
+	lockedOut.USSTransactionSign("C1")
+	lockedOut.TX_id = lockedOut.SetID()
+	qkdserv.Node_name = "P1"
+	child := signedTX(lockedOut.TX_id, 0, addrC1, 10, addrP1)
+	valid, errs := ValidateTransactions([]*qbtx.Transaction{lockedOut, child}, view, TargetBlock{Height: 10})
+	if len(valid) != 1 || len(errs) != 1 || !errors.Is(errs[0], ErrOutputLocked) {
+		t.Errorf("spent in the same block: got %d valid, %v", len(valid), errs)
+	}
+}
+
+func TestValidateHTLC(t *testing.T) {
+	fmt.Println("----------【UTXO】——htlc claimed with the preimage or refunded after the timeout-----------------------------")
+	preimage := []byte("atomic swap secret")
+	digest := sha256.Sum256(preimage)
+	h, _ := qbtx.NewHTLC(digest[:], addrP1, addrC1, 10)
+	script, _ := qbtx.HTLCScript(h)
+	address := qbwallet.ScriptAddress(script)
+	funding := []byte("htlc funding")
+	view := mapView{outpointKey(funding, 0): {TX_value: 10, TX_dst: address, Lock_script: script}}
+
+	// spend，signer签名花费合约输出，付给to；preimage为空时退款，交易锁定至超时高度
+	spend := func(signer string, preimage []byte, to string) *qbtx.Transaction {
+		tx := &qbtx.Transaction{
+			TX_vin:  []qbtx.TXInput{{Refer_tx_id: funding, TX_src: address}},
+			TX_vout: []qbtx.TXOutput{{TX_value: 10, TX_dst: to}},
+		}
+		if len(preimage) == 0 {
+			tx.Lock_time = h.Timeout
+		}
+		qkdserv.Node_name = signer
+		sig := tx.ScriptSign(0, signer)
+		if len(preimage) == 0 {
+			tx.TX_vin[0].Unlock_script = qbtx.UnlockHTLCRefund(sig)
+		} else {
+			tx.TX_vin[0].Unlock_script = qbtx.UnlockHTLCClaim(sig, preimage)
+		}
+		tx.TX_id = tx.SetID()
+		qkdserv.Node_name = "P4"
+		return tx
+	}
+	defer func() { qkdserv.Node_name = "P1" }()
+
+	// 接收方在超时前领取
+	claim := spend("P1", preimage, addrP1)
+	if err := ValidateTransaction(claim, view, TargetBlock{Height: 9}); err != nil {
+		t.Errorf("claim before timeout: %v", err)
+	}
+	if err := ValidateTransaction(claim, view, TargetBlock{Height: 10}); !errors.Is(err, qbtx.ErrScriptVerify) {
+		t.Errorf("claim at timeout: got %v, want %v", err, qbtx.ErrScriptVerify)
+	}
+	if err := ValidateTransaction(spend("P1", []byte("wrong"), addrP1), view, TargetBlock{Height: 9}); !errors.Is(err, qbtx.ErrScriptVerify) {
+		t.Errorf("wrong preimage: got %v, want %v", err, qbtx.ErrScriptVerify)
+	}
+	// 发送方超时后退款，交易锁定至超时高度
+	refund := spend("C1", nil, addrC1)
+	if err := ValidateTransaction(refund, view, TargetBlock{Height: 9}); !errors.Is(err, ErrTXLocked) {
+		t.Errorf("refund before timeout: got %v, want %v", err, ErrTXLocked)
+	}
+	if err := ValidateTransaction(refund, view, TargetBlock{Height: 10}); err != nil {
+		t.Errorf("refund at timeout: %v", err)
+	}
+}
+
+func TestValidateScript(t *testing.T) {
+	fmt.Println("----------【UTXO】——outputs locked by scripts and spent with unlocking scripts--------------------------------")
+	script, _ := qbtx.MultiSigScript(2, []string{addrP1, addrP2, addrP3})
+	address := qbwallet.ScriptAddress(script)
+	funding := []byte("script funding")
+	view := mapView{
+		outpointKey(funding, 0): {TX_value: 10, TX_dst: address, Lock_script: script},
+		outpointKey(funding, 1): {TX_value: 10, TX_dst: addrC1},
+	}
+
+	// 付款到脚本：接收方须为脚本导出的地址
+	pay := signedTX(funding, 1, addrC1, 10, address)
+	pay.TX_vout[0].Lock_script = script
+	pay.TX_id = pay.SetID()
+	if err := ValidateTransaction(pay, view, next); !errors.Is(err, qbtx.ErrSignMessageMismatch) { // 签名覆盖锁定脚本
+		t.Errorf("script added after signing: got %v, want %v", err, qbtx.ErrSignMessageMismatch)
+	}
+	pay = &qbtx.Transaction{
+		TX_vin:  []qbtx.TXInput{{Refer_tx_id: funding, Refer_tx_id_index: 1, TX_src: addrC1}},
+		TX_vout: []qbtx.TXOutput{{TX_value: 10, TX_dst: addrP1, Lock_script: script}},
+	}
+	qkdserv.Node_name = "C1"
+	pay.USSTransactionSign("C1")
+	pay.TX_id = pay.SetID()
+	qkdserv.Node_name = "P1"
+	if err := ValidateTransaction(pay, view, next); !errors.Is(err, ErrScriptMismatch) {
+		t.Errorf("script paid to another address: got %v, want %v", err, ErrScriptMismatch)
+	}
+
+	// spend，signers签名后以解锁脚本花费脚本输出
+	spend := func(signers ...string) *qbtx.Transaction {
+		tx := &qbtx.Transaction{
+			TX_vin:  []qbtx.TXInput{{Refer_tx_id: funding, TX_src: address}},
+			TX_vout: []qbtx.TXOutput{{TX_value: 10, TX_dst: addrC1}},
+		}
+		var sigs [][]byte
+		for _, signer := range signers {
+			qkdserv.Node_name = signer
+			sigs = append(sigs, tx.ScriptSign(0, signer))
+		}
+		tx.TX_vin[0].Unlock_script = qbtx.UnlockMultiSig(sigs)
+		tx.TX_id = tx.SetID()
+		qkdserv.Node_name = "P4"
+		return tx
+	}
+	if err := ValidateTransaction(spend("P1", "P3"), view, next); err != nil {
+		t.Errorf("2 of 3: %v", err)
+	}
+	if err := ValidateTransaction(spend("P1"), view, next); !errors.Is(err, qbtx.ErrScriptFailed) {
+		t.Errorf("1 of 3: got %v, want %v", err, qbtx.ErrScriptFailed)
+	}
+	signed := spend("P1", "P2")
+	signed.TX_vin[0].Unlock_script = nil
+	signed.TX_id = signed.SetID()
+	if err := ValidateTransaction(signed, view, next); !errors.Is(err, qbtx.ErrScriptMissing) {
+		t.Errorf("no unlocking script: got %v, want %v", err, qbtx.ErrScriptMissing)
+	}
+
+	// 普通输出不接受解锁脚本，否则可借此跳过签名校验
+	plain := &qbtx.Transaction{
+		TX_vin:  []qbtx.TXInput{{Refer_tx_id: funding, Refer_tx_id_index: 1, TX_src: addrC1, Unlock_script: qbtx.Script{qbtx.OP_TRUE}}},
+		TX_vout: []qbtx.TXOutput{{TX_value: 10, TX_dst: addrP1}},
+	}
+	plain.TX_id = plain.SetID()
+	if err := ValidateTransaction(plain, view, next); !errors.Is(err, qbtx.ErrScriptUnexpected) {
+		t.Errorf("unlocking a plain output: got %v, want %v", err, qbtx.ErrScriptUnexpected)
+	}
+}
+
+// assetTX，以signer身份生成一笔已签名的交易，issue非空时为发行交易；签名写入输入项，因此复制vin
+func assetTX(signer, issue string, vin []qbtx.TXInput, vout []qbtx.TXOutput) *qbtx.Transaction {
+	tx := &qbtx.Transaction{TX_vin: append([]qbtx.TXInput(nil), vin...), TX_vout: vout, Issue_asset: issue}
+	qkdserv.Node_name = signer
+	tx.USSTransactionSign(signer)
+	tx.TX_id = tx.SetID()
+	qkdserv.Node_name = "P4"
+	return tx
+}
+
+func TestValidateAssets(t *testing.T) {
+	fmt.Println("----------【UTXO】——asset outputs, issue transactions and per-asset conservation------------------------------")
+	funding := []byte("asset funding")
+	view := mapView{
+		outpointKey(funding, 0): {TX_value: 10, TX_dst: addrP1},
+		outpointKey(funding, 1): {TX_value: 10, TX_dst: addrC1},
+		outpointKey(funding, 2): {TX_value: 50, TX_dst: addrC1, Asset: "BOND"},
+		outpointKey(funding, 3): {TX_value: 5, TX_dst: addrC1},
+	}
+	fromP1 := []qbtx.TXInput{{Refer_tx_id: funding, TX_src: addrP1}}
+	fromC1 := []qbtx.TXInput{{Refer_tx_id: funding, Refer_tx_id_index: 1, TX_src: addrC1}}
+	bondC1 := []qbtx.TXInput{
+		{Refer_tx_id: funding, Refer_tx_id_index: 2, TX_src: addrC1},
+		{Refer_tx_id: funding, Refer_tx_id_index: 3, TX_src: addrC1},
+	}
+	SetAssetIssuers(map[string]string{"BOND": addrP1, "REPO": addrP2})
+	defer SetAssetIssuers(nil)
+	defer func() { qkdserv.Node_name = "P1" }()
+
+	// 发行：P1为BOND的发行方，增发100 BOND，原生币输入10、输出9，手续费1
+	issue := assetTX("P1", "BOND", fromP1, []qbtx.TXOutput{
+		{TX_value: 100, TX_dst: addrC1, Asset: "BOND"},
+		{TX_value: 9, TX_dst: addrP1},
+	})
+	if fee, err := TransactionFee(issue, view, next); err != nil || fee != 1 {
+		t.Errorf("issue: got %d %v, want 1", fee, err)
+	}
+
+	// 转账：BOND输入50须等于输出50，手续费以原生币支付
+	transfer := assetTX("C1", "", bondC1, []qbtx.TXOutput{
+		{TX_value: 30, TX_dst: addrP2, Asset: "BOND"},
+		{TX_value: 20, TX_dst: addrC1, Asset: "BOND"},
+		{TX_value: 4, TX_dst: addrC1},
+	})
+	if fee, err := TransactionFee(transfer, view, next); err != nil || fee != 1 {
+		t.Errorf("transfer: got %d %v, want 1", fee, err)
+	}
+
+	cases := []struct {
+		name string
+		tx   *qbtx.Transaction
+		want error
+	}{
+		{"not issuer", assetTX("C1", "BOND", fromC1, []qbtx.TXOutput{{TX_value: 100, TX_dst: addrC1, Asset: "BOND"}}), ErrNotIssuer},
+		{"issuer of another asset", assetTX("P1", "REPO", fromP1, []qbtx.TXOutput{{TX_value: 100, TX_dst: addrC1, Asset: "REPO"}}), ErrNotIssuer},
+		{"unknown asset", assetTX("P1", "GOLD", fromP1, []qbtx.TXOutput{{TX_value: 100, TX_dst: addrC1, Asset: "GOLD"}}), ErrUnknownAsset},
+		{"invalid asset id", assetTX("C1", "", fromC1, []qbtx.TXOutput{{TX_value: 10, TX_dst: addrP1, Asset: "bond"}}), ErrInvalidOutput},
+		{"mint without issue", assetTX("C1", "", fromC1, []qbtx.TXOutput{{TX_value: 10, TX_dst: addrP1, Asset: "BOND"}}), ErrAssetNotConserved},
+		{"issue mints only its asset", assetTX("P1", "REPO", fromP1, []qbtx.TXOutput{{TX_value: 1, TX_dst: addrC1, Asset: "BOND"}}), ErrNotIssuer},
+		{"token overspent", assetTX("C1", "", bondC1, []qbtx.TXOutput{{TX_value: 51, TX_dst: addrP2, Asset: "BOND"}, {TX_value: 5, TX_dst: addrC1}}), ErrAssetNotConserved},
+		{"token burnt", assetTX("C1", "", bondC1, []qbtx.TXOutput{{TX_value: 49, TX_dst: addrP2, Asset: "BOND"}, {TX_value: 5, TX_dst: addrC1}}), ErrAssetNotConserved},
+		{"token pays fee", assetTX("C1", "", bondC1, []qbtx.TXOutput{{TX_value: 50, TX_dst: addrP2, Asset: "BOND"}, {TX_value: 6, TX_dst: addrC1}}), ErrInsufficientInput},
+	}
+	for _, c := range cases {
+		if err := ValidateTransaction(c.tx, view, next); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	// 手续费交易只能付原生币
+	fee := qbtx.NewFeeTX(1, addrP1, 1)
+	fee.TX_vout[0].Asset = "BOND"
+	fee.TX_id = fee.SetID()
+	_, errs := ValidateTransactions([]*qbtx.Transaction{fee, transfer}, view, next)
+	if len(errs) != 1 || !errors.Is(errs[0], ErrInvalidOutput) {
+		t.Errorf("asset fee tx: got %v, want %v", errs, ErrInvalidOutput)
+	}
+	fmt.Println("validate asset transactions success")
+}
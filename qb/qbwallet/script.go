@@ -0,0 +1,19 @@
+package qbwallet
+
+import (
+	"qb/base58"
+	"qbtx"
+)
+
+// 脚本地址的前缀版本，与普通地址区分
+const scriptVersion = byte(0x05)
+
+// ScriptAddress，由锁定脚本导出脚本地址，带锁定脚本的输出以该地址为接收方，只能由满足脚本的解锁脚本花费。
+// 多重签名与哈希时间锁合约以qbtx的标准脚本模板表示，其地址即模板生成的锁定脚本的地址
+// 参数：锁定脚本qbtx.Script
+// 返回值：脚本地址string
+func ScriptAddress(script qbtx.Script) string {
+	versionedPayload := append([]byte{scriptVersion}, hashID(script.Hash())...)
+	fullPayload := append(versionedPayload, checksum(versionedPayload)...)
+	return string(base58.Base58Encode(fullPayload))
+}
@@ -101,7 +101,13 @@ func (w *Wallet) saveToFile(nodeName string) {
 
 // ValidateAddress，检验地址合法有效性。反解析
 func ValidateAddress(address string) bool {
+	if len(address) == 0 {
+		return false
+	}
 	addr_hash := base58.Base58Decode([]byte(address))
+	if len(addr_hash) <= 1+addressChecksumLen { // 长度不足，无法取出版本号与校验码
+		return false
+	}
 	actualChecksum := addr_hash[len(addr_hash)-addressChecksumLen:]
 	version := addr_hash[0]
 	addr_hash = addr_hash[1 : len(addr_hash)-addressChecksumLen]
@@ -0,0 +1,258 @@
+package quantumbc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"log"
+	"qb/qbstore"
+	"qblock"
+	"qbtx"
+	"utils"
+)
+
+// 地址索引bucket名称。key均以“地址+0x00”开头，base58地址不含0x00，保证不同地址的key前缀互不包含
+const addrHistoryBucket = "addrhistory" // 地址收支记录，key=地址|高度|交易位置|收支|输入输出编号，value=AddressEvent
+const addrUTXOBucket = "addrutxo"       // 地址未花费输出，key=地址|交易ID|输出编号，value=金额|资产编号，原生币的资产编号为空
+
+// AddressEvent，地址的一条收支记录
+type AddressEvent struct {
+	Height    int64  // 所在区块高度
+	TX_id     []byte // 收款或付款的交易ID
+	Out_tx_id []byte // 收到或花费的输出所在交易ID，收款时与TX_id相同
+	Out_index int    // 收到或花费的输出编号
+	Value     int    // 金额
+	Spent     bool   // true为付款（花费输出），false为收款
+	Asset     string `json:",omitempty"` // 资产编号，原生币为空
+}
+
+// AddressUTXO，地址的一个未花费输出
+type AddressUTXO struct {
+	TX_id       []byte // 输出所在交易ID
+	Index       int    // 输出编号
+	Value       int    // 金额
+	Unconfirmed bool   `json:",omitempty"` // 交易池中尚未上链的输出，账本查询结果中恒为false
+	Asset       string `json:",omitempty"` // 资产编号，原生币为空
+}
+
+// addressPrefix，地址索引key前缀
+func addressPrefix(address string) []byte {
+	return append([]byte(address), 0)
+}
+
+// addrUTXOKey，地址未花费输出的key
+func addrUTXOKey(address string, txid []byte, index int) []byte {
+	key := append(addressPrefix(address), txid...)
+	return append(key, utils.IntToHex(int64(index))...)
+}
+
+// addrUTXOValue，地址未花费输出的value：金额与资产编号，原生币输出与只记录金额的旧数据相同
+func addrUTXOValue(out qbtx.TXOutput) []byte {
+	return append(utils.IntToHex(int64(out.TX_value)), out.Asset...)
+}
+
+// addrHistoryKey，地址收支记录的key，按高度与交易位置排序，同一交易先记付款再记收款
+func addrHistoryKey(address string, height int64, pos int, spent bool, index int) []byte {
+	kind := byte(1)
+	if spent {
+		kind = 0
+	}
+	key := append(addressPrefix(address), utils.IntToHex(height)...)
+	key = append(key, utils.IntToHex(int64(pos))...)
+	key = append(key, kind)
+	return append(key, utils.IntToHex(int64(index))...)
+}
+
+// lookupOutput，通过交易索引查找已上链交易的输出
+// 参数：数据库事务，交易ID[]byte，输出编号int，已读取区块的缓存
+// 返回值：输出项，是否存在bool
+func lookupOutput(tx qbstore.Tx, txid []byte, index int, cache map[string]*qblock.Block) (qbtx.TXOutput, bool) {
+	locData := tx.Bucket(txindexBucket).Get(txid)
+	if locData == nil {
+		return qbtx.TXOutput{}, false
+	}
+	loc := deserializeTXLocation(locData)
+	block, ok := cache[string(loc.Block_hash)]
+	if !ok {
+		blockData := tx.Bucket(blocksBucket).Get(loc.Block_hash)
+		if blockData == nil {
+			return qbtx.TXOutput{}, false
+		}
+		block = qblock.DeserializeBlock(blockData)
+		cache[string(loc.Block_hash)] = block
+	}
+	outs := block.Transactions[loc.Index].TX_vout
+	if index < 0 || index >= len(outs) {
+		return qbtx.TXOutput{}, false
+	}
+	return outs[index], true
+}
+
+// indexAddresses，依据新连接的区块更新地址索引：记录花费与收到的输出，并维护各地址的未花费输出。
+// 被花费输出的地址与金额优先取自区块的撤销数据，也包括快照基准高度之前创建的输出；
+// 没有撤销数据的旧区块须在区块与交易索引写入之后调用，以便通过交易索引查到
+// 参数：数据库读写事务，区块
+// 返回值：错误error
+func indexAddresses(tx qbstore.Tx, block *qblock.Block) error {
+	history := tx.Bucket(addrHistoryBucket)
+	utxo := tx.Bucket(addrUTXOBucket)
+	cache := map[string]*qblock.Block{string(block.Hash): block}
+	var undo []SpentOutput // 按输入顺序记录的被花费输出
+	if data := tx.Bucket(undoBucket).Get(block.Hash); data != nil {
+		undo = deserializeUndo(data)
+	}
+
+	for pos, transaction := range block.Transactions {
+		if !transaction.IsReserveTX() && !transaction.IsFeeTX() {
+			for i, vin := range transaction.TX_vin {
+				var out qbtx.TXOutput
+				if len(undo) > 0 {
+					out, undo = undo[0].Output, undo[1:]
+				} else {
+					var ok bool
+					if out, ok = lookupOutput(tx, vin.Refer_tx_id, vin.Refer_tx_id_index, cache); !ok {
+						continue
+					}
+				}
+				event := AddressEvent{block.Height, transaction.TX_id, vin.Refer_tx_id, vin.Refer_tx_id_index, out.TX_value, true, out.Asset}
+				err := history.Put(addrHistoryKey(out.TX_dst, block.Height, pos, true, i), event.serialize())
+				if err != nil {
+					return err
+				}
+				err = utxo.Delete(addrUTXOKey(out.TX_dst, vin.Refer_tx_id, vin.Refer_tx_id_index))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for i, out := range transaction.TX_vout {
+			event := AddressEvent{block.Height, transaction.TX_id, transaction.TX_id, i, out.TX_value, false, out.Asset}
+			err := history.Put(addrHistoryKey(out.TX_dst, block.Height, pos, false, i), event.serialize())
+			if err != nil {
+				return err
+			}
+			err = utxo.Put(addrUTXOKey(out.TX_dst, transaction.TX_id, i), addrUTXOValue(out))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexAllAddresses，为没有地址索引的旧账本补建索引：按高度自创世区块向后遍历，须在高度与交易索引补建之后调用
+// 参数：数据库读写事务
+// 返回值：错误error
+func indexAllAddresses(tx qbstore.Tx) error {
+	if tx.Bucket(addrHistoryBucket) != nil && tx.Bucket(addrUTXOBucket) != nil {
+		return nil
+	}
+	for _, bucket := range []string{addrHistoryBucket, addrUTXOBucket} {
+		if err := tx.DeleteBucket(bucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+			return err
+		}
+	}
+	b := tx.Bucket(blocksBucket)
+	c := tx.Bucket(heightsBucket).Cursor()
+	for _, hash := c.First(); hash != nil; _, hash = c.Next() { // 高度以大端序存储，游标按高度递增遍历
+		if err := indexAddresses(tx, qblock.DeserializeBlock(b.Get(hash))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBalance，通过地址索引查询原生币余额，只读取该地址的未花费输出
+// 参数：钱包地址string
+// 返回值：余额int
+func (bc *Blockchain) GetBalance(address string) int {
+	return bc.GetBalances(address)[""]
+}
+
+// GetBalances，通过地址索引查询各资产的余额
+// 参数：钱包地址string
+// 返回值：资产编号到余额的map[string]int，原生币的编号为空
+func (bc *Blockchain) GetBalances(address string) map[string]int {
+	balances := make(map[string]int)
+	for _, out := range bc.GetAddressUTXO(address) {
+		balances[out.Asset] += out.Value
+	}
+	return balances
+}
+
+// GetAddressUTXO，通过地址索引查询地址的全部未花费输出
+// 参数：钱包地址string
+// 返回值：未花费输出[]AddressUTXO
+func (bc *Blockchain) GetAddressUTXO(address string) []AddressUTXO {
+	var utxos []AddressUTXO
+	prefix := addressPrefix(address)
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		c := tx.Bucket(addrUTXOBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			utxos = append(utxos, AddressUTXO{
+				TX_id: append([]byte{}, k[len(prefix):len(k)-8]...),
+				Index: int(binary.BigEndian.Uint64(k[len(k)-8:])),
+				Value: int(binary.BigEndian.Uint64(v[:8])),
+				Asset: string(v[8:]),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	return utxos
+}
+
+// GetAddressHistory，分页查询地址的收支记录，按时间由新到旧排列
+// 参数：钱包地址string，跳过的记录数int，本页最多记录数int
+// 返回值：本页记录[]AddressEvent，记录总数int
+func (bc *Blockchain) GetAddressHistory(address string, offset, limit int) ([]AddressEvent, int) {
+	var events []AddressEvent
+	total := 0
+	prefix := addressPrefix(address)
+	end := append([]byte(address), 1) // 该地址全部key之后的第一个key
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		c := tx.Bucket(addrHistoryBucket).Cursor()
+		k, v := c.Seek(end)
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+			if total >= offset && len(events) < limit {
+				events = append(events, deserializeAddressEvent(v))
+			}
+			total++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	return events, total
+}
+
+// serialize，收支记录序列化
+func (e AddressEvent) serialize() []byte {
+	var buff bytes.Buffer
+	err := gob.NewEncoder(&buff).Encode(e)
+	if err != nil {
+		log.Panic(err)
+	}
+	return buff.Bytes()
+}
+
+// deserializeAddressEvent，收支记录反序列化
+func deserializeAddressEvent(d []byte) AddressEvent {
+	var e AddressEvent
+	err := gob.NewDecoder(bytes.NewReader(d)).Decode(&e)
+	if err != nil {
+		log.Panic(err)
+	}
+	return e
+}
@@ -1,86 +1,133 @@
 package quantumbc
 
 import (
+	"bytes"
+	"encoding/gob"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"qb/qbstore"
+	"qb/qbvalidate"
 	"qblock"
 	"qbtx"
-
-	"github.com/boltdb/bolt"
+	"sync"
+	"utils"
 )
 
-// 数据库路径及名称
-const DBFile = "/root/study/github_repository/qb/quantumbc/DB/blockchain_%s.db"
+// 数据目录，存放各节点的账本文件，可由环境变量QB_DATA_DIR指定
+var Data_dir = "../data/"
 
 // bucket名称
 const blocksBucket = "blocks"
+const headersBucket = "headers" // 区块头，key=区块hash，value=区块头
+const utxoBucket = "chainstate"
+const heightsBucket = "heights" // 高度索引，key=区块高度，value=区块hash
+const txindexBucket = "txindex" // 交易索引，key=交易ID，value=交易位置TXLocation
+
+// blocksBucket中记录创世区块hash的key
+const genesisKey = "genesis"
+
+// 索引中查找不到区块或交易
+var (
+	ErrBlockNotFound = errors.New("block is not found")
+	ErrTXNotFound    = errors.New("transaction is not found")
+	ErrBlockCorrupt  = errors.New("stored block cannot be decoded or does not match its key")
+	ErrIndexMismatch = errors.New("index entry differs from the stored block")
+)
 
-// 创世区块留言
-const genesisReservebaseData = "The Times 27/Sept/2021 Reserve is made"
+// TXLocation，交易在区块链中的位置
+type TXLocation struct {
+	Block_hash []byte // 所在区块hash
+	Height     int64  // 所在区块高度
+	Index      int    // 在区块交易中的位置
+}
 
 // Blockchain implements interactions with a DB
+// 同一Blockchain可由多个线程共享：写入账本的操作依次执行，读取操作可并发
 type Blockchain struct {
-	tip []byte   // 存储区块链的tail的Block的Hash，提供了一种快速找到区块链中末位Block的方式，在区块链的遍历中非常有用
-	DB  *bolt.DB // blot数据库，下一层bucket（类似于数据库中的表），bucket下是键值对
+	tip []byte        // 存储区块链的tail的Block的Hash，提供了一种快速找到区块链中末位Block的方式，在区块链的遍历中非常有用
+	DB  qbstore.Store // 账本存储，下一层bucket（类似于数据库中的表），bucket下是键值对
+
+	write sync.Mutex   // 写入账本（连接、断开区块，重建UTXO）时持有，保证校验与写入之间账本不变
+	mu    sync.RWMutex // 保护tip
+}
+
+// DBPath，节点账本文件路径
+// 参数：节点名称string
+// 返回值：数据目录下的账本文件路径
+func DBPath(nodeID string) string {
+	return filepath.Join(Data_dir, fmt.Sprintf("blockchain_%s.db", nodeID))
 }
 
-// CreateBlockchain,创建区块链结构，初始化时只有创世区块
-func CreateBlockchain(addresses []string, nodeID string) *Blockchain {
+// CreateBlockchain,在数据目录中创建节点的账本文件，初始化时只有分发的创世区块
+func CreateBlockchain(genesis *qblock.Block, nodeID string) *Blockchain {
 	// 定义区块链数据库名称
-	dbFile := fmt.Sprintf(DBFile, nodeID)
+	dbFile := DBPath(nodeID)
 
 	// 只能第一次创建，所以需要查找是否存在相应的区块链数据库文件
 	if DBExists(dbFile) {
 		fmt.Println("Blockchain already exists.")
 		return nil
-	} else {
-		var tip []byte
-		reserve_tx := qbtx.NewReserveTX(addresses, genesisReservebaseData) // 发放准备金
-		genesis := qblock.NewGenesisBlock(reserve_tx)                      // 创建创世区块
+	}
+	// 不存在区块链则创建数据库文件
+	store, err := qbstore.OpenBolt(dbFile)
+	if err != nil {
+		log.Panic(err)
+	}
+	return InitBlockchain(store, genesis)
+}
 
-		// 1.不存在区块链则创建数据库文件，0600，仅限本用户可读可写
-		db, err := bolt.Open(dbFile, 0600, nil)
+// InitBlockchain，在空的存储中创建区块链：写入创世区块并建立各项索引
+// 参数：存储qbstore.Store，创世区块
+// 返回值：区块链*Blockchain
+func InitBlockchain(store qbstore.Store, genesis *qblock.Block) *Blockchain {
+	// 更新数据库，插入数据库数据
+	err := store.Update(func(tx qbstore.Tx) error {
+		// 创建bucket
+		b, err := tx.CreateBucketIfNotExists(blocksBucket)
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
-
-		// 2.更新数据库，插入数据库数据
-		err = db.Update(func(tx *bolt.Tx) error {
-			// 创建bucket
-			b, err := tx.CreateBucket([]byte(blocksBucket)) // bolt包函数
-			if err != nil {
-				log.Panic(err)
-			}
-			// 设置key-value
-			err = b.Put(genesis.Hash, genesis.SerializeBlock())
-			if err != nil {
-				log.Panic(err)
-			}
-			// 设置key-value，存储最新区块链哈希
-			err = b.Put([]byte("last"), genesis.Hash)
+		// 设置key-value
+		err = b.Put(genesis.Hash, genesis.SerializeBlock())
+		if err != nil {
+			return err
+		}
+		// 设置key-value，存储最新区块链哈希
+		err = b.Put([]byte("last"), genesis.Hash)
+		if err != nil {
+			return err
+		}
+		// 记录创世区块hash，启动时与分发的创世区块比对
+		err = b.Put([]byte(genesisKey), genesis.Hash)
+		if err != nil {
+			return err
+		}
+		// 单独存储区块头，建立高度、交易与地址索引
+		buckets := []string{headersBucket, heightsBucket, txindexBucket, utxoBucket, undoBucket, addrHistoryBucket, addrUTXOBucket}
+		for _, bucket := range buckets {
+			_, err = tx.CreateBucketIfNotExists(bucket)
 			if err != nil {
-				log.Panic(err)
+				return err
 			}
-			tip = genesis.Hash
-
-			return nil
-		})
-		if err != nil {
-			log.Panic(err)
 		}
-		bc := Blockchain{tip, db} // 记录blockchain信息
-		// log.Println("Create blockChain success")
-		return &bc
+		return connectBlock(tx, genesis)
+	})
+	if err != nil {
+		log.Panic(err)
 	}
+	bc := Blockchain{tip: genesis.Hash, DB: store} // 记录blockchain信息
+	return &bc
 }
 
 // 打印区块链
 func PrintBlockChain(nodeID string) {
 	bc := NewBlockchain(nodeID) // 1.获取当前区块链信息
 	bci := bc.Iterator()        // 2.设置迭代器
+	base := bc.BaseHeight()     // 从快照启动的账本只打印至基准高度
 	for {
 		b := bci.Next()                                                                                 // 3.获取当前区块信息，并变更为前一区块以迭代
 		fmt.Printf("========================= Block %d ==================================\n", b.Height) // 4，打印当前区块信息
@@ -95,36 +142,55 @@ func PrintBlockChain(nodeID string) {
 		}
 		fmt.Printf("\n\n")
 
-		if len(b.Prev_block_hash) == 0 { // 遍历数据库至创世区块
+		if len(b.Prev_block_hash) == 0 || b.Height <= base { // 遍历数据库至创世区块
 			break
 		}
 	}
 	bc.DB.Close()
 }
 
-// NewBlockchain,读取当前区块
+// NewBlockchain,读取数据目录中节点的账本文件
 func NewBlockchain(nodeID string) *Blockchain {
-	dbFile := fmt.Sprintf(DBFile, nodeID)
+	dbFile := DBPath(nodeID)
 	// 判断账本/数据库是否存在
 	if !DBExists(dbFile) {
 		fmt.Println("No existing blockchain found. Please create one first.")
 		os.Exit(1)
 	}
 
-	var tip []byte
-	db, err := bolt.Open(dbFile, 0600, nil) // 1.打开数据库文件
+	store, err := qbstore.OpenBolt(dbFile) // 打开数据库文件
 	if err != nil {
 		log.Panic(err)
 	}
-	err = db.Update(func(tx *bolt.Tx) error { // 2.更新数据库
-		b := tx.Bucket([]byte(blocksBucket)) // 获取bucket
-		tip = b.Get([]byte("last"))          // 获取最新区块指针。不是第一次使用，之前有块，所以此时不需要作判断
-		return nil
+	return LoadBlockchain(store)
+}
+
+// LoadBlockchain，从已有账本的存储中读取区块链，为旧账本补建区块头、高度、交易与地址索引
+// 参数：存储qbstore.Store
+// 返回值：区块链*Blockchain
+func LoadBlockchain(store qbstore.Store) *Blockchain {
+	var tip []byte
+	err := store.Update(func(tx qbstore.Tx) error { // 更新数据库
+		b := tx.Bucket(blocksBucket) // 获取bucket
+		tip = b.Get([]byte("last"))  // 获取最新区块指针。不是第一次使用，之前有块，所以此时不需要作判断
+		err := indexHeaders(tx)      // 旧账本没有区块头bucket时补建
+		if err != nil {
+			return err
+		}
+		err = indexBlocks(tx) // 旧账本没有高度与交易索引时补建
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(undoBucket) // 旧账本的区块没有撤销数据，此后连接的区块才可断开
+		if err != nil {
+			return err
+		}
+		return indexAllAddresses(tx) // 旧账本没有地址索引时补建
 	})
 	if err != nil {
 		log.Panic(err)
 	}
-	bc := Blockchain{tip, db} // 记录blockchain信息
+	bc := Blockchain{tip: tip, DB: store} // 记录blockchain信息
 	return &bc
 }
 
@@ -138,42 +204,61 @@ func (bc *Blockchain) FindUTXO() map[string]qbtx.TXOutputs {
 
 	for { // 迭代区块
 		block := bci.Next() // 从最后一区块逐一向前迭代
+		collectUTXO(block, UTXO, spentTXOs)
 
-		for _, tx := range block.Transactions { // 遍历当前区块存储的交易信息
-			txID := hex.EncodeToString(tx.TX_id) // 转换为string格式
+		if len(block.Prev_block_hash) == 0 { // 迭代至创世区块，结束遍历
+			break
+		}
+	}
+	return UTXO
+}
 
-		Outputs: // label语法，适用于多级嵌套
-			for outIdx, out := range tx.TX_vout { // 遍历该交易信息的交易输出
-				if spentTXOs[txID] != nil { // 如果交易已经被花费，直接跳过此交易
-					for _, spentOutIdx := range spentTXOs[txID] {
-						if spentOutIdx == outIdx {
-							continue Outputs // continue label跳出当前该次的循环圈，立马跳到label处继续上一层的下一次循环操作
-						}
+// collectUTXO，自最新区块向前遍历时处理一个区块：记录区块中尚未被后续区块花费的输出，以及本区块花费的输出
+// 参数：区块，已收集的未花费输出，已花费的输出（key:txID,value:输出编号）
+func collectUTXO(block *qblock.Block, UTXO map[string]qbtx.TXOutputs, spentTXOs map[string][]int) {
+	for i := len(block.Transactions) - 1; i >= 0; i-- { // 逆序遍历当前区块存储的交易信息，使区块内后续交易的花费先被记录
+		tx := block.Transactions[i]
+		txID := hex.EncodeToString(tx.TX_id) // 转换为string格式
+
+	Outputs: // label语法，适用于多级嵌套
+		for outIdx, out := range tx.TX_vout { // 遍历该交易信息的交易输出
+			if spentTXOs[txID] != nil { // 如果交易已经被花费，直接跳过此交易
+				for _, spentOutIdx := range spentTXOs[txID] {
+					if spentOutIdx == outIdx {
+						continue Outputs // continue label跳出当前该次的循环圈，立马跳到label处继续上一层的下一次循环操作
 					}
 				}
-				// 如果交易未被花费，则放入UTXO
-				outs := UTXO[txID]
-				outs.Outputs = append(outs.Outputs, out)
-				UTXO[txID] = outs
 			}
+			// 如果交易未被花费，则放入UTXO
+			outs := UTXO[txID]
+			outs.Height = block.Height
+			outs.Outputs = append(outs.Outputs, out)
+			outs.Index = append(outs.Index, outIdx) // 记录原交易中的输出编号
+			UTXO[txID] = outs
+		}
 
-			if !tx.IsReserveTX() { // 如果该交易信息不是准备金发放交易
-				for _, in := range tx.TX_vin {
-					inTxID := hex.EncodeToString(in.Refer_tx_id)
-					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Refer_tx_id_index)
-				}
+		if !tx.IsReserveTX() && !tx.IsFeeTX() { // 如果该交易信息不是准备金发放交易或手续费交易
+			for _, in := range tx.TX_vin {
+				inTxID := hex.EncodeToString(in.Refer_tx_id)
+				spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Refer_tx_id_index)
 			}
 		}
+	}
+}
 
-		if len(block.Prev_block_hash) == 0 { // 迭代至创世区块，结束遍历
-			break
-		}
+// HeaderIterator,构造只遍历区块头的迭代器，不读取区块交易
+func (bc *Blockchain) HeaderIterator() HeaderIterator {
+	hi := HeaderIterator{ // 初始为最新区块
+		currentHash: bc.GetlastHash(),
+		db:          bc.DB,
 	}
-	return UTXO
+	return hi
 }
 
 // Iterator,通过blockchain构造迭代器
 func (bc *Blockchain) Iterator() BlockchainIterator {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 	bci := BlockchainIterator{ // 初始为最新区块
 		currentHash: bc.tip,
 		db:          bc.DB,
@@ -181,87 +266,227 @@ func (bc *Blockchain) Iterator() BlockchainIterator {
 	return bci
 }
 
-// AddBlock，向区块链中添加新区块
-func (bc *Blockchain) AddBlock(block *qblock.Block) {
-	var tip []byte
-	var lastblock *qblock.Block
-	err := bc.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		tip = b.Get([]byte("last"))
-		blockData := b.Get(tip)
-		lastblock = qblock.DeserializeBlock(blockData)
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
+// AddBlock，校验新区块并将其添加到区块链：区块须衔接当前最新区块，且通过qbvalidate.ValidateBlock的完整校验
+// 参数：新区块
+// 返回值：校验错误error（*qbvalidate.BlockError）或UTXO更新错误，区块未写入账本；成功时为nil
+func (bc *Blockchain) AddBlock(block *qblock.Block) error {
+	bc.write.Lock()
+	defer bc.write.Unlock()
+	if err := qbvalidate.ValidateBlock(block, bc.GetlastHeader(), bc); err != nil {
+		return err
 	}
-	if block.Height > lastblock.Height {
-		err = bc.DB.Update(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte(blocksBucket))
-			err := b.Put(block.Hash, block.SerializeBlock())
-			if err != nil {
-				log.Panic(err)
-			}
 
-			err = b.Put([]byte("last"), block.Hash)
-			if err != nil {
-				log.Panic(err)
-			}
+	err := bc.DB.Update(func(tx qbstore.Tx) error {
+		b := tx.Bucket(blocksBucket)
+		err := b.Put(block.Hash, block.SerializeBlock())
+		if err != nil {
+			log.Panic(err)
+		}
 
-			bc.tip = block.Hash
-			return nil
-		})
+		err = b.Put([]byte("last"), block.Hash)
 		if err != nil {
 			log.Panic(err)
 		}
+
+		return connectBlock(tx, block) // 更新索引与UTXO集合，失败时整个区块回滚
+	})
+	if err != nil {
+		return err
+	}
+	bc.setTip(block.Hash)
+	return nil
+}
+
+// setTip，更新最新区块指针
+func (bc *Blockchain) setTip(hash []byte) {
+	bc.mu.Lock()
+	bc.tip = hash
+	bc.mu.Unlock()
+}
+
+// indexHeaders，为没有区块头bucket的旧账本补建区块头：自最新区块向前遍历全部区块
+// 参数：数据库读写事务
+// 返回值：错误error
+func indexHeaders(tx qbstore.Tx) error {
+	if tx.Bucket(headersBucket) != nil {
+		return nil
+	}
+	h, err := tx.CreateBucketIfNotExists(headersBucket)
+	if err != nil {
+		return err
+	}
+	b := tx.Bucket(blocksBucket)
+	for hash := b.Get([]byte("last")); len(hash) != 0; {
+		block := qblock.DeserializeBlock(b.Get(hash))
+		if err := h.Put(hash, block.Header().SerializeHeader()); err != nil {
+			return err
+		}
+		hash = block.Prev_block_hash
+	}
+	return nil
+}
+
+// indexBlocks，为没有高度与交易索引的旧账本补建索引：自最新区块向前遍历全部区块
+// 参数：数据库读写事务
+// 返回值：错误error
+func indexBlocks(tx qbstore.Tx) error {
+	if tx.Bucket(heightsBucket) != nil && tx.Bucket(txindexBucket) != nil {
+		return nil
+	}
+	for _, bucket := range []string{heightsBucket, txindexBucket} {
+		if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+			return err
+		}
+	}
+	b := tx.Bucket(blocksBucket)
+	for hash := b.Get([]byte("last")); len(hash) != 0; {
+		block := qblock.DeserializeBlock(b.Get(hash))
+		if err := indexBlock(tx, block); err != nil {
+			return err
+		}
+		hash = block.Prev_block_hash
+	}
+	return nil
+}
+
+// connectBlock，区块写入账本后在同一事务中更新各项索引与UTXO集合，任一步失败则整个区块不写入
+// 参数：数据库读写事务，区块
+// 返回值：错误error
+func connectBlock(tx qbstore.Tx, block *qblock.Block) error {
+	if err := indexBlock(tx, block); err != nil {
+		return err
+	}
+	if err := connectUTXO(tx, block); err != nil {
+		return err
 	}
+	return indexAddresses(tx, block)
 }
 
-// GetBestHeight returns the height of the latest block
+// indexBlock，写入区块的区块头、高度索引与交易索引
+// 参数：数据库读写事务，区块
+// 返回值：错误error
+func indexBlock(tx qbstore.Tx, block *qblock.Block) error {
+	err := tx.Bucket(headersBucket).Put(block.Hash, block.Header().SerializeHeader())
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(heightsBucket).Put(utils.IntToHex(block.Height), block.Hash)
+	if err != nil {
+		return err
+	}
+	t := tx.Bucket(txindexBucket)
+	for i, transaction := range block.Transactions {
+		loc := TXLocation{Block_hash: block.Hash, Height: block.Height, Index: i}
+		if err = t.Put(transaction.TX_id, loc.serialize()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serialize，交易位置序列化
+func (loc TXLocation) serialize() []byte {
+	var buff bytes.Buffer
+	err := gob.NewEncoder(&buff).Encode(loc)
+	if err != nil {
+		log.Panic(err)
+	}
+	return buff.Bytes()
+}
+
+// deserializeTXLocation，交易位置反序列化
+func deserializeTXLocation(d []byte) TXLocation {
+	var loc TXLocation
+	err := gob.NewDecoder(bytes.NewReader(d)).Decode(&loc)
+	if err != nil {
+		log.Panic(err)
+	}
+	return loc
+}
+
+// GetlastHeight，获取最新区块高度，只读取区块头
 func (bc *Blockchain) GetlastHeight() int64 {
-	var lastBlock *qblock.Block
+	return bc.GetlastHeader().Height
+}
 
-	err := bc.DB.View(func(tx *bolt.Tx) error { // 查询账本
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash := b.Get([]byte("last"))
-		blockData := b.Get(lastHash)
-		lastBlock = qblock.DeserializeBlock(blockData)
+// GetlastHash，获取最新区块hash
+func (bc *Blockchain) GetlastHash() []byte {
+	var lastHash []byte
+
+	err := bc.DB.View(func(tx qbstore.Tx) error { // 查询账本
+		b := tx.Bucket(blocksBucket)
+		lastHash = b.Get([]byte("last"))
 		return nil
 	})
 	if err != nil {
 		log.Panic(err)
 	}
-	return lastBlock.Height
+	return lastHash
 }
 
-//
-func (bc *Blockchain) GetlastHash() []byte {
-	var lastBlock *qblock.Block
+// GetlastHeader，获取最新区块的区块头
+func (bc *Blockchain) GetlastHeader() *qblock.BlockHeader {
+	header, err := bc.GetHeader(bc.GetlastHash())
+	if err != nil {
+		log.Panic(err)
+	}
+	return header
+}
 
-	err := bc.DB.View(func(tx *bolt.Tx) error { // 查询账本
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash := b.Get([]byte("last"))
-		blockData := b.Get(lastHash)
-		lastBlock = qblock.DeserializeBlock(blockData)
+// GetGenesisHash，获取账本的创世区块hash；未记录创世区块hash的旧账本沿区块头回溯到高度0
+func (bc *Blockchain) GetGenesisHash() []byte {
+	var genesisHash []byte
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		genesisHash = tx.Bucket(blocksBucket).Get([]byte(genesisKey))
 		return nil
 	})
 	if err != nil {
 		log.Panic(err)
 	}
-	return lastBlock.Hash
+	if len(genesisHash) != 0 {
+		return genesisHash
+	}
+	hi := bc.HeaderIterator()
+	for {
+		header := hi.Next()
+		if len(header.Prev_block_hash) == 0 {
+			return header.Hash
+		}
+	}
+}
+
+// GetHeader，根据区块hash获取区块头，不读取区块交易
+// 参数：区块hash[]byte
+// 返回值：区块头*qblock.BlockHeader，区块不存在时返回error
+func (bc *Blockchain) GetHeader(blockHash []byte) (*qblock.BlockHeader, error) {
+	var header *qblock.BlockHeader
+
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		headerData := tx.Bucket(headersBucket).Get(blockHash)
+		if headerData == nil {
+			return errors.New("block header is not found")
+		}
+		header = qblock.DeserializeHeader(headerData)
+		return nil
+	})
+	return header, err
 }
 
 // GetBlock finds a block by its hash and returns it
+// 区块不存在时返回ErrBlockNotFound；只保留区块头（已修剪或早于快照）时返回ErrNoHistory
 func (bc *Blockchain) GetBlock(blockHash []byte) (*qblock.Block, error) {
 	var block *qblock.Block
 
-	err := bc.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		b := tx.Bucket(blocksBucket)
 
 		blockData := b.Get(blockHash)
 
 		if blockData == nil {
-			return errors.New("block is not found")
+			if headerData := tx.Bucket(headersBucket).Get(blockHash); headerData != nil {
+				return fmt.Errorf("%w: block %d", ErrNoHistory, qblock.DeserializeHeader(headerData).Height)
+			}
+			return ErrBlockNotFound
 		}
 
 		block = qblock.DeserializeBlock(blockData)
@@ -275,17 +500,151 @@ func (bc *Blockchain) GetBlock(blockHash []byte) (*qblock.Block, error) {
 	return block, nil
 }
 
+// GetUTXO，从chainstate中查询未花费输出，使区块链可作为区块校验的UTXO视图
+// 参数：交易ID[]byte，输出编号int
+// 返回值：输出项，是否存在且未花费bool
+func (bc *Blockchain) GetUTXO(txid []byte, index int) (qbtx.TXOutput, bool) {
+	var out qbtx.TXOutput
+	var ok bool
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		b := tx.Bucket(utxoBucket)
+		if b == nil {
+			return nil
+		}
+		outsBytes := b.Get(txid)
+		if outsBytes == nil {
+			return nil
+		}
+		out, ok = qbtx.DeserializeOutputs(outsBytes).GetOutput(index)
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	return out, ok
+}
+
+// UTXOHeight，查询交易的未花费输出所在区块的高度，用于校验输出的相对锁定
+// 参数：交易ID[]byte
+// 返回值：区块高度int64，交易没有未花费输出时返回false
+func (bc *Blockchain) UTXOHeight(txid []byte) (int64, bool) {
+	var height int64
+	var ok bool
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		b := tx.Bucket(utxoBucket)
+		if b == nil {
+			return nil
+		}
+		if outsBytes := b.Get(txid); outsBytes != nil {
+			height, ok = qbtx.DeserializeOutputs(outsBytes).Height, true
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	return height, ok
+}
+
+// GetBlockByHeight，根据高度查询区块，通过高度索引定位，无需遍历区块链
+// 参数：区块高度int64
+// 返回值：区块*qblock.Block，高度超出当前区块链时返回ErrBlockNotFound
+func (bc *Blockchain) GetBlockByHeight(height int64) (*qblock.Block, error) {
+	var blockHash []byte
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		blockHash = tx.Bucket(heightsBucket).Get(utils.IntToHex(height))
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	if blockHash == nil {
+		return nil, ErrBlockNotFound
+	}
+	return bc.GetBlock(blockHash)
+}
+
+// GetHeaderByHeight，根据高度查询区块头，已修剪或早于快照的区块也保留区块头
+// 参数：区块高度int64
+// 返回值：区块头*qblock.BlockHeader，高度超出当前区块链时返回ErrBlockNotFound
+func (bc *Blockchain) GetHeaderByHeight(height int64) (*qblock.BlockHeader, error) {
+	var headerData []byte
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		blockHash := tx.Bucket(heightsBucket).Get(utils.IntToHex(height))
+		if blockHash != nil {
+			headerData = tx.Bucket(headersBucket).Get(blockHash)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	if headerData == nil {
+		return nil, ErrBlockNotFound
+	}
+	return qblock.DeserializeHeader(headerData), nil
+}
+
+// GetTransaction，根据交易ID查询已上链的交易及其位置，通过交易索引定位，无需遍历区块链
+// 参数：交易ID[]byte
+// 返回值：交易*qbtx.Transaction，交易位置TXLocation，交易不存在时返回ErrTXNotFound
+func (bc *Blockchain) GetTransaction(txid []byte) (*qbtx.Transaction, TXLocation, error) {
+	var locData []byte
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		locData = tx.Bucket(txindexBucket).Get(txid)
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	if locData == nil {
+		return nil, TXLocation{}, ErrTXNotFound
+	}
+	loc := deserializeTXLocation(locData)
+	block, err := bc.GetBlock(loc.Block_hash)
+	if err != nil {
+		return nil, loc, err
+	}
+	return block.Transactions[loc.Index], loc, nil
+}
+
+// HasTransaction，查询交易是否已上链，使区块校验可拒绝与已上链交易ID相同的交易
+// 参数：交易ID[]byte
+// 返回值：交易是否在交易索引中bool
+func (bc *Blockchain) HasTransaction(txid []byte) bool {
+	var found bool
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		found = tx.Bucket(txindexBucket).Get(txid) != nil
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	return found
+}
+
+// FindTransaction，查找包含指定交易的区块
+// 参数：交易ID[]byte
+// 返回值：区块*qblock.Block，交易不存在时返回ErrTXNotFound
+func (bc *Blockchain) FindTransaction(txid []byte) (*qblock.Block, error) {
+	_, loc, err := bc.GetTransaction(txid)
+	if err != nil {
+		return nil, err
+	}
+	return bc.GetBlock(loc.Block_hash)
+}
+
 // GetBlockHashes returns a list of hashes of all the blocks in the chain
 func (bc *Blockchain) GetBlockHashes() [][]byte {
 	var blocks [][]byte
-	bci := bc.Iterator()
+	hi := bc.HeaderIterator()
 
 	for {
-		block := bci.Next()
+		header := hi.Next()
 
-		blocks = append(blocks, block.Hash)
+		blocks = append(blocks, header.Hash)
 
-		if len(block.Prev_block_hash) == 0 {
+		if len(header.Prev_block_hash) == 0 {
 			break
 		}
 	}
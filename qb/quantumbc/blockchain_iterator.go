@@ -1,35 +1,76 @@
 package quantumbc
 
 import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
 	"log"
+	"qb/qbstore"
 	"qblock"
-
-	"github.com/boltdb/bolt"
 )
 
 // BlockchainIterator，迭代器
 type BlockchainIterator struct {
-	currentHash []byte   // 当前区块hash
-	db          *bolt.DB // 已经打开的数据库
+	currentHash []byte        // 当前区块hash
+	db          qbstore.Store // 已经打开的数据库
 }
 
 // Next,获取当前区块
 func (i *BlockchainIterator) Next() *qblock.Block {
-	var b *qblock.Block
+	b, err := i.NextBlock()
+	if err != nil {
+		log.Panic(err)
+	}
+	// 返回区块
+	return b
+}
+
+// NextBlock，获取当前区块，区块缺失、无法解码或hash与存储的key不符时返回error而不中止程序，用于审计账本
+func (i *BlockchainIterator) NextBlock() (*qblock.Block, error) {
+	var b qblock.Block
 	// 根据hash获取块数据
-	err := i.db.View(func(tx *bolt.Tx) error { // 查看数据库
-		bucket := tx.Bucket([]byte(blocksBucket)) // 获取已有bucket
+	err := i.db.View(func(tx qbstore.Tx) error { // 查看数据库
+		bucket := tx.Bucket(blocksBucket)         // 获取已有bucket
 		encodedBlock := bucket.Get(i.currentHash) // 获取key-value
+		if encodedBlock == nil {
+			return fmt.Errorf("%w: %x", ErrBlockNotFound, i.currentHash)
+		}
 		// 解码当前块数据,获取区块
-		b = qblock.DeserializeBlock(encodedBlock)
+		if err := gob.NewDecoder(bytes.NewReader(encodedBlock)).Decode(&b); err != nil {
+			return fmt.Errorf("%w: %x: %v", ErrBlockCorrupt, i.currentHash, err)
+		}
+		if !bytes.Equal(b.Hash, i.currentHash) {
+			return fmt.Errorf("%w: block %x is stored as %x", ErrBlockCorrupt, b.Hash, i.currentHash)
+		}
 		return nil
 	})
-
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 	// 当前块变更为前块hash
 	i.currentHash = b.Prev_block_hash
-	// 返回区块
-	return b
+	return &b, nil
+}
+
+// HeaderIterator，区块头迭代器，自最新区块向前遍历区块头
+type HeaderIterator struct {
+	currentHash []byte        // 当前区块hash
+	db          qbstore.Store // 已经打开的数据库
+}
+
+// Next,获取当前区块头
+func (i *HeaderIterator) Next() *qblock.BlockHeader {
+	var h *qblock.BlockHeader
+	err := i.db.View(func(tx qbstore.Tx) error { // 查看数据库
+		bucket := tx.Bucket(headersBucket)
+		h = qblock.DeserializeHeader(bucket.Get(i.currentHash))
+		return nil
+	})
+
+	if err != nil {
+		log.Panic(err)
+	}
+	// 当前区块头变更为前一区块
+	i.currentHash = h.Prev_block_hash
+	return h
 }
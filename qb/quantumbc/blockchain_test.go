@@ -0,0 +1,609 @@
+package quantumbc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"qb/qbstore"
+	"qb/qbvalidate"
+	"qblock"
+	"qbtx"
+	"qkdserv"
+	"testing"
+)
+
+// openCopy，复制仓库中的旧账本到临时目录后打开，避免修改原文件
+func openCopy(t *testing.T, src string) *Blockchain {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir() + "/blockchain.db"
+	if err = os.WriteFile(dst, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := qbstore.OpenBolt(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return LoadBlockchain(store)
+}
+
+const (
+	addrC1 = "1CG9GcxF2BT1rjxwoMHSLtRP9RTCsSkRyH" // C1的钱包地址
+	addrP1 = "195KpL1PxRzvVKxg33YYbWjgFqxFAbBit9" // P1的钱包地址
+)
+
+// spendC1，以C1身份花费一个输出，向to支付amount，其余找零给C1
+func spendC1(txid []byte, index, value, amount int, to string) *qbtx.Transaction {
+	tx := &qbtx.Transaction{
+		TX_vin:  []qbtx.TXInput{{Refer_tx_id: txid, Refer_tx_id_index: index, TX_src: addrC1}},
+		TX_vout: []qbtx.TXOutput{qbtx.NewTXOutput(amount, to), qbtx.NewTXOutput(value-amount, addrC1)},
+	}
+	qkdserv.Node_name = "C1"
+	tx.USSTransactionSign("C1")
+	tx.TX_id = tx.SetID()
+	qkdserv.Node_name = "P1"
+	return tx
+}
+
+func TestMain(m *testing.M) {
+	os.Chdir("..") // 配置文件路径相对于qb目录
+	qkdserv.QKD_sign_random_matrix_pool = make(map[qkdserv.QKDSignMatrixIndex]qkdserv.QKDSignRandomsMatrix)
+	qkdserv.Node_name = "P1"
+	qbtx.N = 4
+	os.Exit(m.Run())
+}
+
+func TestIndexes(t *testing.T) {
+	fmt.Println("----------【Blockchain】——GetBlockByHeight && GetTransaction------------------------------------------------")
+	// 打开没有索引的旧账本时补建索引
+	bc := openCopy(t, "quantumbc/DB/blockchain_P1.db")
+	defer bc.DB.Close()
+
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+		byHeight, err := bc.GetBlockByHeight(block.Height)
+		if err != nil || !bytes.Equal(byHeight.Hash, block.Hash) {
+			t.Fatalf("block %d is not indexed: %v", block.Height, err)
+		}
+		for i, tx := range block.Transactions {
+			found, loc, err := bc.GetTransaction(tx.TX_id)
+			if err != nil || !bytes.Equal(found.TX_id, tx.TX_id) || !bytes.Equal(loc.Block_hash, block.Hash) ||
+				loc.Height != block.Height || loc.Index != i {
+				t.Fatalf("transaction %x is not indexed: %v", tx.TX_id, err)
+			}
+		}
+		if len(block.Prev_block_hash) == 0 {
+			break
+		}
+	}
+
+	// 新区块写入时更新索引
+	last := bc.GetlastHeader()
+	next := qblock.NewBlock(nil, last.Hash, last.Height+1, 0)
+	if err := bc.AddBlock(next); err != nil {
+		t.Fatal(err)
+	}
+	if block, err := bc.GetBlockByHeight(last.Height + 1); err != nil || !bytes.Equal(block.Hash, next.Hash) {
+		t.Errorf("new block is not indexed: %v", err)
+	}
+	if _, err := bc.GetBlockByHeight(last.Height + 2); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("got %v, want %v", err, ErrBlockNotFound)
+	}
+	if _, _, err := bc.GetTransaction([]byte("missing")); !errors.Is(err, ErrTXNotFound) {
+		t.Errorf("got %v, want %v", err, ErrTXNotFound)
+	}
+	fmt.Printf("indexed %d blocks\n", last.Height+2)
+}
+
+func TestAddressIndex(t *testing.T) {
+	fmt.Println("----------【Blockchain】——GetBalance && GetAddressHistory-------------------------------------------------")
+	bc := openCopy(t, "quantumbc/DB/blockchain_P1.db")
+	defer bc.DB.Close()
+
+	// 地址索引的余额与遍历全链得到的未花费输出一致
+	balances := make(map[string]int)
+	for _, outs := range bc.FindUTXO() {
+		for _, out := range outs.Outputs {
+			balances[out.TX_dst] += out.TX_value
+		}
+	}
+	for addr, balance := range balances {
+		if got := bc.GetBalance(addr); got != balance {
+			t.Errorf("balance of %s: got %d, want %d", addr, got, balance)
+		}
+	}
+
+	// 连接新区块后，付款方与收款方的余额与收支记录随之更新
+	_, before := bc.GetAddressHistory(addrC1, 0, 1)
+	in := bc.GetAddressUTXO(addrC1)[0]
+	spend := spendC1(in.TX_id, in.Index, in.Value, 5, addrP1)
+	last := bc.GetlastHeader()
+	if err := bc.AddBlock(qblock.NewBlock([]*qbtx.Transaction{spend}, last.Hash, last.Height+1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if bc.GetBalance(addrC1) != balances[addrC1]-5 || bc.GetBalance(addrP1) != balances[addrP1]+5 {
+		t.Error("balances are not updated")
+	}
+	events, total := bc.GetAddressHistory(addrC1, 0, 100)
+	if total != before+2 || len(events) != total || events[0].Spent || !events[1].Spent ||
+		!bytes.Equal(events[1].Out_tx_id, in.TX_id) || events[1].Value != in.Value || events[1].Height != last.Height+1 {
+		t.Errorf("history of payer is wrong: %+v", events)
+	}
+	if page, _ := bc.GetAddressHistory(addrC1, 1, 1); len(page) != 1 || !page[0].Spent {
+		t.Error("history page is wrong")
+	}
+	if events, total = bc.GetAddressHistory(addrP1, 0, 1); len(events) != 1 || events[0].Value != 5 || events[0].Spent {
+		t.Errorf("history of payee is wrong: %+v of %d", events, total)
+	}
+	fmt.Println("address index success")
+}
+
+func TestChainstate(t *testing.T) {
+	fmt.Println("----------【Blockchain】——incremental UTXO && DisconnectBlock---------------------------------------------")
+	bc := openCopy(t, "quantumbc/DB/blockchain_P1.db")
+	defer bc.DB.Close()
+	if err := bc.ReindexUTXO(); err != nil { // 修复旧账本的UTXO集合
+		t.Fatal(err)
+	}
+	if err := bc.CheckUTXO(); err != nil {
+		t.Fatal(err)
+	}
+	balance := bc.GetBalance(addrC1)
+
+	// 区块内第二笔交易花费第一笔交易的找零
+	in := bc.GetAddressUTXO(addrC1)[0]
+	first := spendC1(in.TX_id, in.Index, in.Value, 2, addrP1)
+	second := spendC1(first.TX_id, 1, in.Value-2, 3, addrP1)
+	inHeight, _ := bc.UTXOHeight(in.TX_id)
+	last := bc.GetlastHeader()
+	block := qblock.NewBlock([]*qbtx.Transaction{first, second}, last.Hash, last.Height+1, 0)
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.CheckUTXO(); err != nil {
+		t.Errorf("incremental UTXO set is inconsistent: %v", err)
+	}
+	if bc.GetBalance(addrC1) != balance-5 {
+		t.Error("balance is not updated")
+	}
+	if height, ok := bc.UTXOHeight(second.TX_id); !ok || height != block.Height {
+		t.Errorf("outputs recorded at height %d, want %d", height, block.Height)
+	}
+
+	// 断开区块后恢复到连接前的状态
+	disconnected, err := bc.DisconnectBlock()
+	if err != nil || !bytes.Equal(disconnected.Hash, block.Hash) || !bytes.Equal(bc.GetlastHash(), last.Hash) {
+		t.Fatalf("disconnect failed: %v", err)
+	}
+	if err = bc.CheckUTXO(); err != nil {
+		t.Errorf("UTXO set is inconsistent after disconnect: %v", err)
+	}
+	if out, ok := bc.GetUTXO(in.TX_id, in.Index); !ok || out.TX_value != in.Value || bc.GetBalance(addrC1) != balance {
+		t.Error("spent output is not restored")
+	}
+	if height, _ := bc.UTXOHeight(in.TX_id); height != inHeight {
+		t.Errorf("restored output at height %d, want %d", height, inHeight)
+	}
+	if _, _, err = bc.GetTransaction(first.TX_id); !errors.Is(err, ErrTXNotFound) {
+		t.Error("transaction of disconnected block is still indexed")
+	}
+	if _, err = bc.GetBlockByHeight(block.Height); !errors.Is(err, ErrBlockNotFound) {
+		t.Error("height of disconnected block is still indexed")
+	}
+	// 旧账本的区块没有撤销数据
+	if _, err = bc.DisconnectBlock(); !errors.Is(err, ErrNoUndo) {
+		t.Errorf("got %v, want %v", err, ErrNoUndo)
+	}
+
+	// 断开的区块可以重新连接
+	if err = bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if err = bc.CheckUTXO(); err != nil || bc.GetBalance(addrC1) != balance-5 {
+		t.Errorf("UTXO set is inconsistent after reconnect: %v", err)
+	}
+	fmt.Println("incremental UTXO success")
+}
+
+func TestMemStore(t *testing.T) {
+	fmt.Println("----------【Blockchain】——in-memory ledger-----------------------------------------------------------------")
+	genesis, err := qblock.LoadGenesisBlock(qblock.GENESIS_BLOCK_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := InitBlockchain(qbstore.NewMemStore(), genesis)
+	defer bc.DB.Close()
+	if !bytes.Equal(bc.GetGenesisHash(), genesis.Hash) || bc.GetlastHeight() != 0 {
+		t.Fatal("genesis block is not stored")
+	}
+	if err = bc.CheckUTXO(); err != nil {
+		t.Fatal(err)
+	}
+
+	in := bc.GetAddressUTXO(addrC1)[0]
+	spend := spendC1(in.TX_id, in.Index, in.Value, 4, addrP1)
+	block := qblock.NewBlock([]*qbtx.Transaction{spend}, genesis.Hash, 1, 0)
+	if err = bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if err = bc.CheckUTXO(); err != nil || bc.GetBalance(addrP1) != 4 {
+		t.Errorf("in-memory UTXO set is wrong: %v", err)
+	}
+	if found, err := bc.GetBlockByHeight(1); err != nil || !bytes.Equal(found.Hash, block.Hash) {
+		t.Errorf("in-memory height index is wrong: %v", err)
+	}
+	// 校验失败的区块不写入
+	if err = bc.AddBlock(qblock.NewBlock([]*qbtx.Transaction{spend}, block.Hash, 2, 0)); err == nil {
+		t.Error("double spend is accepted")
+	}
+	if _, err = bc.DisconnectBlock(); err != nil || bc.GetlastHeight() != 0 || bc.GetBalance(addrP1) != 0 {
+		t.Errorf("in-memory disconnect failed: %v", err)
+	}
+	fmt.Println("in-memory ledger success")
+}
+
+// newMemChain，在内存账本上由分发的创世区块建立3个区块的链：C1向P1付款1，再向自己付款2，再向P1付款3
+func newMemChain(t *testing.T) (*Blockchain, *qblock.Block) {
+	genesis, err := qblock.LoadGenesisBlock(qblock.GENESIS_BLOCK_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := InitBlockchain(qbstore.NewMemStore(), genesis)
+	for i, to := range []string{addrP1, addrC1, addrP1} {
+		var in AddressUTXO
+		for _, out := range bc.GetAddressUTXO(addrC1) { // 花费C1最大的输出
+			if out.Value > in.Value {
+				in = out
+			}
+		}
+		last := bc.GetlastHeader()
+		block := qblock.NewBlock([]*qbtx.Transaction{spendC1(in.TX_id, in.Index, in.Value, i+1, to)}, last.Hash, last.Height+1, 0)
+		if err = bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return bc, genesis
+}
+
+// malformedStream，校验和正确、但记录内容无法解码的导出文件
+func malformedStream(t *testing.T, magic string, records ...[]byte) []byte {
+	var buf bytes.Buffer
+	sw, err := newStreamWriter(&buf, magic)
+	for _, record := range records {
+		if err == nil {
+			err = sw.writeRecord(record)
+		}
+	}
+	if err == nil {
+		err = sw.close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExportImport(t *testing.T) {
+	fmt.Println("----------【Blockchain】——ExportChain && ImportChain-----------------------------------------------------")
+	src, genesis := newMemChain(t)
+	defer src.DB.Close()
+	var stream bytes.Buffer
+	if count, err := src.ExportChain(&stream, 0); err != nil || count != 4 {
+		t.Fatalf("exported %d blocks: %v", count, err)
+	}
+
+	dst := InitBlockchain(qbstore.NewMemStore(), genesis)
+	defer dst.DB.Close()
+	if count, err := dst.ImportChain(bytes.NewReader(stream.Bytes())); err != nil || count != 3 {
+		t.Fatalf("imported %d blocks: %v", count, err)
+	}
+	if !bytes.Equal(dst.GetlastHash(), src.GetlastHash()) || dst.GetBalance(addrP1) != 4 {
+		t.Error("imported chain differs from the exported chain")
+	}
+	if err := dst.CheckUTXO(); err != nil {
+		t.Error(err)
+	}
+	if count, err := dst.ImportChain(bytes.NewReader(stream.Bytes())); err != nil || count != 0 {
+		t.Errorf("re-import connected %d blocks: %v", count, err)
+	}
+
+	// 损坏、截断或类型不符的文件在导入任何区块前被拒绝
+	corrupt := append([]byte{}, stream.Bytes()...)
+	corrupt[len(corrupt)/2] ^= 1
+	cases := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"corrupt", corrupt, ErrStreamChecksum},
+		{"truncated", stream.Bytes()[:stream.Len()-1], ErrStreamChecksum},
+		{"wrong kind", append([]byte(SNAPSHOT_STREAM_MAGIC), stream.Bytes()[len(CHAIN_STREAM_MAGIC):]...), ErrStreamMagic},
+		{"malformed block", malformedStream(t, CHAIN_STREAM_MAGIC, []byte("not a block")), ErrStreamCorrupt},
+	}
+	for _, c := range cases {
+		fresh := InitBlockchain(qbstore.NewMemStore(), genesis)
+		if count, err := fresh.ImportChain(bytes.NewReader(c.data)); !errors.Is(err, c.want) || count != 0 {
+			t.Errorf("%s: imported %d blocks, got %v, want %v", c.name, count, err, c.want)
+		}
+		fresh.DB.Close()
+	}
+
+	// 提议者签名无效的区块不导入
+	forged, _ := src.GetBlockByHeight(1)
+	forged.Block_uss.USS_signature[0] ^= 0xff
+	fresh := InitBlockchain(qbstore.NewMemStore(), genesis)
+	defer fresh.DB.Close()
+	data := malformedStream(t, CHAIN_STREAM_MAGIC, genesis.SerializeBlock(), forged.SerializeBlock())
+	if count, err := fresh.ImportChain(bytes.NewReader(data)); !errors.Is(err, qbvalidate.ErrBlockSignInvalid) || count != 0 {
+		t.Errorf("forged signature: imported %d blocks, got %v, want %v", count, err, qbvalidate.ErrBlockSignInvalid)
+	}
+
+	// 与本地账本分叉的区块不导入
+	other, _ := newMemChain(t)
+	defer other.DB.Close()
+	var fork bytes.Buffer
+	if _, err := other.ExportChain(&fork, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.ImportChain(bytes.NewReader(fork.Bytes())); !errors.Is(err, ErrChainMismatch) {
+		t.Errorf("got %v, want %v", err, ErrChainMismatch)
+	}
+	fmt.Println("export and import success")
+}
+
+func TestSnapshot(t *testing.T) {
+	fmt.Println("----------【Blockchain】——ExportSnapshot && ImportSnapshot-----------------------------------------------")
+	src, genesis := newMemChain(t)
+	defer src.DB.Close()
+	var snapshot bytes.Buffer
+	meta, err := src.ExportSnapshot(&snapshot)
+	if err != nil || meta.Height != 3 {
+		t.Fatalf("snapshot at %+v: %v", meta, err)
+	}
+
+	// 状态hash不符时不写入任何内容，存储仍可再次导入
+	store := qbstore.NewMemStore()
+	if _, err = ImportSnapshot(store, bytes.NewReader(snapshot.Bytes()), genesis, []byte("untrusted")); !errors.Is(err, ErrStateHash) {
+		t.Fatalf("got %v, want %v", err, ErrStateHash)
+	}
+	// 校验和正确但记录无法解码时返回错误，不中止进程
+	var meta_record bytes.Buffer
+	gob.NewEncoder(&meta_record).Encode(meta)
+	for _, records := range [][][]byte{
+		{meta_record.Bytes(), []byte("not a block")},
+		{meta_record.Bytes(), genesis.SerializeBlock(), []byte("not a header")},
+	} {
+		data := malformedStream(t, SNAPSHOT_STREAM_MAGIC, records...)
+		if _, err = ImportSnapshot(store, bytes.NewReader(data), genesis, meta.State_hash); !errors.Is(err, ErrStreamCorrupt) {
+			t.Errorf("malformed record %d: got %v, want %v", len(records), err, ErrStreamCorrupt)
+		}
+	}
+	// 快照所在区块的提议者签名无效时不导入
+	var records [][]byte
+	records = append(records, meta_record.Bytes(), genesis.SerializeBlock())
+	for height := int64(1); height < meta.Height; height++ {
+		header, _ := src.GetHeaderByHeight(height)
+		records = append(records, header.SerializeHeader())
+	}
+	tip, _ := src.GetBlockByHeight(meta.Height)
+	tip.Block_uss.USS_signature[0] ^= 0xff
+	records = append(records, tip.SerializeBlock())
+	data := malformedStream(t, SNAPSHOT_STREAM_MAGIC, records...)
+	if _, err = ImportSnapshot(store, bytes.NewReader(data), genesis, meta.State_hash); !errors.Is(err, qbvalidate.ErrBlockSignInvalid) {
+		t.Errorf("forged snapshot block: got %v, want %v", err, qbvalidate.ErrBlockSignInvalid)
+	}
+	bc, err := ImportSnapshot(store, bytes.NewReader(snapshot.Bytes()), genesis, meta.State_hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.DB.Close()
+	if bc.BaseHeight() != 3 || !bytes.Equal(bc.GetlastHash(), src.GetlastHash()) || !bytes.Equal(bc.GetGenesisHash(), genesis.Hash) {
+		t.Fatal("snapshot ledger has the wrong tip")
+	}
+	if len(bc.GetBlockHashes()) != 4 || bc.GetBalance(addrC1) != src.GetBalance(addrC1) || bc.GetBalance(addrP1) != 4 {
+		t.Error("snapshot ledger has the wrong headers or balances")
+	}
+	if _, err = ImportSnapshot(store, bytes.NewReader(snapshot.Bytes()), genesis, meta.State_hash); !errors.Is(err, ErrLedgerExists) {
+		t.Errorf("got %v, want %v", err, ErrLedgerExists)
+	}
+
+	// 快照高度之后的区块可正常连接，包括花费快照之前创建的输出
+	var early AddressUTXO
+	for _, out := range bc.GetAddressUTXO(addrC1) {
+		if out.Value == 2 {
+			early = out
+		}
+	}
+	last := bc.GetlastHeader()
+	block := qblock.NewBlock([]*qbtx.Transaction{spendC1(early.TX_id, early.Index, early.Value, 1, addrP1)}, last.Hash, last.Height+1, 0)
+	for _, ledger := range []*Blockchain{src, bc} {
+		if err = ledger.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srcState, _ := src.StateHash()
+	state, _ := bc.StateHash()
+	if !bytes.Equal(state.State_hash, srcState.State_hash) || bc.GetBalance(addrP1) != 5 {
+		t.Error("snapshot ledger diverges after a new block")
+	}
+	if events, _ := bc.GetAddressHistory(addrC1, 0, 100); len(events) != 2 || !events[1].Spent || events[1].Value != 2 {
+		t.Errorf("spend of an output before the snapshot is not indexed: %+v", events)
+	}
+
+	// 快照之前的区块不可导出、重建或断开
+	if _, err = bc.ExportChain(&bytes.Buffer{}, 0); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("got %v, want %v", err, ErrNoHistory)
+	}
+	if err = bc.CheckUTXO(); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("got %v, want %v", err, ErrNoHistory)
+	}
+	if _, err = bc.DisconnectBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.DisconnectBlock(); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("got %v, want %v", err, ErrNoHistory)
+	}
+	fmt.Println("snapshot success")
+}
+
+func TestPrune(t *testing.T) {
+	fmt.Println("----------【Blockchain】——Prune----------------------------------------------------------------------------")
+	bc, _ := newMemChain(t)
+	defer bc.DB.Close()
+	block1, _ := bc.GetBlockByHeight(1)
+	balanceC1 := bc.GetBalance(addrC1)
+	if _, err := bc.Prune(1); err == nil {
+		t.Fatal("prune depth below MIN_PRUNE_DEPTH is accepted")
+	}
+	if pruned, err := bc.Prune(2); err != nil || pruned != 1 || bc.BaseHeight() != 2 {
+		t.Fatalf("pruned %d blocks, base %d: %v", pruned, bc.BaseHeight(), err)
+	}
+	if pruned, err := bc.Prune(2); err != nil || pruned != 0 {
+		t.Fatalf("second prune removed %d blocks: %v", pruned, err)
+	}
+
+	// 已修剪的区块与交易明确拒绝，区块头、索引与余额不受影响
+	if _, err := bc.GetBlockByHeight(1); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("got %v, want %v", err, ErrNoHistory)
+	}
+	if _, loc, err := bc.GetTransaction(block1.Transactions[0].TX_id); !errors.Is(err, ErrNoHistory) || loc.Height != 1 {
+		t.Errorf("got %v at %d, want %v", err, loc.Height, ErrNoHistory)
+	}
+	if _, err := bc.GetBlockByHeight(0); err != nil {
+		t.Error("genesis block is pruned")
+	}
+	if header, err := bc.GetHeader(block1.Hash); err != nil || header.Height != 1 {
+		t.Error("header of a pruned block is lost")
+	}
+	if len(bc.GetBlockHashes()) != 4 || bc.GetBalance(addrC1) != balanceC1 || bc.GetBalance(addrP1) != 4 {
+		t.Error("pruned ledger has the wrong headers or balances")
+	}
+	if audit := bc.VerifyChain(); len(audit.Issues) != 0 || audit.Base != 2 || audit.UTXO_checked || audit.Certs != 1 {
+		t.Errorf("pruned ledger: %+v", audit)
+	}
+
+	// 已修剪区块的提议者签名仍保存，可证明区块头，篡改后审计报告
+	cert, err := bc.GetBlockCert(block1.Hash)
+	if err != nil || !bytes.Equal(cert.USS_signature, block1.Block_uss.USS_signature) {
+		t.Fatalf("signature of a pruned block: %v", err)
+	}
+	cert.USS_message = []byte("other")
+	err = bc.DB.Update(func(tx qbstore.Tx) error {
+		return tx.Bucket(certsBucket).Put(block1.Hash, serializeCert(cert))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if audit := bc.VerifyChain(); len(audit.Issues) != 1 || !errors.Is(audit.Issues[0].Err, qbvalidate.ErrBlockSignMessage) || audit.Issues[0].Height != 1 {
+		t.Errorf("tampered signature of a pruned block: %+v", audit.Issues)
+	}
+	err = bc.DB.Update(func(tx qbstore.Tx) error {
+		return tx.Bucket(certsBucket).Put(block1.Hash, serializeCert(block1.Block_uss))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 修剪后仍可连接新区块，并可断开至基准高度
+	var in AddressUTXO
+	for _, out := range bc.GetAddressUTXO(addrC1) {
+		if out.Value > in.Value {
+			in = out
+		}
+	}
+	last := bc.GetlastHeader()
+	block := qblock.NewBlock([]*qbtx.Transaction{spendC1(in.TX_id, in.Index, in.Value, 1, addrP1)}, last.Hash, last.Height+1, 0)
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := bc.DisconnectBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := bc.DisconnectBlock(); !errors.Is(err, ErrNoHistory) || bc.GetlastHeight() != 2 {
+		t.Errorf("got %v at height %d, want %v", err, bc.GetlastHeight(), ErrNoHistory)
+	}
+	fmt.Println("prune success")
+}
+
+func TestVerifyChain(t *testing.T) {
+	fmt.Println("----------【Blockchain】——VerifyChain----------------------------------------------------------------------")
+	bc, _ := newMemChain(t)
+	defer bc.DB.Close()
+	if audit := bc.VerifyChain(); len(audit.Issues) != 0 || audit.Blocks != 4 || !audit.UTXO_checked {
+		t.Fatalf("intact ledger: %+v", audit)
+	}
+
+	// 篡改区块2的交易金额，并删除区块3交易的UTXO记录
+	block2, _ := bc.GetBlockByHeight(2)
+	block3, _ := bc.GetBlockByHeight(3)
+	block2.Transactions[0].TX_vout[0].TX_value++
+	err := bc.DB.Update(func(tx qbstore.Tx) error {
+		if err := tx.Bucket(blocksBucket).Put(block2.Hash, block2.SerializeBlock()); err != nil {
+			return err
+		}
+		return tx.Bucket(utxoBucket).Delete(block3.Transactions[0].TX_id)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit := bc.VerifyChain()
+	found := make(map[int64][]error)
+	for _, issue := range audit.Issues {
+		found[issue.Height] = append(found[issue.Height], issue.Err)
+	}
+	has := func(height int64, want error) bool {
+		for _, err := range found[height] {
+			if errors.Is(err, want) {
+				return true
+			}
+		}
+		return false
+	}
+	if !has(2, qbvalidate.ErrBlockMerkleMismatch) || !has(2, qbvalidate.ErrTXIDMismatch) || !has(2, qbtx.ErrSignMessageMismatch) {
+		t.Errorf("tampered transaction is not reported: %v", found[2])
+	}
+	if !has(2, ErrUTXOInconsistent) || !has(3, ErrUTXOInconsistent) || len(found[1]) != 0 || len(found[0]) != 0 {
+		t.Errorf("UTXO discrepancies are not reported at their heights: %v", found)
+	}
+	for i := 1; i < len(audit.Issues); i++ {
+		if audit.Issues[i].Height < audit.Issues[i-1].Height {
+			t.Fatal("issues are not sorted by height")
+		}
+	}
+
+	// 被花费的输出带锁定脚本时，区块3的输入项须给出满足脚本的解锁脚本
+	err = bc.DB.Update(func(tx qbstore.Tx) error {
+		undo := deserializeUndo(tx.Bucket(undoBucket).Get(block3.Hash))
+		undo[0].Output.Lock_script = qbtx.Script{}.AddOp(qbtx.OP_TRUE)
+		return tx.Bucket(undoBucket).Put(block3.Hash, serializeUndo(undo))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found = make(map[int64][]error)
+	for _, issue := range bc.VerifyChain().Issues {
+		found[issue.Height] = append(found[issue.Height], issue.Err)
+	}
+	if !has(3, qbtx.ErrScriptMissing) {
+		t.Errorf("script of the spent output is not checked: %v", found[3])
+	}
+
+	// 区块缺失时报告缺失高度，不中止程序
+	err = bc.DB.Update(func(tx qbstore.Tx) error {
+		return tx.Bucket(blocksBucket).Delete(block2.Hash)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if audit = bc.VerifyChain(); !errors.Is(audit.Issues[0].Err, ErrBlockNotFound) || audit.Issues[0].Height != 2 || audit.UTXO_checked {
+		t.Errorf("missing block is not reported: %+v", audit.Issues)
+	}
+	fmt.Printf("verify chain found %d issues\n", len(audit.Issues))
+}
@@ -0,0 +1,326 @@
+package quantumbc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"qb/qbstore"
+	"qblock"
+	"qbtx"
+	"utils"
+)
+
+// 撤销数据bucket，key=区块hash，value=区块花费的输出[]SpentOutput，用于断开区块时恢复UTXO
+const undoBucket = "undo"
+
+// 增量维护UTXO时的错误
+var (
+	ErrMissingUTXO       = errors.New("spent output is not in the UTXO set")     // 区块花费的输出不在UTXO集合中
+	ErrNoUndo            = errors.New("no undo data for block")                  // 区块没有撤销数据，无法断开
+	ErrDisconnectGenesis = errors.New("genesis block cannot be disconnected")    // 创世区块不能断开
+	ErrUTXOInconsistent  = errors.New("UTXO set differs from a full rebuild")    // UTXO集合与重建结果不一致
+	ErrAddrIndexMismatch = errors.New("address index differs from the UTXO set") // 地址索引与UTXO集合不一致
+)
+
+// SpentOutput，区块花费的一个输出，按区块中输入的顺序记录
+type SpentOutput struct {
+	TX_id  []byte        // 输出所在交易ID
+	Index  int           // 输出编号
+	Output qbtx.TXOutput // 输出项
+	Height int64         // 输出所在区块的高度
+}
+
+// connectUTXO，依据区块增量更新UTXO集合：移除被花费的输出、加入新输出，并记录撤销数据
+// 参数：数据库读写事务，区块
+// 返回值：错误error，区块花费的输出不存在时返回ErrMissingUTXO，整个事务回滚
+func connectUTXO(tx qbstore.Tx, block *qblock.Block) error {
+	b := tx.Bucket(utxoBucket)
+	var undo []SpentOutput
+
+	for _, transaction := range block.Transactions {
+		if !transaction.IsReserveTX() && !transaction.IsFeeTX() {
+			for _, vin := range transaction.TX_vin {
+				data := b.Get(vin.Refer_tx_id)
+				if data == nil {
+					return fmt.Errorf("%w: %x:%d", ErrMissingUTXO, vin.Refer_tx_id, vin.Refer_tx_id_index)
+				}
+				outs := qbtx.DeserializeOutputs(data)
+				out, ok := outs.GetOutput(vin.Refer_tx_id_index)
+				if !ok {
+					return fmt.Errorf("%w: %x:%d", ErrMissingUTXO, vin.Refer_tx_id, vin.Refer_tx_id_index)
+				}
+				undo = append(undo, SpentOutput{vin.Refer_tx_id, vin.Refer_tx_id_index, out, outs.Height})
+
+				updatedOuts := qbtx.TXOutputs{Height: outs.Height}
+				for i, o := range outs.Outputs {
+					if outs.OutputIndex(i) != vin.Refer_tx_id_index { // 按原交易输出编号去掉已花费的输出
+						updatedOuts.Outputs = append(updatedOuts.Outputs, o)
+						updatedOuts.Index = append(updatedOuts.Index, outs.OutputIndex(i))
+					}
+				}
+				if err := putOutputs(b, vin.Refer_tx_id, updatedOuts); err != nil {
+					return err
+				}
+			}
+		}
+
+		newOutputs := qbtx.TXOutputs{Height: block.Height}
+		for outIdx, out := range transaction.TX_vout {
+			newOutputs.Outputs = append(newOutputs.Outputs, out)
+			newOutputs.Index = append(newOutputs.Index, outIdx)
+		}
+		if err := putOutputs(b, transaction.TX_id, newOutputs); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(undoBucket).Put(block.Hash, serializeUndo(undo))
+}
+
+// putOutputs，写入交易的未花费输出，全部花费时删除该交易
+func putOutputs(b qbstore.Bucket, txid []byte, outs qbtx.TXOutputs) error {
+	if len(outs.Outputs) == 0 {
+		return b.Delete(txid)
+	}
+	return b.Put(txid, outs.SerializeOutputs())
+}
+
+// restoreOutput，将被花费的输出按原编号顺序放回UTXO集合
+func restoreOutput(b qbstore.Bucket, spent SpentOutput) error {
+	outs := qbtx.TXOutputs{}
+	if data := b.Get(spent.TX_id); data != nil {
+		outs = qbtx.DeserializeOutputs(data)
+	}
+	restored := qbtx.TXOutputs{Height: spent.Height}
+	inserted := false
+	for i, out := range outs.Outputs {
+		if !inserted && outs.OutputIndex(i) > spent.Index {
+			restored.Outputs = append(restored.Outputs, spent.Output)
+			restored.Index = append(restored.Index, spent.Index)
+			inserted = true
+		}
+		restored.Outputs = append(restored.Outputs, out)
+		restored.Index = append(restored.Index, outs.OutputIndex(i))
+	}
+	if !inserted {
+		restored.Outputs = append(restored.Outputs, spent.Output)
+		restored.Index = append(restored.Index, spent.Index)
+	}
+	return b.Put(spent.TX_id, restored.SerializeOutputs())
+}
+
+// DisconnectBlock，断开最新区块：依据撤销数据恢复UTXO集合，撤销高度、交易与地址索引，最新区块回退为其父区块。
+// 区块数据与区块头仍保留在账本中，可再次通过AddBlock连接
+// 参数：
+// 返回值：被断开的区块*qblock.Block，error
+func (bc *Blockchain) DisconnectBlock() (*qblock.Block, error) {
+	bc.write.Lock()
+	defer bc.write.Unlock()
+	var block *qblock.Block
+	err := bc.DB.Update(func(tx qbstore.Tx) error {
+		blocks := tx.Bucket(blocksBucket)
+		block = qblock.DeserializeBlock(blocks.Get(blocks.Get([]byte("last"))))
+		if len(block.Prev_block_hash) == 0 {
+			return ErrDisconnectGenesis
+		}
+		if base := tx.Bucket(blocksBucket).Get([]byte(baseKey)); base != nil && block.Height <= int64(binary.BigEndian.Uint64(base)) {
+			return fmt.Errorf("%w: block %d is the oldest stored block", ErrNoHistory, block.Height) // 父区块未保存，不能成为最新区块
+		}
+		undoData := tx.Bucket(undoBucket).Get(block.Hash)
+		if undoData == nil {
+			return fmt.Errorf("%w %x", ErrNoUndo, block.Hash)
+		}
+		undo := deserializeUndo(undoData)
+
+		utxo := tx.Bucket(utxoBucket)
+		history := tx.Bucket(addrHistoryBucket)
+		addrUTXO := tx.Bucket(addrUTXOBucket)
+		txindex := tx.Bucket(txindexBucket)
+		// 逆序处理交易：先删除交易产生的输出，再恢复其花费的输出，区块内相互花费的交易也能正确恢复
+		for pos := len(block.Transactions) - 1; pos >= 0; pos-- {
+			transaction := block.Transactions[pos]
+			if err := utxo.Delete(transaction.TX_id); err != nil {
+				return err
+			}
+			for i, out := range transaction.TX_vout {
+				if err := history.Delete(addrHistoryKey(out.TX_dst, block.Height, pos, false, i)); err != nil {
+					return err
+				}
+				if err := addrUTXO.Delete(addrUTXOKey(out.TX_dst, transaction.TX_id, i)); err != nil {
+					return err
+				}
+			}
+			if err := txindex.Delete(transaction.TX_id); err != nil {
+				return err
+			}
+			if transaction.IsReserveTX() || transaction.IsFeeTX() {
+				continue
+			}
+			for i := len(transaction.TX_vin) - 1; i >= 0; i-- {
+				spent := undo[len(undo)-1]
+				undo = undo[:len(undo)-1]
+				if err := restoreOutput(utxo, spent); err != nil {
+					return err
+				}
+				if err := history.Delete(addrHistoryKey(spent.Output.TX_dst, block.Height, pos, true, i)); err != nil {
+					return err
+				}
+				err := addrUTXO.Put(addrUTXOKey(spent.Output.TX_dst, spent.TX_id, spent.Index), addrUTXOValue(spent.Output))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.Bucket(heightsBucket).Delete(utils.IntToHex(block.Height)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(undoBucket).Delete(block.Hash); err != nil {
+			return err
+		}
+		if err := blocks.Put([]byte("last"), block.Prev_block_hash); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	bc.setTip(block.Prev_block_hash)
+	return block, nil
+}
+
+// ReindexUTXO，修复用：遍历全链重建UTXO集合与地址索引。正常出块时UTXO由AddBlock增量维护，无需调用
+// 参数：
+// 返回值：error，从快照启动的账本没有完整区块，无法重建，返回ErrNoHistory
+func (bc *Blockchain) ReindexUTXO() error {
+	bc.write.Lock()
+	defer bc.write.Unlock()
+	if base := bc.BaseHeight(); base > 0 {
+		return fmt.Errorf("%w: cannot rebuild the UTXO set below height %d", ErrNoHistory, base)
+	}
+	UTXO := bc.FindUTXO() // 查找未花费交易
+
+	err := bc.DB.Update(func(tx qbstore.Tx) error {
+		for _, bucket := range []string{utxoBucket, addrHistoryBucket, addrUTXOBucket} {
+			err := tx.DeleteBucket(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		b, err := tx.CreateBucketIfNotExists(utxoBucket)
+		if err != nil {
+			return err
+		}
+		for txID, outs := range UTXO { // 遍历未花费交易并存入数据库
+			key, err := hex.DecodeString(txID)
+			if err != nil {
+				return err
+			}
+			err = b.Put(key, outs.SerializeOutputs()) // 存入数据库，key：txID，value:TXOutputs
+			if err != nil {
+				return err
+			}
+		}
+		return indexAllAddresses(tx) // 重建地址索引
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	return nil
+}
+
+// CheckUTXO，一致性检查：比较增量维护的UTXO集合与遍历全链重建的结果，并检查地址索引与UTXO集合一致
+// 参数：
+// 返回值：error，一致时为nil，否则为ErrUTXOInconsistent或ErrAddrIndexMismatch并指明第一处差异；从快照启动的账本返回ErrNoHistory
+func (bc *Blockchain) CheckUTXO() error {
+	bc.write.Lock() // 检查期间不连接新区块
+	defer bc.write.Unlock()
+	if base := bc.BaseHeight(); base > 0 {
+		return fmt.Errorf("%w: cannot rebuild the UTXO set below height %d", ErrNoHistory, base)
+	}
+	rebuilt := bc.FindUTXO()
+
+	var first error
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		compareUTXO(tx, rebuilt, func(txID string, err error) {
+			if first == nil {
+				first = err
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return first
+}
+
+// compareUTXO，比较存储的UTXO集合与重建结果，并检查地址索引与UTXO集合一致，每处差异调用一次report
+// 参数：只读事务，重建的UTXO集合，差异回调（所涉交易ID，无法对应到交易时为空；错误）
+func compareUTXO(tx qbstore.Tx, rebuilt map[string]qbtx.TXOutputs, report func(txID string, err error)) {
+	stored := make(map[string]bool)
+	addrCount := 0
+	c := tx.Bucket(utxoBucket).Cursor()
+Stored:
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		txID := hex.EncodeToString(k)
+		stored[txID] = true
+		outs := qbtx.DeserializeOutputs(v)
+		want, ok := rebuilt[txID]
+		if !ok || len(want.Outputs) != len(outs.Outputs) || want.Height != outs.Height {
+			report(txID, fmt.Errorf("%w: transaction %s", ErrUTXOInconsistent, txID))
+			continue
+		}
+		for i, out := range outs.Outputs { // 旧数据可能未记录输出编号，因此按编号逐个比较
+			wantOut, ok := want.GetOutput(outs.OutputIndex(i))
+			if !ok || !wantOut.Equal(out) {
+				report(txID, fmt.Errorf("%w: output %s:%d", ErrUTXOInconsistent, txID, outs.OutputIndex(i)))
+				continue Stored
+			}
+		}
+		for i, out := range outs.Outputs {
+			value := tx.Bucket(addrUTXOBucket).Get(addrUTXOKey(out.TX_dst, k, outs.OutputIndex(i)))
+			if !bytes.Equal(value, addrUTXOValue(out)) {
+				report(txID, fmt.Errorf("%w: output %s:%d", ErrAddrIndexMismatch, txID, outs.OutputIndex(i)))
+			}
+			addrCount++
+		}
+	}
+	for txID := range rebuilt {
+		if !stored[txID] {
+			report(txID, fmt.Errorf("%w: transaction %s is missing", ErrUTXOInconsistent, txID))
+		}
+	}
+	n := 0
+	ac := tx.Bucket(addrUTXOBucket).Cursor()
+	for k, _ := ac.First(); k != nil; k, _ = ac.Next() {
+		n++
+	}
+	if n != addrCount {
+		report("", fmt.Errorf("%w: %d indexed outputs, UTXO set has %d", ErrAddrIndexMismatch, n, addrCount))
+	}
+}
+
+// serializeUndo，撤销数据序列化
+func serializeUndo(undo []SpentOutput) []byte {
+	var buff bytes.Buffer
+	err := gob.NewEncoder(&buff).Encode(undo)
+	if err != nil {
+		log.Panic(err)
+	}
+	return buff.Bytes()
+}
+
+// deserializeUndo，撤销数据反序列化
+func deserializeUndo(d []byte) []SpentOutput {
+	var undo []SpentOutput
+	err := gob.NewDecoder(bytes.NewReader(d)).Decode(&undo)
+	if err != nil {
+		log.Panic(err)
+	}
+	return undo
+}
@@ -0,0 +1,111 @@
+package quantumbc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"qb/qbstore"
+	"qblock"
+	"uss"
+	"utils"
+)
+
+// 修剪后至少保留的区块数：最新区块及其父区块，最新区块仍可断开
+const MIN_PRUNE_DEPTH = 2
+
+const certsBucket = "certs" // 已修剪区块的提议者签名，key=区块hash，value=签名
+
+// Prune，修剪账本：删除最新的depth个区块之前的区块（创世区块除外）的交易与撤销数据，提议者签名移入certs bucket，
+// 保留区块头、高度与交易索引、地址索引与UTXO集合，基准高度随之提高。查询已修剪的区块或交易时返回ErrNoHistory
+// 参数：保留的区块数int64，不小于MIN_PRUNE_DEPTH
+// 返回值：本次删除的区块数int，error
+func (bc *Blockchain) Prune(depth int64) (int, error) {
+	if depth < MIN_PRUNE_DEPTH {
+		return 0, fmt.Errorf("prune depth %d is less than %d", depth, MIN_PRUNE_DEPTH)
+	}
+	bc.write.Lock()
+	defer bc.write.Unlock()
+
+	from := bc.BaseHeight()
+	if from < 1 {
+		from = 1
+	}
+	base := bc.GetlastHeight() - depth + 1 // 修剪后保存的最早区块
+	if base <= from {
+		return 0, nil
+	}
+	pruned := 0
+	err := bc.DB.Update(func(tx qbstore.Tx) error {
+		blocks := tx.Bucket(blocksBucket)
+		certs, err := tx.CreateBucketIfNotExists(certsBucket)
+		if err != nil {
+			return err
+		}
+		for height := from; height < base; height++ {
+			hash := tx.Bucket(heightsBucket).Get(utils.IntToHex(height))
+			data := blocks.Get(hash)
+			if data == nil { // 早于快照，未曾保存
+				continue
+			}
+			if err := certs.Put(hash, serializeCert(qblock.DeserializeBlock(data).Block_uss)); err != nil {
+				return err
+			}
+			if err := blocks.Delete(hash); err != nil {
+				return err
+			}
+			if err := tx.Bucket(undoBucket).Delete(hash); err != nil {
+				return err
+			}
+			pruned++
+		}
+		return blocks.Put([]byte(baseKey), utils.IntToHex(base))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pruned, nil
+}
+
+// GetBlockCert，查询区块的提议者签名，已修剪的区块从certs bucket中读取，使区块头仍可由签名证明
+// 参数：区块hash[]byte
+// 返回值：提议者签名uss.USSToeplitzHashSignMsg，区块与签名均未保存时返回ErrNoHistory，区块不存在时返回ErrBlockNotFound
+func (bc *Blockchain) GetBlockCert(hash []byte) (uss.USSToeplitzHashSignMsg, error) {
+	var data []byte
+	var cert uss.USSToeplitzHashSignMsg
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		if b := tx.Bucket(certsBucket); b != nil {
+			data = b.Get(hash)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	if data != nil {
+		return deserializeCert(data), nil
+	}
+	block, err := bc.GetBlock(hash)
+	if err != nil {
+		return cert, err
+	}
+	return block.Block_uss, nil
+}
+
+// serializeCert，提议者签名序列化
+func serializeCert(cert uss.USSToeplitzHashSignMsg) []byte {
+	var encoded bytes.Buffer
+	if err := gob.NewEncoder(&encoded).Encode(cert); err != nil {
+		log.Panic(err)
+	}
+	return encoded.Bytes()
+}
+
+// deserializeCert，提议者签名反序列化
+func deserializeCert(data []byte) uss.USSToeplitzHashSignMsg {
+	var cert uss.USSToeplitzHashSignMsg
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&cert); err != nil {
+		log.Panic(err)
+	}
+	return cert
+}
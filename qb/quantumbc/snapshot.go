@@ -0,0 +1,334 @@
+package quantumbc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"qb/qbstore"
+	"qb/qbvalidate"
+	"qblock"
+	"qbtx"
+	"utils"
+)
+
+// blocksBucket中记录基准高度的key。从快照启动或修剪过的账本只保存创世区块与基准高度及之后的区块，其间只有区块头
+const baseKey = "base"
+
+// UTXO快照相关的错误
+var (
+	ErrNoHistory     = errors.New("blocks below the base height are pruned or not stored")       // 账本不含基准高度之前的区块
+	ErrStateHash     = errors.New("UTXO snapshot does not match the trusted state hash")         // 快照与可信状态hash不符
+	ErrLedgerExists  = errors.New("snapshot can only be imported into an empty ledger")          // 快照只能导入空账本
+	ErrSnapshotChain = errors.New("snapshot headers do not form a chain from the genesis block") // 快照区块头未连接到创世区块
+)
+
+// SnapshotMeta，快照文件的第一条记录
+type SnapshotMeta struct {
+	Height       int64  // 快照所在高度
+	Block_hash   []byte // 快照所在区块hash
+	Genesis_hash []byte // 创世区块hash
+	State_hash   []byte // 导出时计算的状态hash，仅供核对，导入时以调用方提供的可信状态hash为准
+	UTXO_count   int    // 快照中含未花费输出的交易数
+}
+
+// stateHasher，计算状态hash：依次写入高度、区块hash与按交易ID排序的未花费输出及其上链高度，输出以json编码，与存储格式无关
+type stateHasher struct {
+	h     hash.Hash
+	count int
+}
+
+// newStateHasher，以快照所在高度与区块hash开始计算
+func newStateHasher(height int64, blockHash []byte) *stateHasher {
+	s := &stateHasher{h: sha256.New()}
+	s.h.Write(utils.IntToHex(height))
+	s.writeBytes(blockHash)
+	return s
+}
+
+// writeBytes，写入长度与内容
+func (s *stateHasher) writeBytes(data []byte) {
+	s.h.Write(utils.IntToHex(int64(len(data))))
+	s.h.Write(data)
+}
+
+// add，写入一笔交易的未花费输出及其所在区块高度，须按交易ID递增的顺序调用
+func (s *stateHasher) add(txid []byte, outs qbtx.TXOutputs) {
+	s.writeBytes(txid)
+	s.h.Write(utils.IntToHex(outs.Height))
+	s.h.Write(utils.IntToHex(int64(len(outs.Outputs))))
+	for i, out := range outs.Outputs {
+		data, err := json.Marshal(out)
+		if err != nil {
+			log.Panic(err)
+		}
+		s.h.Write(utils.IntToHex(int64(outs.OutputIndex(i))))
+		s.writeBytes(data)
+	}
+	s.count++
+}
+
+// sum，状态hash
+func (s *stateHasher) sum() []byte {
+	return s.h.Sum(nil)
+}
+
+// BaseHeight，账本保存区块的基准高度，完整账本为0
+func (bc *Blockchain) BaseHeight() int64 {
+	var base int64
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		if data := tx.Bucket(blocksBucket).Get([]byte(baseKey)); data != nil {
+			base = int64(binary.BigEndian.Uint64(data))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	return base
+}
+
+// stateHash，在同一只读事务中计算最新区块处的状态hash
+func stateHash(tx qbstore.Tx) (*SnapshotMeta, error) {
+	tip := tx.Bucket(blocksBucket).Get([]byte("last"))
+	headerData := tx.Bucket(headersBucket).Get(tip)
+	if headerData == nil {
+		return nil, fmt.Errorf("%w: header of %x", ErrBlockNotFound, tip)
+	}
+	header := qblock.DeserializeHeader(headerData)
+	s := newStateHasher(header.Height, tip)
+	c := tx.Bucket(utxoBucket).Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		s.add(k, qbtx.DeserializeOutputs(v))
+	}
+	return &SnapshotMeta{
+		Height:       header.Height,
+		Block_hash:   tip,
+		Genesis_hash: tx.Bucket(heightsBucket).Get(utils.IntToHex(0)),
+		State_hash:   s.sum(),
+		UTXO_count:   s.count,
+	}, nil
+}
+
+// StateHash，计算最新区块处UTXO集合的状态hash，各节点在同一区块处的结果相同，用于核对快照
+// 参数：
+// 返回值：快照信息*SnapshotMeta（高度、区块hash、状态hash等），error
+func (bc *Blockchain) StateHash() (*SnapshotMeta, error) {
+	var meta *SnapshotMeta
+	err := bc.DB.View(func(tx qbstore.Tx) (err error) {
+		meta, err = stateHash(tx)
+		return err
+	})
+	return meta, err
+}
+
+// ExportSnapshot，导出最新区块处的UTXO快照：快照信息、创世区块、其后至快照高度前的区块头、快照所在区块与全部未花费输出。
+// 新节点导入后可从快照高度起同步，无需重放之前的区块
+// 参数：输出io.Writer
+// 返回值：快照信息*SnapshotMeta，error
+func (bc *Blockchain) ExportSnapshot(w io.Writer) (*SnapshotMeta, error) {
+	var meta *SnapshotMeta
+	err := bc.DB.View(func(tx qbstore.Tx) error { // 在同一只读事务中导出，不受并发写入影响
+		var err error
+		if meta, err = stateHash(tx); err != nil {
+			return err
+		}
+		sw, err := newStreamWriter(w, SNAPSHOT_STREAM_MAGIC)
+		if err != nil {
+			return err
+		}
+		var buff bytes.Buffer
+		if err = gob.NewEncoder(&buff).Encode(meta); err != nil {
+			return err
+		}
+		if err = sw.writeRecord(buff.Bytes()); err != nil {
+			return err
+		}
+
+		blocks := tx.Bucket(blocksBucket)
+		if err = sw.writeRecord(blocks.Get(meta.Genesis_hash)); err != nil {
+			return err
+		}
+		for height := int64(1); height < meta.Height; height++ {
+			hash := tx.Bucket(heightsBucket).Get(utils.IntToHex(height))
+			if err = sw.writeRecord(tx.Bucket(headersBucket).Get(hash)); err != nil {
+				return err
+			}
+		}
+		if meta.Height > 0 {
+			if err = sw.writeRecord(blocks.Get(meta.Block_hash)); err != nil {
+				return err
+			}
+		}
+
+		c := tx.Bucket(utxoBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if err = sw.writeRecord(k); err != nil {
+				return err
+			}
+			if err = sw.writeRecord(v); err != nil {
+				return err
+			}
+		}
+		return sw.close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// ImportSnapshot，在空的存储中由UTXO快照创建账本：核对文件校验和、区块头与创世区块的连接，并要求快照的状态hash与可信状态hash相同。
+// 账本的基准高度为快照高度，此前的区块只保存区块头，地址收支记录从快照高度之后开始
+// 参数：空的存储qbstore.Store，输入io.ReadSeeker，分发的创世区块，可信状态hash[]byte
+// 返回值：区块链*Blockchain，error；出错时存储中不写入任何内容
+func ImportSnapshot(store qbstore.Store, r io.ReadSeeker, genesis *qblock.Block, trusted []byte) (*Blockchain, error) {
+	sr, err := openStream(r, SNAPSHOT_STREAM_MAGIC)
+	if err != nil {
+		return nil, err
+	}
+	record, err := sr.expect()
+	if err != nil {
+		return nil, err
+	}
+	var meta SnapshotMeta
+	if err = gob.NewDecoder(bytes.NewReader(record)).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStreamCorrupt, err)
+	}
+	if !bytes.Equal(meta.Genesis_hash, genesis.Hash) {
+		return nil, fmt.Errorf("%w: snapshot of genesis %x", ErrSnapshotChain, meta.Genesis_hash)
+	}
+
+	tip := genesis
+	err = store.Update(func(tx qbstore.Tx) error {
+		if tx.Bucket(blocksBucket) != nil {
+			return ErrLedgerExists
+		}
+		buckets := []string{blocksBucket, headersBucket, heightsBucket, txindexBucket, utxoBucket, undoBucket, addrHistoryBucket, addrUTXOBucket}
+		for _, bucket := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		blocks := tx.Bucket(blocksBucket)
+
+		record, err := sr.expect()
+		if err != nil {
+			return err
+		}
+		first, err := qblock.DecodeBlock(record)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrStreamCorrupt, err)
+		}
+		if !bytes.Equal(first.Hash, genesis.Hash) {
+			return fmt.Errorf("%w: genesis block differs", ErrSnapshotChain)
+		}
+		if err = blocks.Put(genesis.Hash, genesis.SerializeBlock()); err != nil {
+			return err
+		}
+		if err = indexBlock(tx, genesis); err != nil {
+			return err
+		}
+
+		prev := genesis.Header()
+		for height := int64(1); height < meta.Height; height++ {
+			record, err := sr.expect()
+			if err != nil {
+				return err
+			}
+			header, err := qblock.DecodeHeader(record)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrStreamCorrupt, err)
+			}
+			if !extends(header, prev) {
+				return fmt.Errorf("%w: height %d", ErrSnapshotChain, height)
+			}
+			if err = tx.Bucket(headersBucket).Put(header.Hash, record); err != nil {
+				return err
+			}
+			if err = tx.Bucket(heightsBucket).Put(utils.IntToHex(height), header.Hash); err != nil {
+				return err
+			}
+			prev = header
+		}
+		if meta.Height > 0 {
+			record, err := sr.expect()
+			if err != nil {
+				return err
+			}
+			if tip, err = qblock.DecodeBlock(record); err != nil {
+				return fmt.Errorf("%w: %v", ErrStreamCorrupt, err)
+			}
+			if !tip.VerifyMerkleRoot() || !extends(tip.Header(), prev) {
+				return fmt.Errorf("%w: height %d", ErrSnapshotChain, meta.Height)
+			}
+			if err = qbvalidate.VerifyBlockSign(tip); err != nil {
+				return &qbvalidate.BlockError{Hash: tip.Hash, Height: tip.Height, Err: err}
+			}
+			if err = blocks.Put(tip.Hash, record); err != nil {
+				return err
+			}
+			if err = indexBlock(tx, tip); err != nil {
+				return err
+			}
+		}
+		if !bytes.Equal(tip.Hash, meta.Block_hash) {
+			return fmt.Errorf("%w: snapshot block %x", ErrSnapshotChain, meta.Block_hash)
+		}
+
+		s := newStateHasher(meta.Height, tip.Hash)
+		for {
+			key, err := sr.next()
+			if err != nil {
+				return err
+			}
+			if key == nil {
+				break
+			}
+			value, err := sr.expect()
+			if err != nil {
+				return err
+			}
+			outs, err := qbtx.DecodeOutputs(value)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrStreamCorrupt, err)
+			}
+			s.add(key, outs)
+			if err = tx.Bucket(utxoBucket).Put(key, value); err != nil {
+				return err
+			}
+			for i, out := range outs.Outputs {
+				err = tx.Bucket(addrUTXOBucket).Put(addrUTXOKey(out.TX_dst, key, outs.OutputIndex(i)), addrUTXOValue(out))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if s.count != meta.UTXO_count || !bytes.Equal(s.sum(), trusted) {
+			return fmt.Errorf("%w: got %x", ErrStateHash, s.sum())
+		}
+
+		for key, value := range map[string][]byte{"last": tip.Hash, genesisKey: genesis.Hash, baseKey: utils.IntToHex(meta.Height)} {
+			if err = blocks.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Blockchain{tip: tip.Hash, DB: store}, nil
+}
+
+// extends，判断区块头hash与内容一致，且衔接在父区块头之后
+func extends(header, parent *qblock.BlockHeader) bool {
+	return bytes.Equal(header.Hash, header.HeaderToResolveHash()) &&
+		bytes.Equal(header.Prev_block_hash, parent.Hash) && header.Height == parent.Height+1
+}
@@ -0,0 +1,160 @@
+package quantumbc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// 导出文件格式：8字节类型标识 | 4字节版本 | 若干记录（4字节长度+内容） | 长度为0的结束记录 | 之前全部内容的SHA-256校验和
+const (
+	CHAIN_STREAM_MAGIC    = "QBCHAIN\x00"    // 区块导出文件
+	SNAPSHOT_STREAM_MAGIC = "QBSNAP\x00\x00" // UTXO快照文件
+	STREAM_VERSION        = 1                // 当前导出格式版本
+	MAX_STREAM_RECORD     = 64 << 20         // 单条记录的最大长度，防止损坏的长度字段导致过量分配
+)
+
+// 读取导出文件时的错误
+var (
+	ErrStreamMagic    = errors.New("file is not a ledger stream of the expected kind") // 文件类型标识不符
+	ErrStreamVersion  = errors.New("unsupported ledger stream version")                // 不支持的格式版本
+	ErrStreamChecksum = errors.New("ledger stream checksum mismatch")                  // 校验和不符，文件损坏或被截断
+	ErrStreamCorrupt  = errors.New("ledger stream is malformed")                       // 记录格式错误
+)
+
+// streamWriter，写入导出文件并同时计算校验和
+type streamWriter struct {
+	w   io.Writer
+	sum hash.Hash
+}
+
+// newStreamWriter，写入文件头
+// 参数：输出，类型标识
+// 返回值：*streamWriter，error
+func newStreamWriter(w io.Writer, magic string) (*streamWriter, error) {
+	sw := &streamWriter{w: w, sum: sha256.New()}
+	header := append([]byte(magic), make([]byte, 4)...)
+	binary.BigEndian.PutUint32(header[len(magic):], STREAM_VERSION)
+	return sw, sw.write(header)
+}
+
+// write，写入内容并计入校验和
+func (sw *streamWriter) write(data []byte) error {
+	sw.sum.Write(data)
+	_, err := sw.w.Write(data)
+	return err
+}
+
+// writeRecord，写入一条记录，记录内容不能为空
+func (sw *streamWriter) writeRecord(data []byte) error {
+	if len(data) == 0 || len(data) > MAX_STREAM_RECORD {
+		return fmt.Errorf("%w: record of %d bytes", ErrStreamCorrupt, len(data))
+	}
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(data)))
+	if err := sw.write(length); err != nil {
+		return err
+	}
+	return sw.write(data)
+}
+
+// close，写入结束记录与校验和
+func (sw *streamWriter) close() error {
+	if err := sw.write(make([]byte, 4)); err != nil {
+		return err
+	}
+	_, err := sw.w.Write(sw.sum.Sum(nil))
+	return err
+}
+
+// streamReader，读取导出文件的记录
+type streamReader struct {
+	r   io.Reader
+	sum hash.Hash
+}
+
+// openStream，先完整读取一遍文件核对类型、版本与校验和，再回到第一条记录，保证导入前文件完整
+// 参数：输入，类型标识
+// 返回值：*streamReader，error
+func openStream(r io.ReadSeeker, magic string) (*streamReader, error) {
+	sr, err := newStreamReader(r, magic)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		record, err := sr.next()
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			break
+		}
+	}
+	want := make([]byte, sha256.Size)
+	if _, err = io.ReadFull(r, want); err != nil || !bytes.Equal(want, sr.sum.Sum(nil)) {
+		return nil, ErrStreamChecksum
+	}
+	if n, _ := r.Read(make([]byte, 1)); n != 0 {
+		return nil, fmt.Errorf("%w: data after checksum", ErrStreamCorrupt)
+	}
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return newStreamReader(r, magic)
+}
+
+// newStreamReader，读取并核对文件头
+func newStreamReader(r io.Reader, magic string) (*streamReader, error) {
+	sr := &streamReader{r: r, sum: sha256.New()}
+	header, err := sr.read(len(magic) + 4)
+	if err != nil {
+		return nil, ErrStreamMagic
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrStreamMagic
+	}
+	if version := binary.BigEndian.Uint32(header[len(magic):]); version != STREAM_VERSION {
+		return nil, fmt.Errorf("%w: %d", ErrStreamVersion, version)
+	}
+	return sr, nil
+}
+
+// read，读取n字节并计入校验和，文件提前结束时返回ErrStreamChecksum
+func (sr *streamReader) read(n int) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, data); err != nil {
+		return nil, ErrStreamChecksum
+	}
+	sr.sum.Write(data)
+	return data, nil
+}
+
+// next，读取下一条记录，读到结束记录时返回nil
+func (sr *streamReader) next() ([]byte, error) {
+	length, err := sr.read(4)
+	if err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length)
+	if n == 0 {
+		return nil, nil
+	}
+	if n > MAX_STREAM_RECORD {
+		return nil, fmt.Errorf("%w: record of %d bytes", ErrStreamCorrupt, n)
+	}
+	return sr.read(int(n))
+}
+
+// expect，读取下一条记录，提前读到结束记录时返回ErrStreamCorrupt
+func (sr *streamReader) expect() ([]byte, error) {
+	record, err := sr.next()
+	if err == nil && record == nil {
+		err = fmt.Errorf("%w: unexpected end of records", ErrStreamCorrupt)
+	}
+	return record, err
+}
@@ -0,0 +1,226 @@
+package quantumbc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"qb/qbstore"
+	"qb/qbvalidate"
+	"qblock"
+	"qbtx"
+	"sort"
+	"utils"
+)
+
+// ChainIssue，账本审计发现的一处问题
+type ChainIssue struct {
+	Height int64 // 所在区块高度，无法对应到区块时为-1
+	Err    error // 问题描述
+}
+
+// ChainAudit，账本审计结果
+type ChainAudit struct {
+	Blocks       int          // 检查的区块数
+	Transactions int          // 检查的交易数
+	Base         int64        // 账本的基准高度，从快照启动或修剪过的账本只检查基准高度及之后的区块
+	Certs        int          // 检查的已修剪区块的提议者签名数
+	UTXO_checked bool         // 是否比较了UTXO集合，基准高度大于0的账本没有完整区块，无法重建
+	Issues       []ChainIssue // 发现的全部问题，按高度排列
+}
+
+// VerifyChain，审计账本：用BlockchainIterator自最新区块向前遍历至创世区块（从快照启动或修剪过的账本至基准高度），对每个区块重新计算hash与默克尔树根、
+// 检查高度与前一区块hash的衔接、区块头与高度、交易索引、提议者签名与每笔交易的ID、签名和锁定脚本，再以遍历结果重建UTXO集合与存储的chainstate比较。
+// 基准高度之前已修剪的区块只剩区块头，以certs bucket中保存的提议者签名校验区块头。遇到问题不中止，记录全部问题
+// 参数：
+// 返回值：审计结果*ChainAudit
+func (bc *Blockchain) VerifyChain() *ChainAudit {
+	bc.write.Lock() // 审计期间不连接新区块
+	defer bc.write.Unlock()
+
+	base := bc.BaseHeight()
+	audit := &ChainAudit{Base: base}
+	report := func(height int64, err error) {
+		audit.Issues = append(audit.Issues, ChainIssue{height, err})
+	}
+	UTXO := make(map[string]qbtx.TXOutputs)
+	spentTXOs := make(map[string][]int)
+	txHeights := make(map[string]int64) // 交易ID对应的区块高度，用于定位UTXO差异
+
+	bci := bc.Iterator()
+	var child *qblock.Block // 上一次遍历到的区块，即当前区块的子区块
+	for {
+		block, err := bci.NextBlock()
+		if err != nil {
+			height := int64(-1)
+			if child != nil {
+				height = child.Height - 1
+			}
+			report(height, err)
+			return audit.sorted()
+		}
+		audit.Blocks++
+		audit.Transactions += len(block.Transactions)
+		if child != nil && child.Height != block.Height+1 {
+			report(child.Height, fmt.Errorf("%w: parent has height %d", qbvalidate.ErrBlockHeightMismatch, block.Height))
+		}
+		bc.verifyBlock(block, func(err error) { report(block.Height, err) })
+		collectUTXO(block, UTXO, spentTXOs)
+		for _, tx := range block.Transactions {
+			txHeights[hex.EncodeToString(tx.TX_id)] = block.Height
+		}
+
+		if len(block.Prev_block_hash) == 0 {
+			if block.Height != 0 {
+				report(block.Height, qbvalidate.ErrGenesisInvalid)
+			}
+			break
+		}
+		if base > 0 && block.Height <= base { // 基准高度之前的区块未保存
+			bc.verifyCerts(base, audit, report)
+			return audit.sorted()
+		}
+		child = block
+	}
+
+	audit.UTXO_checked = true
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		compareUTXO(tx, UTXO, func(txID string, err error) {
+			height, ok := txHeights[txID]
+			if !ok {
+				height = -1
+			}
+			report(height, err)
+		})
+		return nil
+	})
+	if err != nil {
+		report(-1, err)
+	}
+	return audit.sorted()
+}
+
+// verifyBlock，检查单个区块的内容、签名及其在索引中的记录，每处问题调用一次report
+func (bc *Blockchain) verifyBlock(block *qblock.Block, report func(error)) {
+	if !bytes.Equal(block.Hash, block.BlockToResolveHash()) {
+		report(qbvalidate.ErrBlockHashMismatch)
+	}
+	if !block.VerifyMerkleRoot() {
+		report(qbvalidate.ErrBlockMerkleMismatch)
+	}
+	if block.Height > 0 { // 创世区块不签名
+		if err := qbvalidate.VerifyBlockSign(block); err != nil {
+			report(err)
+		}
+	}
+	for _, tx := range block.Transactions {
+		if !bytes.Equal(tx.TX_id, tx.SetID()) {
+			report(fmt.Errorf("%w: %x", qbvalidate.ErrTXIDMismatch, tx.TX_id))
+		}
+		for _, err := range tx.VerifyUSSTransactionSign() {
+			report(err)
+		}
+	}
+
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		header := tx.Bucket(headersBucket).Get(block.Hash)
+		if !bytes.Equal(header, block.Header().SerializeHeader()) {
+			report(fmt.Errorf("%w: stored header differs from the block", ErrIndexMismatch))
+		}
+		if hash := tx.Bucket(heightsBucket).Get(utils.IntToHex(block.Height)); !bytes.Equal(hash, block.Hash) {
+			report(fmt.Errorf("%w: height index points to %x", ErrIndexMismatch, hash))
+		}
+		verifyScripts(tx, block, report)
+		for i, transaction := range block.Transactions {
+			data := tx.Bucket(txindexBucket).Get(transaction.TX_id)
+			if data == nil {
+				report(fmt.Errorf("%w: transaction %x is not indexed", ErrIndexMismatch, transaction.TX_id))
+				continue
+			}
+			loc := deserializeTXLocation(data)
+			if !bytes.Equal(loc.Block_hash, block.Hash) || loc.Height != block.Height || loc.Index != i {
+				report(fmt.Errorf("%w: transaction %x is indexed at block %d position %d", ErrIndexMismatch, transaction.TX_id, loc.Height, loc.Index))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		report(err)
+	}
+}
+
+// verifyCerts，以保存的提议者签名校验基准高度之前各区块头：区块头hash与内容一致，签名者为区块头记录的提议者且签名有效。
+// 早于快照的区块从未保存，没有签名，不做检查
+func (bc *Blockchain) verifyCerts(base int64, audit *ChainAudit, report func(int64, error)) {
+	err := bc.DB.View(func(tx qbstore.Tx) error {
+		certs := tx.Bucket(certsBucket)
+		if certs == nil {
+			return nil
+		}
+		for height := int64(1); height < base; height++ {
+			hash := tx.Bucket(heightsBucket).Get(utils.IntToHex(height))
+			data := certs.Get(hash)
+			if data == nil {
+				continue
+			}
+			audit.Certs++
+			header := qblock.DeserializeHeader(tx.Bucket(headersBucket).Get(hash))
+			if !bytes.Equal(header.Hash, header.HeaderToResolveHash()) {
+				report(height, qbvalidate.ErrBlockHashMismatch)
+			}
+			cert := deserializeCert(data)
+			if cert.Main_row_num.Sign_node_name != header.Proposer {
+				report(height, fmt.Errorf("%w: signed by %s, proposed by %s", qbvalidate.ErrBlockSignUnknown, cert.Main_row_num.Sign_node_name, header.Proposer))
+			}
+			if err := qbvalidate.VerifyBlockSign(&qblock.Block{Hash: header.Hash, Block_uss: cert}); err != nil {
+				report(height, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		report(-1, err)
+	}
+}
+
+// verifyScripts，对照被花费的输出校验区块中各输入项的锁定脚本，时间锁定与父区块的时间戳比较。
+// 被花费的输出取自区块的撤销数据，没有撤销数据的旧区块通过交易索引查找
+func verifyScripts(tx qbstore.Tx, block *qblock.Block, report func(error)) {
+	cache := map[string]*qblock.Block{string(block.Hash): block}
+	var undo []SpentOutput // 按输入顺序记录的被花费输出
+	if data := tx.Bucket(undoBucket).Get(block.Hash); data != nil {
+		undo = deserializeUndo(data)
+	}
+	target := qbvalidate.TargetBlock{Height: block.Height}
+	if data := tx.Bucket(headersBucket).Get(block.Prev_block_hash); data != nil {
+		target.Time_stamp = qblock.DeserializeHeader(data).Time_stamp
+	}
+
+	for _, transaction := range block.Transactions {
+		if transaction.IsReserveTX() || transaction.IsFeeTX() {
+			continue
+		}
+		for in_id, vin := range transaction.TX_vin {
+			var out qbtx.TXOutput
+			if len(undo) > 0 {
+				out, undo = undo[0].Output, undo[1:]
+			} else {
+				var ok bool
+				if out, ok = lookupOutput(tx, vin.Refer_tx_id, vin.Refer_tx_id_index, cache); !ok {
+					report(fmt.Errorf("%w: %x:%d", ErrMissingUTXO, vin.Refer_tx_id, vin.Refer_tx_id_index))
+					continue
+				}
+			}
+			if err := qbvalidate.VerifyInputScript(transaction, in_id, out, target); err != nil {
+				report(&qbtx.TXInputError{TX_id: transaction.TX_id, In_id: in_id, Err: err})
+			}
+		}
+	}
+}
+
+// sorted，按高度排列问题，同一区块内保持发现的顺序
+func (audit *ChainAudit) sorted() *ChainAudit {
+	sort.SliceStable(audit.Issues, func(i, j int) bool {
+		return audit.Issues[i].Height < audit.Issues[j].Height
+	})
+	return audit
+}
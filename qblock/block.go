@@ -5,12 +5,9 @@ package qblock
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/gob"
-	"encoding/json"
 	"log"
 	"merkletree"
-	"os"
 	"qbtx"
 	"qkdserv"
 	"time"
@@ -21,6 +18,13 @@ import (
 // 区块包含的最小交易数量
 const BLOCK_LENGTH = 1
 
+// 区块版本：1为旧版区块，交易默克尔树使用merkletree.VERSION_1，叶子为交易的序列化结果；2起使用merkletree.VERSION_2，叶子为交易的规范编码
+const (
+	BLOCK_VERSION_1 = 1
+	BLOCK_VERSION_2 = 2
+	BLOCK_VERSION   = BLOCK_VERSION_2 // 新区块的版本
+)
+
 // 区块结构
 type Block struct {
 	Version    int64 `json:"Version"`   // 当前版本
@@ -28,17 +32,26 @@ type Block struct {
 	Height     int64 `json:"Height"`    // 区块高度
 
 	Prev_block_hash []byte              `json:"Prevblockhash"` // 前一区块hash值
+	Merkle_root     []byte              `json:"Merkleroot"`    // 交易默克尔树根节点hash
 	Hash            []byte              `json:"Currentblockhash"`
 	Transactions    []*qbtx.Transaction `json:"Transactions"` // 用于共识的交易信息
 	Block_uss       uss.USSToeplitzHashSignMsg
 }
 
-// NewBlock，生成新区块
-// 参数：交易[]*qbtx.Transaction，前一区块hashprevBlockHash，高度值int64
+// NewBlock，生成新区块。手续费总额大于0时，在区块首部加入一笔向提议者（当前节点）支付手续费的交易
+// 参数：交易[]*qbtx.Transaction，前一区块hashprevBlockHash，高度值int64，手续费总额int
 // 返回值：新区块*Block
-func NewBlock(transactions []*qbtx.Transaction, prevBlockHash []byte, height int64) *Block {
+func NewBlock(transactions []*qbtx.Transaction, prevBlockHash []byte, height int64, fee int) *Block {
+	if fee > 0 {
+		proposer := utils.GetNodeAddr(qkdserv.Node_name)
+		if proposer == "" {
+			log.Panicf("ERROR: proposer %s has no wallet address", qkdserv.Node_name)
+		}
+		fee_tx := qbtx.NewFeeTX(fee, proposer, height)
+		transactions = append([]*qbtx.Transaction{fee_tx}, transactions...)
+	}
 	block := Block{
-		Version:    1.0,
+		Version:    BLOCK_VERSION,
 		Time_stamp: time.Now().Unix(),
 		Height:     height,
 
@@ -60,7 +73,8 @@ func NewBlock(transactions []*qbtx.Transaction, prevBlockHash []byte, height int
 			USS_unit_len: 16,         // 签名的单位长度，一般默认为16
 		},
 	}
-	block.Hash = block.BlockToResolveHash() // 生成当前区块hash值
+	block.Merkle_root = block.HashTransactions() // 记录默克尔树根
+	block.Hash = block.BlockToResolveHash()      // 生成当前区块hash值
 	block.Block_uss.USS_message = block.Hash
 	block.Block_uss = uss.UnconditionallySecureSign(block.Block_uss.Sign_index,
 		block.Block_uss.USS_counts, block.Block_uss.USS_unit_len,
@@ -69,61 +83,148 @@ func NewBlock(transactions []*qbtx.Transaction, prevBlockHash []byte, height int
 	return &block
 }
 
-// NewGenesisBlock，创建创世区块。实际操作是读取固定区块以保证各节点有相同的账本
-// 参数：准备金交易
-// 返回值：创世区块
-func NewGenesisBlock(reserve *qbtx.Transaction) *Block {
-	file, _ := os.Open("../config/genesisblock.json") // 打开文件
-	defer file.Close()                                // 关闭文件
-	// NewDecoder创建一个从file读取并解码json对象的*Decoder，解码器有自己的缓冲，并可能超前读取部分json数据。
-	decoder := json.NewDecoder(file)
-	var block Block
-	err := decoder.Decode(&block) //Decode从输入流读取下一个json编码值并保存在v指向的值里
-	if err != nil {
-		panic(err)
-	}
-	return &block
+// Proposer，区块提议者，即区块签名者
+// 参数：区块
+// 返回值：提议者节点名称string
+func (b *Block) Proposer() string {
+	return b.Block_uss.Main_row_num.Sign_node_name
 }
 
-// NewBlock，生成新区块hash值
+// BlockToResolveHash，生成区块hash值，由区块头计算
 // 参数：区块
 // 返回值：该区块hash值
 func (b *Block) BlockToResolveHash() []byte {
-	data := b.prepareData()
-	hash := sha256.Sum256(data) // 取区块hash
-	return hash[:]
+	return b.Header().HeaderToResolveHash()
 }
 
-// prepareData，数据准备函数，利用join完成字节切片的组合
+// HashTransactions，构建区块交易hash值，实现一种交易转[]byte的方法
 // 参数：区块
-// 返回值：待hash的区块消息
-func (b *Block) prepareData() []byte {
-	data := bytes.Join(
-		[][]byte{
-			utils.IntToHex(b.Version),
-			utils.IntToHex(b.Time_stamp),
-			utils.IntToHex(b.Height),
-			b.Prev_block_hash,
-			b.HashTransactions(), // 默克尔树根节点
-		},
-		[]byte{},
-	)
+// 返回值：区块中交易信息的hash值，交易数超出默克尔树构造版本的范围时为nil
+func (b *Block) HashTransactions() []byte {
+	root, err := b.merkleTree()
+	if err != nil {
+		return nil
+	}
+	return root.RootNode.Data
+}
 
-	return data
+// merkleTree，按区块版本对应的构造版本将区块交易组建为默克尔树
+func (b *Block) merkleTree() (*merkletree.MerkleTree, error) {
+	var transactions [][]byte
+	for _, tx := range b.Transactions {
+		transactions = append(transactions, merkleLeaf(b.Version, tx))
+	}
+	return merkletree.NewVersionedMerkleTree(MerkleVersion(b.Version), transactions)
 }
 
-// HashTransactions，构建区块交易hash值，实现一种交易转[]byte的方法
+// merkleLeaf，交易在默克尔树中的叶子：旧版区块为交易按旧版结构的序列化结果（见qbtx.SerializeTXV1），之后为交易的规范编码，不随交易结构新增的字段改变
+func merkleLeaf(block_version int64, tx *qbtx.Transaction) []byte {
+	if block_version <= BLOCK_VERSION_1 {
+		return tx.SerializeTXV1()
+	}
+	return tx.EncodeTX()
+}
+
+// MerkleVersion，区块版本对应的默克尔树构造版本，保证旧区块仍按原方式校验
+// 参数：区块版本int64
+// 返回值：默克尔树构造版本int
+func MerkleVersion(block_version int64) int {
+	if block_version <= BLOCK_VERSION_1 {
+		return merkletree.VERSION_1
+	}
+	return merkletree.VERSION_2
+}
+
+// MerkleRoot，获取区块头中的默克尔树根；未记录根的旧区块（如创世区块）由交易重新计算
 // 参数：区块
-// 返回值：区块中交易信息的hash值
-func (b *Block) HashTransactions() []byte {
-	var transactions [][]byte
+// 返回值：默克尔树根节点hash
+func (b *Block) MerkleRoot() []byte {
+	if len(b.Merkle_root) == 0 {
+		return b.HashTransactions()
+	}
+	return b.Merkle_root
+}
 
-	for _, tx := range b.Transactions {
-		transactions = append(transactions, tx.SerializeTX())
+// VerifyMerkleRoot，检查区块头中的默克尔树根与区块交易一致，交易无法组建默克尔树时不一致
+// 参数：区块
+// 返回值：检查结果bool
+func (b *Block) VerifyMerkleRoot() bool {
+	mTree, err := b.merkleTree()
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(b.MerkleRoot(), mTree.RootNode.Data)
+}
+
+// TXProof，交易包含证明：交易、所在区块的区块头与默克尔证明，客户端无需下载整个区块即可确认交易已上链
+type TXProof struct {
+	TX    *qbtx.Transaction      `json:"TX"`    // 被证明的交易
+	Index int                    `json:"Index"` // 交易在区块中的位置
+	Proof []merkletree.ProofNode `json:"Proof"` // 默克尔证明
+
+	Version         int64  `json:"Version"`          // 区块头：版本
+	Time_stamp      int64  `json:"Timestamp"`        // 区块头：时间戳
+	Height          int64  `json:"Height"`           // 区块头：高度
+	Prev_block_hash []byte `json:"Prevblockhash"`    // 区块头：前一区块hash值
+	Merkle_root     []byte `json:"Merkleroot"`       // 区块头：默克尔树根
+	Block_hash      []byte `json:"Currentblockhash"` // 区块hash
+}
+
+// NewTXProof，生成区块中指定交易的包含证明
+// 参数：区块，交易ID[]byte
+// 返回值：交易包含证明*TXProof，交易不在区块中或无法组建默克尔树时返回false
+func (b *Block) NewTXProof(txid []byte) (*TXProof, bool) {
+	index := -1
+	for i, tx := range b.Transactions {
+		if bytes.Equal(tx.TX_id, txid) {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return nil, false
 	}
-	mTree := merkletree.NewMerkleTree(transactions)
+	mTree, err := b.merkleTree()
+	if err != nil { // 交易无法组建默克尔树的区块不能通过校验，不会上链
+		return nil, false
+	}
+	proof, err := mTree.Proof(index)
+	if err != nil {
+		log.Panic(err)
+	}
+	return &TXProof{
+		TX:    b.Transactions[index],
+		Index: index,
+		Proof: proof,
+
+		Version:         b.Version,
+		Time_stamp:      b.Time_stamp,
+		Height:          b.Height,
+		Prev_block_hash: b.Prev_block_hash,
+		Merkle_root:     b.MerkleRoot(),
+		Block_hash:      b.Hash,
+	}, true
+}
 
-	return mTree.RootNode.Data
+// Verify，校验交易包含证明：区块头hash与区块hash一致，且默克尔证明能由交易推出区块头中的默克尔树根。
+// 只说明交易在证明所给的区块中，调用方须另从其他节点确认该区块hash已上链
+// 参数：交易包含证明
+// 返回值：校验结果bool
+func (p *TXProof) Verify() bool {
+	if p.TX == nil {
+		return false
+	}
+	header := &BlockHeader{
+		Version:         p.Version,
+		Time_stamp:      p.Time_stamp,
+		Height:          p.Height,
+		Prev_block_hash: p.Prev_block_hash,
+		Merkle_root:     p.Merkle_root,
+	}
+	if !bytes.Equal(header.HeaderToResolveHash(), p.Block_hash) {
+		return false
+	}
+	return merkletree.VerifyVersionedProof(MerkleVersion(p.Version), p.Merkle_root, merkleLeaf(p.Version, p.TX), p.Proof)
 }
 
 // SerializeBlock，区块序列化
@@ -145,11 +246,19 @@ func (b *Block) SerializeBlock() []byte {
 // 参数：序列化结果
 // 返回值：区块
 func DeserializeBlock(d []byte) *Block {
-	var block Block
-	decoder := gob.NewDecoder(bytes.NewReader(d)) // 创建解码器
-	err := decoder.Decode(&block)                 // 解析区块数据
+	block, err := DecodeBlock(d)
 	if err != nil {
 		log.Println(err)
 	}
-	return &block
+	return block
+}
+
+// DecodeBlock，区块反序列化，用于解析文件等不可信来源的数据，数据损坏时返回错误而不中止进程
+// 参数：序列化结果
+// 返回值：区块，解码错误error
+func DecodeBlock(d []byte) (*Block, error) {
+	var block Block
+	decoder := gob.NewDecoder(bytes.NewReader(d)) // 创建解码器
+	err := decoder.Decode(&block)                 // 解析区块数据
+	return &block, err
 }
@@ -0,0 +1,91 @@
+package qblock
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"log"
+	"utils"
+)
+
+// BlockHeader，区块头：不含交易与签名，可单独存储与查询，用于轻客户端、最新区块查询与先同步区块头
+type BlockHeader struct {
+	Version         int64  `json:"Version"`          // 当前版本
+	Time_stamp      int64  `json:"Timestamp"`        // 系统当前时间
+	Height          int64  `json:"Height"`           // 区块高度
+	Prev_block_hash []byte `json:"Prevblockhash"`    // 前一区块hash值
+	Merkle_root     []byte `json:"Merkleroot"`       // 交易默克尔树根节点hash
+	TX_count        int    `json:"TXcount"`          // 区块交易数量
+	Proposer        string `json:"Proposer"`         // 区块提议者
+	Hash            []byte `json:"Currentblockhash"` // 区块hash
+}
+
+// Header，获取区块的区块头
+// 参数：区块
+// 返回值：区块头*BlockHeader
+func (b *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		Version:         b.Version,
+		Time_stamp:      b.Time_stamp,
+		Height:          b.Height,
+		Prev_block_hash: b.Prev_block_hash,
+		Merkle_root:     b.MerkleRoot(),
+		TX_count:        len(b.Transactions),
+		Proposer:        b.Proposer(),
+		Hash:            b.Hash,
+	}
+}
+
+// HeaderToResolveHash，由区块头字段计算区块hash，与Block.BlockToResolveHash结果相同
+// 参数：区块头
+// 返回值：区块hash值
+func (h *BlockHeader) HeaderToResolveHash() []byte {
+	data := bytes.Join(
+		[][]byte{
+			utils.IntToHex(h.Version),
+			utils.IntToHex(h.Time_stamp),
+			utils.IntToHex(h.Height),
+			h.Prev_block_hash,
+			h.Merkle_root, // 默克尔树根节点
+		},
+		[]byte{},
+	)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// SerializeHeader，区块头序列化
+// 参数：待序列化的区块头
+// 返回值：序列化结果
+func (h *BlockHeader) SerializeHeader() []byte {
+	var result bytes.Buffer
+	encoder := gob.NewEncoder(&result) // 生成编码器encoder
+
+	err := encoder.Encode(h) //编码
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+// DeserializeHeader，区块头反序列化
+// 参数：序列化结果
+// 返回值：区块头
+func DeserializeHeader(d []byte) *BlockHeader {
+	header, err := DecodeHeader(d)
+	if err != nil {
+		log.Panic(err)
+	}
+	return header
+}
+
+// DecodeHeader，区块头反序列化，数据损坏时返回错误而不中止进程
+// 参数：序列化结果
+// 返回值：区块头，解码错误error
+func DecodeHeader(d []byte) (*BlockHeader, error) {
+	var header BlockHeader
+	decoder := gob.NewDecoder(bytes.NewReader(d)) // 创建解码器
+	err := decoder.Decode(&header)                // 解析区块头数据
+	return &header, err
+}
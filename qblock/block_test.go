@@ -2,8 +2,11 @@ package qblock
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"qbtx"
 	"qkdserv"
 	"testing"
@@ -42,7 +45,7 @@ func TestBlock(t *testing.T) {
 	}
 	//fmt.Println(g)
 
-	block := NewBlock([]*qbtx.Transaction{reserve_tx}, []byte{}, 1)
+	block := NewBlock([]*qbtx.Transaction{reserve_tx}, []byte{}, 1, 0)
 	b := &bytes.Buffer{}
 	encoder = json.NewEncoder(b)
 	err = encoder.Encode(block)
@@ -51,4 +54,140 @@ func TestBlock(t *testing.T) {
 	}
 	fmt.Println(b)
 
+	// 默克尔证明
+	if !block.VerifyMerkleRoot() {
+		t.Error("merkle root of block is wrong")
+	}
+	proof, ok := block.NewTXProof(reserve_tx.TX_id)
+	if !ok || proof.Index != 0 || !proof.Verify() {
+		t.Error("merkle proof of transaction is invalid")
+	}
+	proof.Height++ // 篡改区块头
+	if proof.Verify() {
+		t.Error("merkle proof with forged header is valid")
+	}
+
+	// 旧版区块仍按VERSION_1与旧版交易结构计算默克尔树根：block_v1.json由旧版代码打包，含准备金交易与一笔带签名的交易
+	data, err := os.ReadFile("testdata/block_v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v1 Block
+	if err = json.Unmarshal(data, &v1); err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(v1.BlockToResolveHash()); got != "6ee5028d097ca4233b14bd343260c215e391dfd0c614c24daab61f32a5be757f" || !bytes.Equal(v1.Hash, v1.BlockToResolveHash()) {
+		t.Errorf("hash of version 1 block changed: %s", got)
+	}
+	if proof, ok := v1.NewTXProof(v1.Transactions[1].TX_id); !ok || !proof.Verify() {
+		t.Error("merkle proof in version 1 block is invalid")
+	}
+
+	// 新版区块支持任意交易数量与空区块
+	var txs []*qbtx.Transaction
+	for i := 0; i < 7; i++ {
+		txs = append(txs, qbtx.NewReserveTX(addresses[:1], ""))
+	}
+	for _, n := range []int{0, 5, 7} {
+		block = NewBlock(txs[:n], block.Hash, 3, 0)
+		if !block.VerifyMerkleRoot() {
+			t.Errorf("merkle root of block with %d transactions is wrong", n)
+		}
+		for _, tx := range txs[:n] {
+			if proof, ok := block.NewTXProof(tx.TX_id); !ok || !proof.Verify() {
+				t.Errorf("merkle proof in block with %d transactions is invalid", n)
+			}
+		}
+	}
+
+	// 交易数超出VERSION_1构造范围的旧版区块不能通过校验，不会越界访问
+	legacy := NewBlock(txs[:5], block.Hash, 3, 0)
+	legacy.Version, legacy.Merkle_root = BLOCK_VERSION_1, nil
+	if legacy.VerifyMerkleRoot() || legacy.HashTransactions() != nil {
+		t.Error("version 1 block with 5 transactions has a merkle root")
+	}
+	if _, ok := legacy.NewTXProof(txs[0].TX_id); ok {
+		t.Error("version 1 block with 5 transactions has a merkle proof")
+	}
+
+	// 区块头可单独序列化，并能算出相同的区块hash
+	header := DeserializeHeader(block.Header().SerializeHeader())
+	if !bytes.Equal(header.HeaderToResolveHash(), block.Hash) || header.TX_count != len(block.Transactions) ||
+		header.Proposer != "P1" {
+		t.Error("block header is wrong")
+	}
+
+	// 手续费交易位于区块首部，支付给提议者
+	block = NewBlock([]*qbtx.Transaction{reserve_tx}, block.Hash, 2, 3)
+	fee_tx := block.Transactions[0]
+	if len(block.Transactions) != 2 || !fee_tx.IsFeeTX() || fee_tx.TX_vout[0].TX_value != 3 ||
+		utils.GetAddrOwner(fee_tx.TX_vout[0].TX_dst) != block.Proposer() {
+		t.Error("fee transaction is not paid to the proposer")
+	}
+}
+
+func TestGenesis(t *testing.T) {
+	fmt.Println("====================================[genesis spec]==================================")
+	spec, err := LoadGenesisSpec(GENESIS_SPEC_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 相同配置得到相同的创世区块，与分发的创世区块一致
+	genesis := NewGenesisBlock(spec)
+	if !bytes.Equal(genesis.Hash, NewGenesisBlock(spec).Hash) {
+		t.Error("genesis block is not deterministic")
+	}
+	distributed, err := LoadGenesisBlock(GENESIS_BLOCK_PATH)
+	if err != nil || !bytes.Equal(distributed.Hash, genesis.Hash) {
+		t.Errorf("distributed genesis block does not match the spec: %v", err)
+	}
+	// 交易与区块头按规范编码计算摘要，交易结构新增字段不改变已分发的创世区块
+	if got := hex.EncodeToString(genesis.Hash); got != "97e25f2600a063b60a6a51576414575d5e02fd08043304fb5a97dae5377d3690" {
+		t.Errorf("genesis block hash changed: %s", got)
+	}
+	params, err := genesis.GenesisParams()
+	if err != nil || params.Chain_id != spec.Chain_id || params.F != spec.F || len(params.Members) != len(spec.Members) ||
+		params.Asset_issuers["BOND"] != "195KpL1PxRzvVKxg33YYbWjgFqxFAbBit9" {
+		t.Errorf("genesis params are wrong: %v", err)
+	}
+	total := 0
+	for _, out := range genesis.Transactions[0].TX_vout {
+		total += out.TX_value
+	}
+	if total != 20*len(spec.Allocations) {
+		t.Error("genesis allocations are wrong")
+	}
+
+	// 修改任一参数都会改变创世区块hash
+	other := *spec
+	other.Chain_id = "other"
+	if bytes.Equal(NewGenesisBlock(&other).Hash, genesis.Hash) {
+		t.Error("chain id does not change the genesis hash")
+	}
+	// 成员不足3F+1、资产编号不合法或资金非正数时配置不合法
+	other = *spec
+	other.F = int64(len(spec.Members))
+	if !errors.Is(other.Check(), ErrGenesisSpec) {
+		t.Error("spec with too few members is valid")
+	}
+	other = *spec
+	other.Asset_issuers = map[string]string{"bond": "195KpL1PxRzvVKxg33YYbWjgFqxFAbBit9"}
+	if !errors.Is(other.Check(), ErrGenesisSpec) {
+		t.Error("spec with an invalid asset id is valid")
+	}
+	other = *spec
+	other.Allocations = map[string]int{"1CG9GcxF2BT1rjxwoMHSLtRP9RTCsSkRyH": 0}
+	if !errors.Is(other.Check(), ErrGenesisSpec) {
+		t.Error("spec with zero allocation is valid")
+	}
+
+	// 被篡改的创世区块无法读取
+	path := t.TempDir() + "/genesisblock.json"
+	genesis.Transactions[0].TX_vout[0].TX_value++
+	if err = WriteGenesisBlock(genesis, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadGenesisBlock(path); !errors.Is(err, ErrGenesisHash) {
+		t.Error("tampered genesis block is accepted")
+	}
 }
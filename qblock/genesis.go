@@ -0,0 +1,166 @@
+package qblock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"qbtx"
+	"sort"
+	"utils"
+)
+
+// 创世配置与创世区块的默认路径
+const (
+	GENESIS_SPEC_PATH  = utils.INIT_PATH + "genesis.json"
+	GENESIS_BLOCK_PATH = utils.INIT_PATH + "genesisblock.json"
+)
+
+// 创世配置或创世区块不合法的原因
+var (
+	ErrGenesisSpec   = errors.New("invalid genesis spec")                           // 创世配置不合法
+	ErrGenesisHash   = errors.New("genesis block hash does not match its content")  // 创世区块hash与内容不符
+	ErrGenesisParams = errors.New("genesis block carries no consortium parameters") // 创世区块未记录联盟参数
+)
+
+// GenesisParams，写入创世区块的联盟参数：链ID、可容忍的拜占庭节点数F、联盟成员与资产发行方，随创世区块hash一起固定
+type GenesisParams struct {
+	Chain_id      string            `json:"ChainID"`                // 链ID，区分不同网络
+	F             int64             `json:"F"`                      // 可容忍的拜占庭节点数，联盟成员至少3F+1个
+	Members       []string          `json:"Members"`                // 联盟成员节点名称
+	Asset_issuers map[string]string `json:"AssetIssuers,omitempty"` // 资产发行方，key=资产编号，value=发行方钱包地址，只有发行方能发行该资产
+}
+
+// GenesisSpec，创世配置：联盟参数、创世时间与各地址的初始资金
+type GenesisSpec struct {
+	GenesisParams
+	Timestamp   int64          `json:"Timestamp"`   // 创世区块时间戳
+	Allocations map[string]int `json:"Allocations"` // 初始资金，key=钱包地址，value=金额
+}
+
+// LoadGenesisSpec，读取并检查创世配置
+// 参数：配置文件路径
+// 返回值：创世配置*GenesisSpec，error
+func LoadGenesisSpec(path string) (*GenesisSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var spec GenesisSpec
+	if err = json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGenesisSpec, err)
+	}
+	if err = spec.Check(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Check，检查创世配置：链ID非空，F非负且成员不少于3F+1个、成员不重复，资产编号合法且发行方非空，初始资金非空且均为正数。地址格式由调用方检查
+// 参数：创世配置
+// 返回值：error，合法时为nil
+func (spec *GenesisSpec) Check() error {
+	if spec.Chain_id == "" {
+		return fmt.Errorf("%w: empty chain id", ErrGenesisSpec)
+	}
+	if spec.F < 0 || int64(len(spec.Members)) < 3*spec.F+1 {
+		return fmt.Errorf("%w: %d members cannot tolerate F=%d", ErrGenesisSpec, len(spec.Members), spec.F)
+	}
+	seen := make(map[string]bool)
+	for _, member := range spec.Members {
+		if member == "" || seen[member] {
+			return fmt.Errorf("%w: empty or duplicate member %q", ErrGenesisSpec, member)
+		}
+		seen[member] = true
+	}
+	for asset, issuer := range spec.Asset_issuers {
+		if err := qbtx.ValidateAssetID(asset); err != nil || issuer == "" {
+			return fmt.Errorf("%w: asset %q or its issuer is not valid", ErrGenesisSpec, asset)
+		}
+	}
+	if len(spec.Allocations) == 0 {
+		return fmt.Errorf("%w: no allocations", ErrGenesisSpec)
+	}
+	for addr, value := range spec.Allocations {
+		if value <= 0 {
+			return fmt.Errorf("%w: allocation of %s is not positive", ErrGenesisSpec, addr)
+		}
+	}
+	return nil
+}
+
+// NewGenesisBlock，由创世配置生成创世区块。地址按字典序排列，联盟参数写入准备金交易的留言，
+// 区块不签名，因此相同配置在任何节点上得到相同的创世区块
+// 参数：创世配置
+// 返回值：创世区块
+func NewGenesisBlock(spec *GenesisSpec) *Block {
+	addresses := make([]string, 0, len(spec.Allocations))
+	for addr := range spec.Allocations {
+		addresses = append(addresses, addr)
+	}
+	sort.Strings(addresses)
+	outputs := make([]qbtx.TXOutput, 0, len(addresses))
+	for _, addr := range addresses {
+		outputs = append(outputs, qbtx.NewTXOutput(spec.Allocations[addr], addr))
+	}
+	params, err := json.Marshal(spec.GenesisParams)
+	if err != nil {
+		panic(err)
+	}
+
+	block := Block{
+		Version:    BLOCK_VERSION,
+		Time_stamp: spec.Timestamp,
+		Height:     0,
+
+		Prev_block_hash: []byte{},
+		Transactions:    []*qbtx.Transaction{qbtx.NewGenesisTX(outputs, string(params))},
+	}
+	block.Merkle_root = block.HashTransactions()
+	block.Hash = block.BlockToResolveHash()
+	return &block
+}
+
+// GenesisParams，读取创世区块中记录的联盟参数
+// 参数：创世区块
+// 返回值：联盟参数*GenesisParams，error
+func (b *Block) GenesisParams() (*GenesisParams, error) {
+	if b.Height != 0 || len(b.Transactions) == 0 || !b.Transactions[0].IsReserveTX() {
+		return nil, ErrGenesisParams
+	}
+	var params GenesisParams
+	if err := json.Unmarshal([]byte(b.Transactions[0].TX_vin[0].TX_src), &params); err != nil || params.Chain_id == "" {
+		return nil, ErrGenesisParams
+	}
+	return &params, nil
+}
+
+// LoadGenesisBlock，读取分发的创世区块，并检查区块hash与默克尔树根与内容一致
+// 参数：创世区块文件路径
+// 返回值：创世区块*Block，error
+func LoadGenesisBlock(path string) (*Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var block Block
+	if err = json.Unmarshal(data, &block); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(block.Hash, block.BlockToResolveHash()) || !block.VerifyMerkleRoot() {
+		return nil, ErrGenesisHash
+	}
+	return &block, nil
+}
+
+// WriteGenesisBlock，将创世区块以json格式写入文件，用于分发给各节点
+// 参数：创世区块，文件路径
+// 返回值：error
+func WriteGenesisBlock(block *Block, path string) error {
+	data, err := json.MarshalIndent(block, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -6,6 +6,7 @@ replace (
 	merkletree => ../merkletree
 	qbtx => ../qbtx
 	qkdserv => ../qkdserv
+	qrng => ../qrng
 	uss => ../uss
 	utils => ../utils
 )
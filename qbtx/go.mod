@@ -4,12 +4,14 @@ go 1.16
 
 replace (
 	qkdserv => ../qkdserv
+	qrng => ../qrng
 	uss => ../uss
 	utils => ../utils
 )
 
 require (
 	qkdserv v0.0.0-00010101000000-000000000000
+	qrng v0.0.0-00010101000000-000000000000
 	uss v0.0.0-00010101000000-000000000000
 	utils v0.0.0-00010101000000-000000000000
 )
@@ -6,12 +6,12 @@ package qbtx
 
 import (
 	"bytes"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
 	"fmt"
 	"log"
 	"qkdserv"
+	"qrng"
 	"uss"
 	"utils"
 )
@@ -19,25 +19,28 @@ import (
 // 定义准备金金额
 const RESERVE = 20
 
+// 手续费交易输入项引用的输出编号，用于与准备金交易（-1）区分
+const FEE_INDEX = -2
+
 // 定义验签者数量
 var N uint32
 
 // Transaction，交易结构，多入多处：
 // 有一些输出并没有被关联到某个输入上；一笔交易的输入可以引用之前多笔交易的输出；一个输入必须引用一个输出
 type Transaction struct {
-	TX_id   []byte     `json:"TXid"`   // 交易ID，非常重要的Hash值，是在input签名之前计算出来的，作为UTXOSet.map的key存在
+	TX_id   []byte     `json:"TXid"`   // 交易ID，非常重要的Hash值，为交易规范编码（含输入项签名，不含解锁脚本）的摘要，须在签名之后计算，作为UTXOSet.map的key存在
 	TX_vin  []TXInput  `json:"TXvin"`  // 交易输入项
 	TX_vout []TXOutput `json:"TXvout"` // 交易输出项
+
+	Lock_time   int64  `json:"LockTime,omitempty"`   // 锁定时间，交易只能打包进不早于该高度或时间的区块，0表示不锁定，见IsFinal
+	Issue_asset string `json:"IssueAsset,omitempty"` // 发行交易增发或回收的资产编号，须有一个输入项来自该资产配置的发行方地址；普通交易为空
 }
 
-// SetID，根据交易输入与输出项生成交易ID。
+// SetID，根据交易输入与输出项生成交易ID，即不含解锁脚本的交易规范编码（见EncodeTX）的摘要，不随交易结构新增的字段与解锁脚本改变
 // 参数：交易
 // 返回值：交易ID
 func (tx *Transaction) SetID() []byte {
-	var hash [32]byte
-	tx_copy := tx
-	tx_copy.TX_id = []byte{}
-	hash = sha256.Sum256(tx_copy.SerializeTX())
+	hash := sha256.Sum256(tx.encodeID())
 	return hash[:]
 }
 
@@ -69,15 +72,15 @@ func DeserializeTX(data []byte) *Transaction {
 	return tx
 }
 
-// USSTransactionSign，对交易输入项签名
+// USSTransactionSign，对交易输入项签名，带解锁脚本的输入项以脚本中的签名花费，此处跳过
 // 参数：交易，节点名称
 // 返回值：无，交易带签名值
 func (tx *Transaction) USSTransactionSign(node_name string) {
-	tx_copy := tx.TrimmedCopyTX() // 复制并修剪交易以得到待签名数据
-
-	for in_id, input := range tx_copy.TX_vin { // 循环向输入项签名
-		tx_copy.TX_vin[in_id].TX_uss_sign = uss.USSToeplitzHashSignMsg{} // 置空
-		data_to_sign := input.SerializeInput()                           // 待签名数据
+	for in_id := range tx.TX_vin { // 循环向输入项签名
+		if len(tx.TX_vin[in_id].Unlock_script) > 0 {
+			continue
+		}
+		data_to_sign := tx.SignMessage(in_id) // 待签名数据
 		signature := uss.USSToeplitzHashSignMsg{
 			Sign_index: qkdserv.QKDSignMatrixIndex{
 				Sign_dev_id:  utils.GetNodeID(node_name),
@@ -98,36 +101,91 @@ func (tx *Transaction) USSTransactionSign(node_name string) {
 	}
 }
 
-// VerifyUSSTransactionSign,交易输入项验签
-// 参数：带有签名的交易
-// 返回值：验签结果bool
-func (tx *Transaction) VerifyUSSTransactionSign() bool {
-	txCopy := tx
+// SignMessage，生成输入项的待签名消息：修剪后交易与输入项编号的摘要，签名覆盖交易的全部输入与输出
+// 参数：交易，输入项编号int
+// 返回值：待签名消息[]byte
+func (tx *Transaction) SignMessage(in_id int) []byte {
+	tx_copy := tx.TrimmedCopyTX()
+	data := append(tx_copy.EncodeTX(), utils.IntToHex(int64(in_id))...)
+	return utils.Digest(data)
+}
 
-	for inID := range tx.TX_vin {
-		if !uss.UnconditionallySecureVerifySign(txCopy.TX_vin[inID].TX_uss_sign) {
-			fmt.Println("verify of tx wrong")
+// VerifyUSSTransactionSign,交易输入项验签：检查签名消息与修剪交易一致、签名者为输入项来源地址的所有者、无条件安全签名有效。
+// 带解锁脚本的输入项（多重签名、哈希时间锁合约等）须对照被花费输出的锁定脚本执行，由qbvalidate.VerifyInputScript校验。
+// 准备金交易与手续费交易没有签名，不在此处校验
+// 参数：带有签名的交易
+// 返回值：每个未通过校验的输入项对应一个*TXInputError，全部通过时返回nil
+func (tx *Transaction) VerifyUSSTransactionSign() []error {
+	if tx.IsReserveTX() || tx.IsFeeTX() {
+		return nil
+	}
+	var errs []error
+	for in_id, vin := range tx.TX_vin {
+		if len(vin.Unlock_script) > 0 {
+			continue
+		}
+		if err := tx.verifyInputSign(in_id, vin); err != nil {
+			errs = append(errs, &TXInputError{TX_id: tx.TX_id, In_id: in_id, Err: err})
 		}
 	}
-	return true
+	return errs
+}
+
+// verifyInputSign，校验单个输入项的签名
+// 参数：交易，输入项编号int，输入项TXInput
+// 返回值：校验错误error，通过时为nil
+func (tx *Transaction) verifyInputSign(in_id int, vin TXInput) error {
+	if err := tx.verifySign(in_id, vin.TX_uss_sign); err != nil {
+		return err
+	}
+	if utils.GetAddrOwner(vin.TX_src) != vin.TX_uss_sign.Main_row_num.Sign_node_name {
+		return ErrSignerNotOwner
+	}
+	return nil
 }
 
-// TrimmedCopyTX，交易修剪以得到待签名消息
+// verifySign，校验输入项上的一个签名：签名者已登记、签名参数与长度一致、签名消息为该输入项的待签名消息、签名有效
+// 参数：交易，输入项编号int，签名
+// 返回值：校验错误error，通过时为nil
+func (tx *Transaction) verifySign(in_id int, sign uss.USSToeplitzHashSignMsg) error {
+	signer := sign.Main_row_num.Sign_node_name
+	signer_id := utils.GetNodeID(signer)
+	if signer_id == ([16]byte{}) || signer_id != sign.Sign_index.Sign_dev_id {
+		return ErrUnknownSigner
+	}
+	// 签名长度须与签名参数一致，否则验签时会越界
+	if sign.USS_counts != N || sign.Main_row_num.Random_row_counts != N || sign.USS_unit_len != 16 ||
+		len(sign.USS_signature) != int(sign.USS_counts*sign.USS_counts*sign.USS_unit_len) {
+		return ErrSignMalformed
+	}
+	if !bytes.Equal(sign.USS_message, tx.SignMessage(in_id)) {
+		return ErrSignMessageMismatch
+	}
+	if !uss.VerifySign(sign) {
+		return ErrUSSSignInvalid
+	}
+	return nil
+}
+
+// TrimmedCopyTX，交易修剪以得到待签名消息：去掉交易ID与各输入项的签名及解锁脚本，保留锁定时间、发行的资产与输出的相对锁定及锁定脚本
 // 参数：交易
 // 返回值：修剪后的带签名交易消息
 func (tx *Transaction) TrimmedCopyTX() *Transaction {
 	var inputs []TXInput
 	var outputs []TXOutput
 
-	for _, vin := range tx.TX_vin { // 将原交易内的签名和公钥都置空
-		inputs = append(inputs, TXInput{vin.Refer_tx_id, vin.Refer_tx_id_index, uss.USSToeplitzHashSignMsg{}, ""})
+	for _, vin := range tx.TX_vin { // 将原交易内的签名置空
+		inputs = append(inputs, TXInput{
+			Refer_tx_id:       vin.Refer_tx_id,
+			Refer_tx_id_index: vin.Refer_tx_id_index,
+			TX_uss_sign:       uss.USSToeplitzHashSignMsg{},
+			TX_src:            vin.TX_src,
+		})
 	}
 
-	for _, vout := range tx.TX_vout { // 复制原输入项
-		outputs = append(outputs, TXOutput{vout.TX_value, vout.TX_dst})
-	}
+	outputs = append(outputs, tx.TX_vout...) // 复制原输出项
 
-	txCopy := Transaction{tx.TX_id, inputs, outputs} // 复制一份交易
+	txCopy := Transaction{TX_vin: inputs, TX_vout: outputs, Lock_time: tx.Lock_time, Issue_asset: tx.Issue_asset} // 复制一份交易
 	return &txCopy
 }
 
@@ -137,21 +195,28 @@ func (tx *Transaction) TrimmedCopyTX() *Transaction {
 func NewReserveTX(to []string, data string) *Transaction {
 	if data == "" { // 如果输入data为0，则生成一串随机数作data
 		randData := make([]byte, 20)  // 初始化一个长度为20的字节数组
-		_, err := rand.Read(randData) // 取伪随机数
+		_, err := qrng.Read(randData) // 从默认熵源取随机数
 		if err != nil {
 			log.Panic(err)
 		}
 		data = string(randData) // 格式化输出：[]byte转string
 	}
-	// 创建一个输入项：空
-	tx_in := TXInput{[]byte{}, -1, uss.USSToeplitzHashSignMsg{}, data}
 	// 创建输出项
 	tx_out := make([]TXOutput, 0)
 	for _, addr := range to {
 		out := NewTXOutput(RESERVE, addr) // 交易金额=RESERVE，接收方地址=to
 		tx_out = append(tx_out, out)
 	}
-	tx := &Transaction{nil, []TXInput{tx_in}, tx_out}
+	return NewGenesisTX(tx_out, data)
+}
+
+// NewGenesisTX，按给定输出创建准备金交易，输入项为空，留言data参与交易ID计算；相同参数得到相同交易，用于生成确定的创世区块
+// 参数：交易输出[]TXOutput，留言string
+// 返回值：交易*Transaction
+func NewGenesisTX(outputs []TXOutput, data string) *Transaction {
+	// 创建一个输入项：空
+	tx_in := TXInput{Refer_tx_id: []byte{}, Refer_tx_id_index: -1, TX_uss_sign: uss.USSToeplitzHashSignMsg{}, TX_src: data}
+	tx := &Transaction{TX_vin: []TXInput{tx_in}, TX_vout: outputs}
 	tx.TX_id = tx.SetID()
 
 	return tx
@@ -168,6 +233,29 @@ func (tx *Transaction) IsReserveTX() bool {
 	return false
 }
 
+// NewFeeTX，区块提议者收取手续费：只有输出，没有输入，输出金额为区块中其他交易的手续费之和
+// 参数：手续费总额int，提议者钱包地址string，区块高度int64
+// 返回值：交易*Transaction
+func NewFeeTX(fee int, to string, height int64) *Transaction {
+	// 创建一个输入项：空，以区块高度区分不同区块的手续费交易
+	tx_in := TXInput{Refer_tx_id: []byte{}, Refer_tx_id_index: FEE_INDEX, TX_uss_sign: uss.USSToeplitzHashSignMsg{}, TX_src: fmt.Sprintf("fee of block %d", height)}
+	tx := &Transaction{TX_vin: []TXInput{tx_in}, TX_vout: []TXOutput{NewTXOutput(fee, to)}}
+	tx.TX_id = tx.SetID()
+
+	return tx
+}
+
+// IsFeeTX,检查交易是否是手续费交易
+// 参数：待判断交易
+// 返回值：判断结果bool
+func (tx *Transaction) IsFeeTX() bool {
+	// 判断依据：1.输入项只有一条；2.引用的交易输出编号为FEE_INDEX；3.引用的交易ID为空
+	if len(tx.TX_vin) == 1 && len(tx.TX_vin[0].Refer_tx_id) == 0 && tx.TX_vin[0].Refer_tx_id_index == FEE_INDEX {
+		return true
+	}
+	return false
+}
+
 // PrintTransaction，打印交易
 // 参数：待打印交易
 // 返回值：无，屏幕输出交易信息
@@ -183,7 +271,22 @@ func (tx *Transaction) PrintTransaction() {
 	for _, vout := range tx.TX_vout {
 		//fmt.Printf("\tVout:%d\n", j+1)
 		fmt.Printf("\tValue:%d\n", vout.TX_value)
+		if vout.Asset != "" {
+			fmt.Printf("\tAsset:%s\n", vout.Asset)
+		}
 		fmt.Printf("\tTo:%s\n", vout.TX_dst)
+		if vout.Lock_blocks > 0 {
+			fmt.Printf("\tLockBlocks:%d\n", vout.Lock_blocks)
+		}
+		if len(vout.Lock_script) > 0 {
+			fmt.Printf("\tLockScript:%s\n", vout.Lock_script)
+		}
+	}
+	if tx.Lock_time > 0 {
+		fmt.Printf("\tLockTime:%d\n", tx.Lock_time)
+	}
+	if tx.IsIssueTX() {
+		fmt.Printf("\tIssue:%s\n", tx.Issue_asset)
 	}
 	fmt.Printf("\n")
 }
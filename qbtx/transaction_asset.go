@@ -0,0 +1,44 @@
+package qbtx
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 资产编号的最大长度
+const MAX_ASSET_ID = 16
+
+// 资产相关的错误
+var ErrAssetID = errors.New("asset id must be 1 to 16 upper-case letters or digits") // 资产编号不合法
+
+// ValidateAssetID，检查资产编号由1至MAX_ASSET_ID个大写字母或数字组成；原生币的编号为空，不在此处检查
+// 参数：资产编号string
+// 返回值：编号不合法时返回ErrAssetID
+func ValidateAssetID(asset string) error {
+	if len(asset) == 0 || len(asset) > MAX_ASSET_ID {
+		return fmt.Errorf("%w: %q", ErrAssetID, asset)
+	}
+	for _, c := range asset {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return fmt.Errorf("%w: %q", ErrAssetID, asset)
+		}
+	}
+	return nil
+}
+
+// IsIssueTX，检查交易是否是资产发行交易
+// 参数：待判断交易
+// 返回值：判断结果bool
+func (tx *Transaction) IsIssueTX() bool {
+	return tx.Issue_asset != ""
+}
+
+// AssetName，资产的显示名称，原生币显示为native
+// 参数：资产编号string
+// 返回值：显示名称string
+func AssetName(asset string) string {
+	if asset == "" {
+		return "native"
+	}
+	return asset
+}
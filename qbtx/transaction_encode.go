@@ -0,0 +1,184 @@
+package qbtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"log"
+	"qkdserv"
+	"uss"
+)
+
+// 交易规范编码的版本，编码规则改变时递增
+const TX_ENCODING_VERSION = 1
+
+// 规范编码中可选字段的标签，字段为空时不编码，以0结束。新增字段只能追加新标签，不改变已有交易的编码
+const (
+	tagEnd = 0
+
+	// 交易
+	tagLockTime   = 1
+	tagIssueAsset = 2
+
+	// 输入项
+	tagUSSSign      = 1
+	tagUnlockScript = 2
+
+	// 输出项
+	tagAsset      = 1
+	tagLockBlocks = 2
+	tagLockScript = 3
+)
+
+// EncodeTX，交易的完整规范编码，用于计算待签名消息与默克尔树叶子，区块因此同时承诺各输入项的解锁脚本。
+// 以版本号开头，依次为输入项、输出项与可选字段；变长字段带长度前缀，可选字段为空时不编码，因此结构体新增字段不改变已有交易的编码。
+// 编码不含交易ID，只用于计算摘要，存储与传输仍使用SerializeTX
+// 参数：交易
+// 返回值：规范编码[]byte
+func (tx *Transaction) EncodeTX() []byte {
+	return tx.encodeTX(true)
+}
+
+// encodeID，计算交易ID的规范编码，不含各输入项的解锁脚本：解锁脚本可在不改变花费条件的情况下被改写（如重排多重签名），
+// 交易ID若随之改变，引用该交易输出的后续交易将失效
+// 参数：交易
+// 返回值：规范编码[]byte
+func (tx *Transaction) encodeID() []byte {
+	return tx.encodeTX(false)
+}
+
+// encodeTX，按规范编码写入交易，unlock为false时省略各输入项的解锁脚本
+func (tx *Transaction) encodeTX(unlock bool) []byte {
+	var enc txEncoder
+	enc.WriteByte(TX_ENCODING_VERSION)
+	enc.putUvarint(uint64(len(tx.TX_vin)))
+	for _, vin := range tx.TX_vin {
+		if !unlock {
+			vin.Unlock_script = nil
+		}
+		enc.putInput(vin)
+	}
+	enc.putUvarint(uint64(len(tx.TX_vout)))
+	for _, vout := range tx.TX_vout {
+		enc.putOutput(vout)
+	}
+	if tx.Lock_time != 0 {
+		enc.WriteByte(tagLockTime)
+		enc.putVarint(tx.Lock_time)
+	}
+	if tx.Issue_asset != "" {
+		enc.WriteByte(tagIssueAsset)
+		enc.putBytes([]byte(tx.Issue_asset))
+	}
+	enc.WriteByte(tagEnd)
+	return enc.Bytes()
+}
+
+// txEncoder，规范编码的写入器
+type txEncoder struct {
+	bytes.Buffer
+}
+
+func (enc *txEncoder) putUvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	enc.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (enc *txEncoder) putVarint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	enc.Write(buf[:binary.PutVarint(buf[:], v)])
+}
+
+// putBytes，写入带长度前缀的变长字段
+func (enc *txEncoder) putBytes(data []byte) {
+	enc.putUvarint(uint64(len(data)))
+	enc.Write(data)
+}
+
+func (enc *txEncoder) putInput(vin TXInput) {
+	enc.putBytes(vin.Refer_tx_id)
+	enc.putVarint(int64(vin.Refer_tx_id_index))
+	enc.putBytes([]byte(vin.TX_src))
+	if !isEmptySign(vin.TX_uss_sign) {
+		enc.WriteByte(tagUSSSign)
+		enc.putSign(vin.TX_uss_sign)
+	}
+	if len(vin.Unlock_script) > 0 {
+		enc.WriteByte(tagUnlockScript)
+		enc.putBytes(vin.Unlock_script)
+	}
+	enc.WriteByte(tagEnd)
+}
+
+func (enc *txEncoder) putOutput(vout TXOutput) {
+	enc.putVarint(int64(vout.TX_value))
+	enc.putBytes([]byte(vout.TX_dst))
+	if vout.Asset != "" {
+		enc.WriteByte(tagAsset)
+		enc.putBytes([]byte(vout.Asset))
+	}
+	if vout.Lock_blocks != 0 {
+		enc.WriteByte(tagLockBlocks)
+		enc.putVarint(vout.Lock_blocks)
+	}
+	if len(vout.Lock_script) > 0 {
+		enc.WriteByte(tagLockScript)
+		enc.putBytes(vout.Lock_script)
+	}
+	enc.WriteByte(tagEnd)
+}
+
+func (enc *txEncoder) putSign(sign uss.USSToeplitzHashSignMsg) {
+	enc.Write(sign.Sign_index.Sign_dev_id[:])
+	enc.Write(sign.Sign_index.Sign_task_sn[:])
+	enc.putBytes([]byte(sign.Main_row_num.Sign_node_name))
+	enc.putUvarint(uint64(sign.Main_row_num.Main_row_num))
+	enc.putUvarint(uint64(sign.Main_row_num.Random_row_counts))
+	enc.putUvarint(uint64(sign.Main_row_num.Random_unit_len))
+	enc.putUvarint(uint64(sign.USS_counts))
+	enc.putUvarint(uint64(sign.USS_unit_len))
+	enc.putBytes(sign.USS_message)
+	enc.putBytes(sign.USS_signature)
+}
+
+// isEmptySign，判断签名是否为空，准备金交易、手续费交易与修剪后的交易的输入项不带签名
+func isEmptySign(sign uss.USSToeplitzHashSignMsg) bool {
+	return sign.Sign_index == (qkdserv.QKDSignMatrixIndex{}) && sign.Main_row_num == (qkdserv.QKDSignRandomMainRowNum{}) &&
+		sign.USS_counts == 0 && sign.USS_unit_len == 0 && len(sign.USS_message) == 0 && len(sign.USS_signature) == 0
+}
+
+// SerializeTXV1，按最初的交易结构序列化交易，用作旧版区块的默克尔树叶子。
+// gob编码记录结构与切片的类型名（如[]qbtx.TXInput）及全部字段，交易结构新增字段后SerializeTX的结果随之改变，
+// 因此在此冻结最初的结构：包名、类型名与字段须与最初一致，为不与现有同名类型冲突，在函数内声明
+// 参数：交易
+// 返回值：按最初结构的序列化结果
+func (tx *Transaction) SerializeTXV1() []byte {
+	type TXInput struct {
+		Refer_tx_id       []byte
+		Refer_tx_id_index int
+		TX_uss_sign       uss.USSToeplitzHashSignMsg
+		TX_src            string
+	}
+	type TXOutput struct {
+		TX_value int
+		TX_dst   string
+	}
+	type Transaction struct {
+		TX_id   []byte
+		TX_vin  []TXInput
+		TX_vout []TXOutput
+	}
+
+	v1 := Transaction{TX_id: tx.TX_id}
+	for _, vin := range tx.TX_vin {
+		v1.TX_vin = append(v1.TX_vin, TXInput{vin.Refer_tx_id, vin.Refer_tx_id_index, vin.TX_uss_sign, vin.TX_src})
+	}
+	for _, vout := range tx.TX_vout {
+		v1.TX_vout = append(v1.TX_vout, TXOutput{vout.TX_value, vout.TX_dst})
+	}
+	var encoded bytes.Buffer
+	if err := gob.NewEncoder(&encoded).Encode(&v1); err != nil {
+		log.Panic(err)
+	}
+	return encoded.Bytes()
+}
@@ -0,0 +1,33 @@
+package qbtx
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// 交易输入项校验失败的原因
+var (
+	ErrUnknownSigner       = errors.New("signer is not registered")                      // 签名者未登记或签名信息缺失
+	ErrSignMalformed       = errors.New("signature is malformed")                        // 签名参数与签名长度不符
+	ErrSignMessageMismatch = errors.New("signed message does not match the transaction") // 签名消息与修剪交易不符
+	ErrSignerNotOwner      = errors.New("signer does not own the spent address")         // 签名者不是被花费地址的所有者
+	ErrUSSSignInvalid      = errors.New("uss signature is invalid")                      // 无条件安全签名验签失败
+)
+
+// TXInputError，交易输入项校验错误，指明出错的交易、输入项及原因
+type TXInputError struct {
+	TX_id []byte // 交易ID
+	In_id int    // 输入项编号
+	Err   error  // 错误原因
+}
+
+// Error，错误信息
+func (e *TXInputError) Error() string {
+	return fmt.Sprintf("tx %s input %d: %v", hex.EncodeToString(e.TX_id), e.In_id, e.Err)
+}
+
+// Unwrap，获取错误原因，便于errors.Is判断
+func (e *TXInputError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,37 @@
+package qbtx
+
+import (
+	"crypto/sha256"
+	"errors"
+)
+
+// 哈希时间锁合约的条件不合法
+var ErrHTLCMalformed = errors.New("htlc needs a sha-256 hash lock, both parties and a timeout height") // 合约条件不合法
+
+// HTLC，哈希时间锁合约：接收方在超时高度之前出示哈希锁的SHA-256原像即可领取，超时后发送方可取回。
+// 输出以HTLCScript生成的锁定脚本记录合约，领取与退款的解锁脚本见UnlockHTLCClaim、UnlockHTLCRefund
+type HTLC struct {
+	Hash_lock []byte `json:"HashLock"` // 原像的SHA-256摘要
+	Receiver  string `json:"Receiver"` // 接收方钱包地址，出示原像领取
+	Sender    string `json:"Sender"`   // 发送方钱包地址，超时后退款
+	Timeout   int64  `json:"Timeout"`  // 超时高度，接收方须在该高度之前领取，发送方自该高度起可退款
+}
+
+// NewHTLC，创建哈希时间锁合约
+// 参数：哈希锁[]byte，接收方地址string，发送方地址string，超时高度int64
+// 返回值：*HTLC，条件不合法时返回ErrHTLCMalformed
+func NewHTLC(hash_lock []byte, receiver, sender string, timeout int64) (*HTLC, error) {
+	h := &HTLC{Hash_lock: hash_lock, Receiver: receiver, Sender: sender, Timeout: timeout}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Validate，检查哈希锁为SHA-256摘要、双方地址非空、超时为区块高度
+func (h *HTLC) Validate() error {
+	if len(h.Hash_lock) != sha256.Size || h.Receiver == "" || h.Sender == "" || h.Timeout <= 0 || h.Timeout >= LOCK_TIME_THRESHOLD {
+		return ErrHTLCMalformed
+	}
+	return nil
+}
@@ -13,6 +13,8 @@ type TXInput struct {
 	Refer_tx_id_index int                        `json:"ReferTXidIndex"` // 引用的交易输出编号，引用的交易中具体的某一个output
 	TX_uss_sign       uss.USSToeplitzHashSignMsg `json:"TxUssSign"`      // 签名，花钱的人要证明这些钱是属于它的，会在交易确认的时候，校验这个签名
 	TX_src            string                     `json:"TXsrc"`          // 交易来源
+
+	Unlock_script Script `json:"UnlockScript,omitempty"` // 花费带锁定脚本的输出时给出的解锁脚本，此时TX_uss_sign不使用
 }
 
 // SerializeInput，交易输入项序列化
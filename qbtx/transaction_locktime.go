@@ -0,0 +1,24 @@
+package qbtx
+
+// 锁定时间的分界：小于该值的Lock_time表示区块高度，不小于该值的表示Unix时间（秒）
+const LOCK_TIME_THRESHOLD = 500000000
+
+// IsFinal，判断交易能否打包进给定高度的区块：未设置锁定时间，或区块高度（父区块时间）不小于锁定的高度（时间）
+// 参数：区块高度int64，父区块时间戳int64
+// 返回值：bool
+func (tx *Transaction) IsFinal(height, time int64) bool {
+	if tx.Lock_time <= 0 {
+		return true
+	}
+	if tx.Lock_time < LOCK_TIME_THRESHOLD {
+		return height >= tx.Lock_time
+	}
+	return time >= tx.Lock_time
+}
+
+// SpendableAt，判断输出能否被给定高度区块中的交易花费：区块高度不小于输出上链高度加相对锁定的区块数
+// 参数：输出所在区块高度int64，花费它的区块高度int64
+// 返回值：bool
+func (out TXOutput) SpendableAt(confirmed, height int64) bool {
+	return out.Lock_blocks <= 0 || height >= confirmed+out.Lock_blocks
+}
@@ -0,0 +1,103 @@
+package qbtx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"utils"
+)
+
+// 多重签名最多列出的地址数
+const MAX_MULTISIG_ADDRS = 16
+
+// 多重签名相关的错误
+var (
+	ErrMultiSigMalformed = errors.New("multisig must require 1 to n signatures of n distinct addresses") // 门限或地址列表不合法
+	ErrMultiSigDuplicate = errors.New("co-signer has signed the input twice")                            // 同一签名者重复签名
+	ErrNotMultiSigInput  = errors.New("input does not carry a multisig unlocking script")                // 输入项不是多重签名输入
+)
+
+// MultiSig，m-of-n多重签名条件：Addrs中至少M个地址的所有者签名后才能花费。
+// 输出以MultiSigScript生成的锁定脚本记录条件，花费时在输入项的解锁脚本中给出签名
+type MultiSig struct {
+	M     int      `json:"M"`     // 签名门限
+	Addrs []string `json:"Addrs"` // 共同持有的钱包地址，按字典序排列
+}
+
+// NewMultiSig，创建多重签名条件，地址按字典序排列，相同的门限与地址集合得到相同的条件
+// 参数：签名门限int，钱包地址[]string
+// 返回值：*MultiSig，门限或地址不合法时返回ErrMultiSigMalformed
+func NewMultiSig(m int, addrs []string) (*MultiSig, error) {
+	sorted := append([]string(nil), addrs...)
+	sort.Strings(sorted)
+	ms := &MultiSig{M: m, Addrs: sorted}
+	if err := ms.Validate(); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// Validate，检查门限在1与地址数之间、地址非空、按字典序排列且互不相同
+func (ms *MultiSig) Validate() error {
+	if ms.M < 1 || ms.M > len(ms.Addrs) || len(ms.Addrs) > MAX_MULTISIG_ADDRS {
+		return fmt.Errorf("%w: %d of %d", ErrMultiSigMalformed, ms.M, len(ms.Addrs))
+	}
+	for i, addr := range ms.Addrs {
+		if addr == "" || (i > 0 && ms.Addrs[i-1] >= addr) {
+			return fmt.Errorf("%w: addresses are empty, unsorted or repeated", ErrMultiSigMalformed)
+		}
+	}
+	return nil
+}
+
+// CoSign，共同签名者对多重签名输入项签名，签名按签名者地址的顺序插入输入项的多重签名解锁脚本（见UnlockMultiSig）。
+// 签名覆盖修剪后的交易，不含解锁脚本，各签名者依次签名互不影响；交易ID不含解锁脚本，签名不改变交易ID，收集到足够签名后即可提交。
+// 签名者是否为多重签名地址之一的所有者、签名数是否达到门限，由锁定脚本在校验时判断
+// 参数：交易，输入项编号int，签名者节点名称string
+// 返回值：error
+func (tx *Transaction) CoSign(in_id int, node_name string) error {
+	if in_id < 0 || in_id >= len(tx.TX_vin) {
+		return ErrNotMultiSigInput
+	}
+	vin := &tx.TX_vin[in_id]
+	sigs, err := multiSigSigns(vin.Unlock_script)
+	if err != nil {
+		return err
+	}
+	for _, sig := range sigs {
+		if sign, err := decodeScriptSign(sig); err == nil && sign.Main_row_num.Sign_node_name == node_name {
+			return fmt.Errorf("%w: %s", ErrMultiSigDuplicate, node_name)
+		}
+	}
+	sigs = append(sigs, tx.ScriptSign(in_id, node_name))
+	sort.SliceStable(sigs, func(i, j int) bool { return signerAddr(sigs[i]) < signerAddr(sigs[j]) })
+	vin.Unlock_script = UnlockMultiSig(sigs)
+	return nil
+}
+
+// signerAddr，签名者登记的钱包地址，多重签名的签名按该地址排序，与锁定脚本中地址的顺序一致
+func signerAddr(sig []byte) string {
+	sign, err := decodeScriptSign(sig)
+	if err != nil {
+		return ""
+	}
+	return utils.GetNodeAddr(sign.Main_row_num.Sign_node_name)
+}
+
+// multiSigSigns，解析多重签名解锁脚本<签名1>...<签名k> <k>中的签名
+func multiSigSigns(unlock Script) ([][]byte, error) {
+	ops, err := unlock.parse()
+	if err != nil || len(ops) == 0 || !unlock.IsPushOnly() {
+		return nil, ErrNotMultiSigInput
+	}
+	count := ops[len(ops)-1].data
+	if len(count) != 8 || binary.BigEndian.Uint64(count) != uint64(len(ops)-1) {
+		return nil, ErrNotMultiSigInput
+	}
+	var sigs [][]byte
+	for _, op := range ops[:len(ops)-1] {
+		sigs = append(sigs, op.data)
+	}
+	return sigs, nil
+}
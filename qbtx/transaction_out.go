@@ -9,23 +9,65 @@ import (
 
 // TXOutput，交易输出结构
 type TXOutput struct {
-	TX_value int    `json:"TXValue"` // 输出金额
-	TX_dst   string `json:"TXdst"`   // 接收方
+	TX_value int    `json:"TXValue"`         // 输出金额
+	TX_dst   string `json:"TXdst"`           // 接收方
+	Asset    string `json:"Asset,omitempty"` // 资产编号，为空时为原生币
+
+	Lock_blocks int64  `json:"LockBlocks,omitempty"` // 相对锁定，输出上链后须再经过的区块数才能花费，0表示不锁定，见SpendableAt
+	Lock_script Script `json:"LockScript,omitempty"` // 锁定脚本，输出只能由满足脚本的输入花费，此时接收方为脚本导出的地址；为空时由接收方签名花费
 }
 
-// TXOutputs
+// TXOutputs，一笔交易中尚未花费的输出项
 type TXOutputs struct {
 	Outputs []TXOutput
+	Index   []int // 各输出项在原交易输出中的编号，与Outputs一一对应；为空时按Outputs中的位置计
+	Height  int64 // 交易所在区块的高度，用于校验相对锁定
+}
+
+// GetOutput，根据原交易中的输出编号查找未花费的输出项
+// 参数：输出编号int
+// 返回值：输出项TXOutput，是否存在bool
+func (tx_outputs TXOutputs) GetOutput(index int) (TXOutput, bool) {
+	if tx_outputs.Index == nil { // 旧数据未记录编号，按位置查找
+		if index >= 0 && index < len(tx_outputs.Outputs) {
+			return tx_outputs.Outputs[index], true
+		}
+		return TXOutput{}, false
+	}
+	for i, out_idx := range tx_outputs.Index {
+		if out_idx == index {
+			return tx_outputs.Outputs[i], true
+		}
+	}
+	return TXOutput{}, false
+}
+
+// OutputIndex，获取Outputs中第i项在原交易输出中的编号
+// 参数：Outputs中的位置int
+// 返回值：原交易输出编号int
+func (tx_outputs TXOutputs) OutputIndex(i int) int {
+	if tx_outputs.Index == nil {
+		return i
+	}
+	return tx_outputs.Index[i]
 }
 
 // NewTXOutput，初始化交易输出项
 // 参数：交易数值int，接收方地址string
 // 返回值：交易输出项
 func NewTXOutput(tx_value int, tx_dst string) TXOutput {
-	txo := TXOutput{tx_value, tx_dst}
+	txo := TXOutput{TX_value: tx_value, TX_dst: tx_dst}
 	return txo
 }
 
+// Equal，判断两个输出项是否相同
+// 参数：另一个输出项TXOutput
+// 返回值：是否相同bool
+func (out TXOutput) Equal(other TXOutput) bool {
+	return out.TX_value == other.TX_value && out.TX_dst == other.TX_dst && out.Asset == other.Asset &&
+		out.Lock_blocks == other.Lock_blocks && bytes.Equal(out.Lock_script, other.Lock_script)
+}
+
 // SerializeOutput，交易输出项序列化
 // 参数：待序列化的交易输出项
 // 返回值：序列化结果
@@ -44,14 +86,19 @@ func (tx_outputs TXOutputs) SerializeOutputs() []byte {
 // 参数：序列化结果
 // 返回值：反序列化的交易输出项数组
 func DeserializeOutputs(data []byte) TXOutputs {
-	var tx_outputs TXOutputs
-
-	dec := gob.NewDecoder(bytes.NewReader(data))
-	err := dec.Decode(&tx_outputs)
-
+	tx_outputs, err := DecodeOutputs(data)
 	if err != nil {
 		fmt.Println("outputs=", tx_outputs)
 		log.Panic(err)
 	}
 	return tx_outputs
 }
+
+// DecodeOutputs，交易输出项反序列化，数据损坏时返回错误而不中止进程
+// 参数：序列化结果
+// 返回值：交易输出项数组，解码错误error
+func DecodeOutputs(data []byte) (TXOutputs, error) {
+	var tx_outputs TXOutputs
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&tx_outputs)
+	return tx_outputs, err
+}
@@ -0,0 +1,206 @@
+package qbtx
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"utils"
+)
+
+// 锁定脚本的资源限制，保证任意脚本的执行时间与内存有界
+const (
+	MAX_SCRIPT_SIZE    = 1 << 16 // 单个脚本的最大字节数
+	MAX_SCRIPT_ELEMENT = 1 << 14 // 单个数据项的最大字节数，须能容纳编码后的无条件安全签名
+	MAX_SCRIPT_OPS     = 256     // 解锁与锁定脚本合计执行的最大操作码数（不含数据压栈）
+	MAX_SCRIPT_STACK   = 256     // 栈的最大深度
+	MAX_SCRIPT_SIGS    = 32      // 解锁与锁定脚本合计校验的最大签名数
+)
+
+// 操作码
+const (
+	OP_FALSE    = byte(0x00) // 压入空数据，视为假
+	OP_PUSHDATA = byte(0x01) // 压入数据：其后2字节大端长度与数据
+	OP_TRUE     = byte(0x02) // 压入整数1，视为真
+
+	OP_IF     = byte(0x10) // 弹出栈顶，为真时执行至OP_ELSE或OP_ENDIF
+	OP_ELSE   = byte(0x11) // 翻转当前条件分支
+	OP_ENDIF  = byte(0x12) // 结束条件分支
+	OP_VERIFY = byte(0x13) // 弹出栈顶，为假时脚本失败
+
+	OP_DUP  = byte(0x20) // 复制栈顶
+	OP_DROP = byte(0x21) // 丢弃栈顶
+	OP_SWAP = byte(0x22) // 交换栈顶两项
+
+	OP_EQUAL       = byte(0x30) // 弹出两项，相等时压入真
+	OP_EQUALVERIFY = byte(0x31) // OP_EQUAL后OP_VERIFY
+	OP_LESSTHAN    = byte(0x32) // 弹出整数b、a，a<b时压入真
+	OP_NOT         = byte(0x33) // 弹出一项，压入其逻辑非
+
+	OP_SHA256 = byte(0x40) // 弹出一项，压入其SHA-256摘要
+
+	OP_CHECKSIG       = byte(0x50) // 弹出地址与签名，签名对本输入项有效且签名者为地址所有者时压入真
+	OP_CHECKSIGVERIFY = byte(0x51) // OP_CHECKSIG后OP_VERIFY
+	OP_CHECKMULTISIG  = byte(0x52) // 弹出n、n个地址、m、k、k个签名，不同地址所有者的有效签名不少于m时压入真
+
+	OP_HEIGHT              = byte(0x60) // 压入交易所在区块的高度
+	OP_TIME                = byte(0x61) // 压入交易所在区块的时间戳
+	OP_CHECKLOCKTIMEVERIFY = byte(0x62) // 弹出锁定时间，交易的锁定时间与之同为高度或时间且不早于它，否则脚本失败
+)
+
+// 操作码名称，用于反汇编
+var opNames = map[byte]string{
+	OP_FALSE: "OP_FALSE", OP_PUSHDATA: "OP_PUSHDATA", OP_TRUE: "OP_TRUE",
+	OP_IF: "OP_IF", OP_ELSE: "OP_ELSE", OP_ENDIF: "OP_ENDIF", OP_VERIFY: "OP_VERIFY",
+	OP_DUP: "OP_DUP", OP_DROP: "OP_DROP", OP_SWAP: "OP_SWAP",
+	OP_EQUAL: "OP_EQUAL", OP_EQUALVERIFY: "OP_EQUALVERIFY", OP_LESSTHAN: "OP_LESSTHAN", OP_NOT: "OP_NOT",
+	OP_SHA256:   "OP_SHA256",
+	OP_CHECKSIG: "OP_CHECKSIG", OP_CHECKSIGVERIFY: "OP_CHECKSIGVERIFY", OP_CHECKMULTISIG: "OP_CHECKMULTISIG",
+	OP_HEIGHT: "OP_HEIGHT", OP_TIME: "OP_TIME", OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+}
+
+// 锁定脚本相关的错误
+var (
+	ErrScriptMalformed   = errors.New("script is malformed")                                                // 脚本无法解析或含未知操作码
+	ErrScriptTooLarge    = errors.New("script or data element exceeds the size limit")                      // 脚本或数据项超过长度限制
+	ErrScriptOpLimit     = errors.New("script exceeds the operation limit")                                 // 操作码数超过限制
+	ErrScriptStackLimit  = errors.New("script exceeds the stack limit")                                     // 栈深度超过限制
+	ErrScriptSigLimit    = errors.New("script exceeds the signature check limit")                           // 签名校验数超过限制
+	ErrScriptStack       = errors.New("script pops from an empty stack")                                    // 栈中数据不足
+	ErrScriptUnbalanced  = errors.New("script has unbalanced conditionals")                                 // OP_IF/OP_ELSE/OP_ENDIF不配对
+	ErrScriptNumber      = errors.New("script number must be 8 bytes")                                      // 整数须为8字节大端编码
+	ErrScriptVerify      = errors.New("script verify failed")                                               // OP_VERIFY类操作码失败
+	ErrScriptLockTime    = errors.New("transaction lock time does not satisfy the script")                  // 交易的锁定时间不满足脚本
+	ErrScriptNotPushOnly = errors.New("unlocking script may only push data")                                // 解锁脚本只能压入数据
+	ErrScriptFailed      = errors.New("script did not leave true on the stack")                             // 执行结束时栈顶不为真
+	ErrScriptUnclean     = errors.New("script left more than one item on the stack")                        // 执行结束时栈中多于一项
+	ErrScriptMissing     = errors.New("output has a locking script but the input has no unlocking script")  // 带锁定脚本的输出须以解锁脚本花费
+	ErrScriptUnexpected  = errors.New("input has an unlocking script but the output has no locking script") // 普通输出不接受解锁脚本
+)
+
+// Script，锁定脚本或解锁脚本：基于栈的谓词语言的字节码。输出以锁定脚本规定花费条件，输入以解锁脚本提供签名、原像等数据；
+// 先执行解锁脚本，再在同一个栈上执行锁定脚本，结束时栈顶为真即可花费。脚本不含循环，执行步数受脚本长度与MAX_SCRIPT_OPS限制
+type Script []byte
+
+// scriptOp，解析后的一条指令
+type scriptOp struct {
+	code byte   // 操作码
+	data []byte // OP_PUSHDATA压入的数据
+}
+
+// AddOp，在脚本末尾追加操作码
+// 参数：操作码byte
+// 返回值：追加后的脚本Script
+func (s Script) AddOp(op byte) Script {
+	return append(s, op)
+}
+
+// AddData，在脚本末尾追加压入数据的指令
+// 参数：数据[]byte，长度不超过MAX_SCRIPT_ELEMENT
+// 返回值：追加后的脚本Script
+func (s Script) AddData(data []byte) Script {
+	s = append(s, OP_PUSHDATA, byte(len(data)>>8), byte(len(data)))
+	return append(s, data...)
+}
+
+// AddInt，在脚本末尾追加压入整数的指令，整数以8字节大端编码
+// 参数：整数int64
+// 返回值：追加后的脚本Script
+func (s Script) AddInt(num int64) Script {
+	return s.AddData(utils.IntToHex(num))
+}
+
+// parse，将脚本解析为指令序列，检查长度限制与操作码
+func (s Script) parse() ([]scriptOp, error) {
+	if len(s) > MAX_SCRIPT_SIZE {
+		return nil, ErrScriptTooLarge
+	}
+	var ops []scriptOp
+	for i := 0; i < len(s); {
+		code := s[i]
+		i++
+		if _, ok := opNames[code]; !ok {
+			return nil, fmt.Errorf("%w: unknown opcode 0x%02x", ErrScriptMalformed, code)
+		}
+		op := scriptOp{code: code}
+		if code == OP_PUSHDATA {
+			if i+2 > len(s) {
+				return nil, fmt.Errorf("%w: truncated push", ErrScriptMalformed)
+			}
+			size := int(binary.BigEndian.Uint16(s[i:]))
+			i += 2
+			if size > MAX_SCRIPT_ELEMENT {
+				return nil, ErrScriptTooLarge
+			}
+			if i+size > len(s) {
+				return nil, fmt.Errorf("%w: truncated push", ErrScriptMalformed)
+			}
+			op.data = s[i : i+size]
+			i += size
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// Validate，检查脚本可以解析且不超过长度限制，输出的锁定脚本在上链前以此检查
+func (s Script) Validate() error {
+	_, err := s.parse()
+	return err
+}
+
+// IsPushOnly，判断脚本是否只压入数据，解锁脚本须满足
+func (s Script) IsPushOnly() bool {
+	ops, err := s.parse()
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if op.code != OP_FALSE && op.code != OP_PUSHDATA && op.code != OP_TRUE {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash，脚本的摘要，用于导出脚本地址；以"script"开头，与其他摘要区分
+func (s Script) Hash() []byte {
+	hash := sha256.New()
+	hash.Write([]byte("script"))
+	hash.Write(s)
+	return hash.Sum(nil)
+}
+
+// String，反汇编脚本：操作码以名称表示，数据以十六进制表示，可打印字符组成的地址原样输出
+func (s Script) String() string {
+	ops, err := s.parse()
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	words := make([]string, 0, len(ops))
+	for _, op := range ops {
+		if op.code != OP_PUSHDATA {
+			words = append(words, opNames[op.code])
+		} else if isPrintable(op.data) {
+			words = append(words, string(op.data))
+		} else {
+			words = append(words, hex.EncodeToString(op.data))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// isPrintable，判断数据是否为可打印的字母数字，用于反汇编时识别钱包地址
+func isPrintable(data []byte) bool {
+	if len(data) == 0 || len(data) > 64 {
+		return false
+	}
+	for _, c := range data {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
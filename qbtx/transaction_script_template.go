@@ -0,0 +1,106 @@
+package qbtx
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+	"qkdserv"
+	"uss"
+	"utils"
+)
+
+// 标准脚本模板：常用花费条件的锁定脚本与对应的解锁脚本
+
+// PayToAddressScript，支付到地址：地址所有者签名即可花费
+// 锁定脚本：<地址> OP_CHECKSIG，解锁脚本：<签名>
+// 参数：钱包地址string
+// 返回值：锁定脚本Script
+func PayToAddressScript(addr string) Script {
+	return Script{}.AddData([]byte(addr)).AddOp(OP_CHECKSIG)
+}
+
+// MultiSigScript，m-of-n多重签名：地址按字典序排列，至少m个地址的所有者签名才能花费
+// 锁定脚本：<m> <地址1>...<地址n> <n> OP_CHECKMULTISIG，解锁脚本见UnlockMultiSig
+// 参数：签名门限int，钱包地址[]string
+// 返回值：锁定脚本Script，门限或地址不合法时返回ErrMultiSigMalformed
+func MultiSigScript(m int, addrs []string) (Script, error) {
+	ms, err := NewMultiSig(m, addrs)
+	if err != nil {
+		return nil, err
+	}
+	script := Script{}.AddInt(int64(ms.M))
+	for _, addr := range ms.Addrs {
+		script = script.AddData([]byte(addr))
+	}
+	return script.AddInt(int64(len(ms.Addrs))).AddOp(OP_CHECKMULTISIG), nil
+}
+
+// HTLCScript，哈希时间锁合约：接收方在超时高度之前出示原像并签名领取，发送方在超时高度起签名退款
+// 锁定脚本：OP_IF OP_SHA256 <哈希锁> OP_EQUALVERIFY OP_HEIGHT <超时> OP_LESSTHAN OP_VERIFY <接收方> OP_CHECKSIG
+// OP_ELSE <超时> OP_CHECKLOCKTIMEVERIFY <发送方> OP_CHECKSIG OP_ENDIF，解锁脚本见UnlockHTLCClaim、UnlockHTLCRefund
+// 参数：合约*HTLC
+// 返回值：锁定脚本Script，合约不合法时返回ErrHTLCMalformed
+func HTLCScript(h *HTLC) (Script, error) {
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	script := Script{}.AddOp(OP_IF).
+		AddOp(OP_SHA256).AddData(h.Hash_lock).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_HEIGHT).AddInt(h.Timeout).AddOp(OP_LESSTHAN).AddOp(OP_VERIFY).
+		AddData([]byte(h.Receiver)).AddOp(OP_CHECKSIG).
+		AddOp(OP_ELSE).
+		AddInt(h.Timeout).AddOp(OP_CHECKLOCKTIMEVERIFY).
+		AddData([]byte(h.Sender)).AddOp(OP_CHECKSIG).
+		AddOp(OP_ENDIF)
+	return script, nil
+}
+
+// TimeLockScript，时间锁：交易的锁定时间不早于给定高度或时间后，地址所有者签名即可花费
+// 锁定脚本：<锁定时间> OP_CHECKLOCKTIMEVERIFY <地址> OP_CHECKSIG，解锁脚本：<签名>
+// 参数：锁定的高度或时间戳int64，钱包地址string
+// 返回值：锁定脚本Script
+func TimeLockScript(lock_time int64, addr string) Script {
+	return Script{}.AddInt(lock_time).AddOp(OP_CHECKLOCKTIMEVERIFY).AddData([]byte(addr)).AddOp(OP_CHECKSIG)
+}
+
+// ScriptSign，对输入项签名，得到可放入解锁脚本的签名数据。签名覆盖修剪后的交易，不含各输入项的解锁脚本，
+// 因此多个签名者可以各自签名后再组装解锁脚本
+// 参数：交易，输入项编号int，签名者节点名称string
+// 返回值：编码后的签名[]byte
+func (tx *Transaction) ScriptSign(in_id int, node_name string) []byte {
+	sign_index := qkdserv.QKDSignMatrixIndex{
+		Sign_dev_id:  utils.GetNodeID(node_name),
+		Sign_task_sn: uss.GenSignTaskSN(16),
+	}
+	signature := uss.UnconditionallySecureSign(sign_index, N, 16, tx.SignMessage(in_id))
+
+	var buff bytes.Buffer
+	if err := gob.NewEncoder(&buff).Encode(signature); err != nil {
+		log.Panic(err)
+	}
+	return buff.Bytes()
+}
+
+// UnlockSign，支付到地址与时间锁的解锁脚本：<签名>
+func UnlockSign(sig []byte) Script {
+	return Script{}.AddData(sig)
+}
+
+// UnlockMultiSig，多重签名的解锁脚本：<签名1>...<签名k> <k>，签名须按签名者地址在锁定脚本中的顺序（字典序）排列
+func UnlockMultiSig(sigs [][]byte) Script {
+	var script Script
+	for _, sig := range sigs {
+		script = script.AddData(sig)
+	}
+	return script.AddInt(int64(len(sigs)))
+}
+
+// UnlockHTLCClaim，合约领取的解锁脚本：<签名> <原像> OP_TRUE
+func UnlockHTLCClaim(sig, preimage []byte) Script {
+	return Script{}.AddData(sig).AddData(preimage).AddOp(OP_TRUE)
+}
+
+// UnlockHTLCRefund，合约退款的解锁脚本：<签名> OP_FALSE，交易须锁定至超时高度
+func UnlockHTLCRefund(sig []byte) Script {
+	return Script{}.AddData(sig).AddOp(OP_FALSE)
+}
@@ -0,0 +1,359 @@
+package qbtx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"uss"
+	"utils"
+)
+
+// ScriptContext，脚本执行的上下文：被校验的交易与输入项，以及交易所在或将被打包进的区块
+type ScriptContext struct {
+	Tx         *Transaction // 花费交易
+	In_id      int          // 解锁脚本所在的输入项编号
+	Height     int64        // 区块高度，OP_HEIGHT压入
+	Time_stamp int64        // 父区块时间戳，OP_TIME压入，与交易的锁定时间采用相同的比较基准
+}
+
+// scriptVM，脚本解释器的状态
+type scriptVM struct {
+	ctx   ScriptContext
+	stack [][]byte // 数据栈
+	conds []bool   // 条件分支栈，全部为真时才执行当前指令
+	ops   int      // 已执行的操作码数
+	sigs  int      // 已校验的签名数
+}
+
+// VerifyScript，执行解锁脚本与锁定脚本，判断输入项能否花费输出。执行结束时栈中须恰好剩下一个真值，解锁脚本不能多压入数据。
+// 执行结果只取决于交易、输入项编号与区块的高度和时间戳；使用OP_HEIGHT、OP_TIME的脚本在不同区块中结果可能不同
+// 参数：输入项的解锁脚本Script，被花费输出的锁定脚本Script，执行上下文ScriptContext
+// 返回值：校验错误error，通过时为nil
+func VerifyScript(unlock, lock Script, ctx ScriptContext) error {
+	if !unlock.IsPushOnly() {
+		return ErrScriptNotPushOnly
+	}
+	vm := &scriptVM{ctx: ctx}
+	for _, script := range []Script{unlock, lock} {
+		if err := vm.run(script); err != nil {
+			return err
+		}
+	}
+	if len(vm.stack) == 0 || !asBool(vm.stack[len(vm.stack)-1]) {
+		return ErrScriptFailed
+	}
+	if len(vm.stack) != 1 {
+		return ErrScriptUnclean
+	}
+	return nil
+}
+
+// run，执行一个脚本，条件分支须在脚本内配对
+func (vm *scriptVM) run(script Script) error {
+	ops, err := script.parse()
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if err := vm.step(op); err != nil {
+			return err
+		}
+		if len(vm.stack) > MAX_SCRIPT_STACK {
+			return ErrScriptStackLimit
+		}
+	}
+	if len(vm.conds) != 0 {
+		return ErrScriptUnbalanced
+	}
+	return nil
+}
+
+// executing，判断当前是否处于被执行的分支
+func (vm *scriptVM) executing() bool {
+	for _, cond := range vm.conds {
+		if !cond {
+			return false
+		}
+	}
+	return true
+}
+
+// step，执行一条指令；未执行分支中的指令只计数与处理分支嵌套
+func (vm *scriptVM) step(op scriptOp) error {
+	if op.code > OP_TRUE {
+		vm.ops++
+		if vm.ops > MAX_SCRIPT_OPS {
+			return ErrScriptOpLimit
+		}
+	}
+	switch op.code {
+	case OP_IF:
+		cond := false
+		if vm.executing() {
+			top, err := vm.pop()
+			if err != nil {
+				return err
+			}
+			cond = asBool(top)
+		}
+		vm.conds = append(vm.conds, cond)
+		return nil
+	case OP_ELSE:
+		if len(vm.conds) == 0 {
+			return ErrScriptUnbalanced
+		}
+		vm.conds[len(vm.conds)-1] = !vm.conds[len(vm.conds)-1]
+		return nil
+	case OP_ENDIF:
+		if len(vm.conds) == 0 {
+			return ErrScriptUnbalanced
+		}
+		vm.conds = vm.conds[:len(vm.conds)-1]
+		return nil
+	}
+	if !vm.executing() {
+		return nil
+	}
+
+	switch op.code {
+	case OP_FALSE:
+		vm.push(nil)
+	case OP_PUSHDATA:
+		vm.push(op.data)
+	case OP_TRUE:
+		vm.push(utils.IntToHex(1))
+	case OP_VERIFY:
+		return vm.verify()
+	case OP_DUP:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.push(top)
+		vm.push(top)
+	case OP_DROP:
+		_, err := vm.pop()
+		return err
+	case OP_SWAP:
+		items, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		vm.push(items[0])
+		vm.push(items[1])
+	case OP_EQUAL, OP_EQUALVERIFY:
+		items, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		vm.pushBool(bytes.Equal(items[0], items[1]))
+		if op.code == OP_EQUALVERIFY {
+			return vm.verify()
+		}
+	case OP_LESSTHAN:
+		b, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		a, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		vm.pushBool(a < b)
+	case OP_NOT:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.pushBool(!asBool(top))
+	case OP_SHA256:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256(top)
+		vm.push(digest[:])
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		items, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		ok, err := vm.checkSig(items[0], string(items[1]))
+		if err != nil {
+			return err
+		}
+		vm.pushBool(ok)
+		if op.code == OP_CHECKSIGVERIFY {
+			return vm.verify()
+		}
+	case OP_CHECKMULTISIG:
+		return vm.checkMultiSig()
+	case OP_HEIGHT:
+		vm.push(utils.IntToHex(vm.ctx.Height))
+	case OP_TIME:
+		vm.push(utils.IntToHex(vm.ctx.Time_stamp))
+	case OP_CHECKLOCKTIMEVERIFY:
+		lock_time, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		tx_lock := vm.ctx.Tx.Lock_time
+		if lock_time < 0 || (lock_time < LOCK_TIME_THRESHOLD) != (tx_lock < LOCK_TIME_THRESHOLD) || tx_lock < lock_time {
+			return fmt.Errorf("%w: lock time %d, required %d", ErrScriptLockTime, tx_lock, lock_time)
+		}
+	}
+	return nil
+}
+
+// checkSig，校验一个编码后的签名：签名对本输入项有效且签名者为地址所有者。签名无法解码或无效时返回false，不中止脚本
+func (vm *scriptVM) checkSig(data []byte, addr string) (bool, error) {
+	vm.sigs++
+	if vm.sigs > MAX_SCRIPT_SIGS {
+		return false, ErrScriptSigLimit
+	}
+	sign, err := decodeScriptSign(data)
+	if err != nil {
+		return false, nil
+	}
+	if utils.GetAddrOwner(addr) != sign.Main_row_num.Sign_node_name {
+		return false, nil
+	}
+	return vm.ctx.Tx.verifySign(vm.ctx.In_id, sign) == nil, nil
+}
+
+// checkMultiSig，执行OP_CHECKMULTISIG：栈自顶向下为n、n个地址、m、k、k个签名。
+// 签名须按地址的顺序给出且每个签名都有效，每个地址至多对应一个签名；出现无效、重复或顺序不对的签名时结果为假
+func (vm *scriptVM) checkMultiSig() error {
+	n, err := vm.popInt()
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > MAX_MULTISIG_ADDRS {
+		return fmt.Errorf("%w: %d addresses", ErrScriptMalformed, n)
+	}
+	addrs, err := vm.popN(int(n))
+	if err != nil {
+		return err
+	}
+	m, err := vm.popInt()
+	if err != nil {
+		return err
+	}
+	if m < 1 || m > n {
+		return fmt.Errorf("%w: %d of %d", ErrScriptMalformed, m, n)
+	}
+	k, err := vm.popInt()
+	if err != nil {
+		return err
+	}
+	if k < 0 || k > MAX_MULTISIG_ADDRS {
+		return fmt.Errorf("%w: %d signatures", ErrScriptMalformed, k)
+	}
+	sigs, err := vm.popN(int(k))
+	if err != nil {
+		return err
+	}
+	next := 0 // 下一个可与签名对应的地址
+	for _, sig := range sigs {
+		matched := false
+		for !matched && next < len(addrs) {
+			matched, err = vm.checkSigOwner(sig, string(addrs[next]))
+			if err != nil {
+				return err
+			}
+			next++
+		}
+		if !matched {
+			vm.pushBool(false)
+			return nil
+		}
+	}
+	vm.pushBool(k >= m)
+	return nil
+}
+
+// checkSigOwner，先以签名者核对地址，只对签名者拥有的地址校验签名，避免为每个地址重复验签
+func (vm *scriptVM) checkSigOwner(data []byte, addr string) (bool, error) {
+	sign, err := decodeScriptSign(data)
+	if err != nil || utils.GetAddrOwner(addr) != sign.Main_row_num.Sign_node_name {
+		return false, nil
+	}
+	return vm.checkSig(data, addr)
+}
+
+// verify，弹出栈顶，为假时脚本失败
+func (vm *scriptVM) verify() error {
+	top, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if !asBool(top) {
+		return ErrScriptVerify
+	}
+	return nil
+}
+
+// push，压入一项
+func (vm *scriptVM) push(data []byte) {
+	vm.stack = append(vm.stack, data)
+}
+
+// pushBool，压入真（整数1）或假（空数据）
+func (vm *scriptVM) pushBool(b bool) {
+	if b {
+		vm.push(utils.IntToHex(1))
+	} else {
+		vm.push(nil)
+	}
+}
+
+// pop，弹出栈顶
+func (vm *scriptVM) pop() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, ErrScriptStack
+	}
+	top := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return top, nil
+}
+
+// popN，弹出n项，按压栈顺序返回
+func (vm *scriptVM) popN(n int) ([][]byte, error) {
+	if n > len(vm.stack) {
+		return nil, ErrScriptStack
+	}
+	items := append([][]byte(nil), vm.stack[len(vm.stack)-n:]...)
+	vm.stack = vm.stack[:len(vm.stack)-n]
+	return items, nil
+}
+
+// popInt，弹出栈顶并按8字节大端整数解码
+func (vm *scriptVM) popInt() (int64, error) {
+	top, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	if len(top) != 8 {
+		return 0, ErrScriptNumber
+	}
+	return int64(binary.BigEndian.Uint64(top)), nil
+}
+
+// asBool，数据项的真值：含非零字节时为真
+func asBool(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeScriptSign，解码脚本中的签名数据
+func decodeScriptSign(data []byte) (uss.USSToeplitzHashSignMsg, error) {
+	var sign uss.USSToeplitzHashSignMsg
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&sign)
+	return sign, err
+}
@@ -1,6 +1,10 @@
 package qbtx
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"qkdserv"
 	"testing"
@@ -17,7 +21,7 @@ func TestQBTX(t *testing.T) {
 		Refer_tx_id:       []byte("egry"),
 		Refer_tx_id_index: 1,
 		TX_uss_sign:       uss.USSToeplitzHashSignMsg{},
-		TX_src:            "C1",
+		TX_src:            "1CG9GcxF2BT1rjxwoMHSLtRP9RTCsSkRyH", // C1的钱包地址
 	}
 	var Inputs []TXInput
 	Inputs = append(Inputs, txInput)
@@ -32,12 +36,335 @@ func TestQBTX(t *testing.T) {
 		TX_vin:  Inputs,
 		TX_vout: outputs,
 	}
-	tx.SetID()
 	tx.USSTransactionSign("C1")
+	tx.TX_id = tx.SetID()
 	fmt.Println("sign success")
 	qkdserv.Node_name = "P1"
-	if tx.VerifyUSSTransactionSign() {
-		fmt.Println("sign and verify of tx success")
+	if errs := tx.VerifyUSSTransactionSign(); len(errs) != 0 {
+		t.Fatal(errs)
 	}
+	fmt.Println("sign and verify of tx success")
 
+	// 篡改输出金额，签名消息与修剪交易不再一致
+	forged := tx
+	forged.TX_vout = []TXOutput{{TX_value: 100, TX_dst: "P3"}}
+	errs := forged.VerifyUSSTransactionSign()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrSignMessageMismatch) {
+		t.Errorf("forged output: got %v, want %v", errs, ErrSignMessageMismatch)
+	}
+
+	// 篡改输出的资产或将交易改为发行交易，签名同样失效
+	forged = tx
+	forged.TX_vout = []TXOutput{{TX_value: 1, TX_dst: "P3", Asset: "BOND"}}
+	errs = forged.VerifyUSSTransactionSign()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrSignMessageMismatch) {
+		t.Errorf("forged asset: got %v, want %v", errs, ErrSignMessageMismatch)
+	}
+	forged = tx
+	forged.Issue_asset = "BOND"
+	errs = forged.VerifyUSSTransactionSign()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrSignMessageMismatch) {
+		t.Errorf("forged issue: got %v, want %v", errs, ErrSignMessageMismatch)
+	}
+
+	// C2花费C1地址上的钱
+	qkdserv.Node_name = "C2"
+	stolen := Transaction{TX_vin: []TXInput{txInput}, TX_vout: outputs}
+	stolen.USSTransactionSign("C2")
+	qkdserv.Node_name = "P1"
+	errs = stolen.VerifyUSSTransactionSign()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrSignerNotOwner) {
+		t.Errorf("foreign signer: got %v, want %v", errs, ErrSignerNotOwner)
+	}
+
+	// 未签名的输入项
+	unsigned := Transaction{TX_vin: []TXInput{txInput}, TX_vout: outputs}
+	errs = unsigned.VerifyUSSTransactionSign()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrUnknownSigner) {
+		t.Errorf("unsigned input: got %v, want %v", errs, ErrUnknownSigner)
+	}
+}
+
+func TestAssetID(t *testing.T) {
+	fmt.Println("----------【Transaciton】——asset ids----------------------------------------------------------------------")
+	for _, asset := range []string{"BOND", "REPO2026", "0123456789ABCDEF"} {
+		if err := ValidateAssetID(asset); err != nil {
+			t.Errorf("%q: %v", asset, err)
+		}
+	}
+	for _, asset := range []string{"", "bond", "BOND-1", "0123456789ABCDEFG"} {
+		if err := ValidateAssetID(asset); !errors.Is(err, ErrAssetID) {
+			t.Errorf("%q: got %v, want %v", asset, err, ErrAssetID)
+		}
+	}
+}
+
+func TestMultiSig(t *testing.T) {
+	fmt.Println("----------【Transaciton】——CoSign && multisig script---------------------------------------------------------")
+	qkdserv.QKD_sign_random_matrix_pool = make(map[qkdserv.QKDSignMatrixIndex]qkdserv.QKDSignRandomsMatrix)
+	N = 4
+	addrs := []string{
+		"1NnLuxC3JxzqmD752Gp5qtfDCskRHXWYn6", // P3的钱包地址
+		"195KpL1PxRzvVKxg33YYbWjgFqxFAbBit9", // P1的钱包地址
+		"1GXGEbz9aJpkL96DzUCxi8WdttJhzMeR3r", // P2的钱包地址
+	}
+	if _, err := NewMultiSig(4, addrs); !errors.Is(err, ErrMultiSigMalformed) {
+		t.Errorf("4 of 3: got %v, want %v", err, ErrMultiSigMalformed)
+	}
+	if _, err := NewMultiSig(1, []string{addrs[0], addrs[0]}); !errors.Is(err, ErrMultiSigMalformed) {
+		t.Errorf("repeated address: got %v, want %v", err, ErrMultiSigMalformed)
+	}
+	lock, err := MultiSigScript(2, addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := Transaction{
+		TX_vin:  []TXInput{{Refer_tx_id: []byte("multisig"), TX_src: "multisig address", Unlock_script: UnlockMultiSig(nil)}},
+		TX_vout: []TXOutput{{TX_value: 1, TX_dst: "1CG9GcxF2BT1rjxwoMHSLtRP9RTCsSkRyH"}},
+	}
+	tx.USSTransactionSign("C1") // 带解锁脚本的输入项不做普通签名
+	if len(tx.TX_vin[0].TX_uss_sign.USS_signature) != 0 {
+		t.Fatal("multisig input is signed by USSTransactionSign")
+	}
+	cosign := func(node_name string) error {
+		qkdserv.Node_name = node_name
+		return tx.CoSign(0, node_name)
+	}
+	verify := func() error {
+		qkdserv.Node_name = "P4"
+		return VerifyScript(tx.TX_vin[0].Unlock_script, lock, ScriptContext{Tx: &tx, In_id: 0, Height: 1})
+	}
+
+	// 门限未达到
+	if err = cosign("P1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = verify(); !errors.Is(err, ErrScriptFailed) {
+		t.Errorf("1 of 2: got %v, want %v", err, ErrScriptFailed)
+	}
+	if err = cosign("P1"); !errors.Is(err, ErrMultiSigDuplicate) {
+		t.Errorf("second signature of P1: got %v, want %v", err, ErrMultiSigDuplicate)
+	}
+
+	// 达到门限：签名按地址顺序排列，交易ID不随解锁脚本改变
+	id := tx.SetID()
+	if err = cosign("P2"); err != nil {
+		t.Fatal(err)
+	}
+	if err = verify(); err != nil {
+		t.Fatalf("2 of 2: %v", err)
+	}
+	if !bytes.Equal(tx.SetID(), id) {
+		t.Error("co-signing changes the transaction id")
+	}
+
+	// 不是多重签名解锁脚本的输入项
+	plain := Transaction{TX_vin: []TXInput{{Refer_tx_id: []byte("plain"), TX_src: "address"}}}
+	if err = plain.CoSign(0, "P3"); !errors.Is(err, ErrNotMultiSigInput) {
+		t.Errorf("input without unlocking script: got %v, want %v", err, ErrNotMultiSigInput)
+	}
+	if err = tx.CoSign(1, "P3"); !errors.Is(err, ErrNotMultiSigInput) {
+		t.Errorf("input out of range: got %v, want %v", err, ErrNotMultiSigInput)
+	}
+}
+
+func TestHTLC(t *testing.T) {
+	fmt.Println("----------【Transaciton】——HTLC contract------------------------------------------------------------------")
+	const (
+		addrC1 = "1CG9GcxF2BT1rjxwoMHSLtRP9RTCsSkRyH" // C1的钱包地址，发送方
+		addrP1 = "195KpL1PxRzvVKxg33YYbWjgFqxFAbBit9" // P1的钱包地址，接收方
+	)
+	preimage := []byte("atomic swap secret")
+	digest := sha256.Sum256(preimage)
+	if _, err := NewHTLC(digest[:], addrP1, addrC1, 10); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		h    HTLC
+	}{
+		{"short hash lock", HTLC{preimage, addrP1, addrC1, 10}},
+		{"no receiver", HTLC{digest[:], "", addrC1, 10}},
+		{"no sender", HTLC{digest[:], addrP1, "", 10}},
+		{"timeout is a time", HTLC{digest[:], addrP1, addrC1, LOCK_TIME_THRESHOLD}},
+	}
+	for _, c := range cases {
+		if _, err := HTLCScript(&c.h); !errors.Is(err, ErrHTLCMalformed) {
+			t.Errorf("%s: got %v, want %v", c.name, err, ErrHTLCMalformed)
+		}
+	}
+}
+
+func TestScript(t *testing.T) {
+	fmt.Println("----------【Transaciton】——Locking && unlocking scripts------------------------------------------------------")
+	qkdserv.QKD_sign_random_matrix_pool = make(map[qkdserv.QKDSignMatrixIndex]qkdserv.QKDSignRandomsMatrix)
+	N = 4
+	const (
+		addrC1 = "1CG9GcxF2BT1rjxwoMHSLtRP9RTCsSkRyH" // C1的钱包地址
+		addrP1 = "195KpL1PxRzvVKxg33YYbWjgFqxFAbBit9" // P1的钱包地址
+		addrP2 = "1GXGEbz9aJpkL96DzUCxi8WdttJhzMeR3r" // P2的钱包地址
+		addrP3 = "1NnLuxC3JxzqmD752Gp5qtfDCskRHXWYn6" // P3的钱包地址
+	)
+	tx := Transaction{
+		TX_vin:  []TXInput{{Refer_tx_id: []byte("script"), TX_src: "script address"}},
+		TX_vout: []TXOutput{{TX_value: 1, TX_dst: addrC1}},
+	}
+	// sign，signer对输入项签名
+	sign := func(tx *Transaction, signer string) []byte {
+		qkdserv.Node_name = signer
+		return tx.ScriptSign(0, signer)
+	}
+	// run，在height高度以unlock花费lock
+	run := func(tx *Transaction, unlock, lock Script, height int64) error {
+		qkdserv.Node_name = "P4"
+		tx.TX_vin[0].Unlock_script = unlock // 解锁脚本不在签名范围内
+		return VerifyScript(unlock, lock, ScriptContext{Tx: tx, In_id: 0, Height: height})
+	}
+
+	// 支付到地址
+	p2a := PayToAddressScript(addrP1)
+	if got, want := p2a.String(), addrP1+" OP_CHECKSIG"; got != want {
+		t.Errorf("disassembly: got %q, want %q", got, want)
+	}
+	if err := run(&tx, UnlockSign(sign(&tx, "P1")), p2a, 1); err != nil {
+		t.Errorf("pay to address: %v", err)
+	}
+	if err := run(&tx, UnlockSign(sign(&tx, "C1")), p2a, 1); !errors.Is(err, ErrScriptFailed) {
+		t.Errorf("signed by another node: got %v, want %v", err, ErrScriptFailed)
+	}
+	forged := tx
+	forged.TX_vout = []TXOutput{{TX_value: 100, TX_dst: addrC1}}
+	forged.TX_vin = []TXInput{tx.TX_vin[0]}
+	if err := run(&forged, UnlockSign(sign(&tx, "P1")), p2a, 1); !errors.Is(err, ErrScriptFailed) {
+		t.Errorf("forged output: got %v, want %v", err, ErrScriptFailed)
+	}
+
+	// 2-of-3多重签名
+	ms, err := MultiSigScript(2, []string{addrP3, addrP1, addrP2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigP1, sigP2 := sign(&tx, "P1"), sign(&tx, "P2")
+	if err = run(&tx, UnlockMultiSig([][]byte{sigP1, sigP2}), ms, 1); err != nil {
+		t.Errorf("2 of 3: %v", err)
+	}
+	// 签名须按地址顺序给出，重排后的解锁脚本无效
+	if err = run(&tx, UnlockMultiSig([][]byte{sigP2, sigP1}), ms, 1); !errors.Is(err, ErrScriptFailed) {
+		t.Errorf("signatures out of order: got %v, want %v", err, ErrScriptFailed)
+	}
+	if err = run(&tx, UnlockMultiSig([][]byte{sigP1, sigP1}), ms, 1); !errors.Is(err, ErrScriptFailed) {
+		t.Errorf("repeated signature: got %v, want %v", err, ErrScriptFailed)
+	}
+	if err = run(&tx, UnlockMultiSig([][]byte{sigP1}), ms, 1); !errors.Is(err, ErrScriptFailed) {
+		t.Errorf("1 of 3: got %v, want %v", err, ErrScriptFailed)
+	}
+
+	// 哈希时间锁合约：超时前领取，超时后退款
+	preimage := []byte("atomic swap secret")
+	digest := sha256.Sum256(preimage)
+	h, _ := NewHTLC(digest[:], addrP1, addrC1, 10)
+	htlc, err := HTLCScript(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = run(&tx, UnlockHTLCClaim(sign(&tx, "P1"), preimage), htlc, 9); err != nil {
+		t.Errorf("claim: %v", err)
+	}
+	if err = run(&tx, UnlockHTLCClaim(sign(&tx, "P1"), preimage), htlc, 10); !errors.Is(err, ErrScriptVerify) {
+		t.Errorf("claim at timeout: got %v, want %v", err, ErrScriptVerify)
+	}
+	if err = run(&tx, UnlockHTLCClaim(sign(&tx, "P1"), []byte("wrong")), htlc, 9); !errors.Is(err, ErrScriptVerify) {
+		t.Errorf("wrong preimage: got %v, want %v", err, ErrScriptVerify)
+	}
+	refund := tx
+	refund.TX_vin = []TXInput{tx.TX_vin[0]}
+	refund.Lock_time = 10
+	if err = run(&refund, UnlockHTLCRefund(sign(&refund, "C1")), htlc, 10); err != nil {
+		t.Errorf("refund: %v", err)
+	}
+	refund.Lock_time = 9
+	if err = run(&refund, UnlockHTLCRefund(sign(&refund, "C1")), htlc, 10); !errors.Is(err, ErrScriptLockTime) {
+		t.Errorf("refund before timeout: got %v, want %v", err, ErrScriptLockTime)
+	}
+
+	// 时间锁：锁定高度不能以时间戳满足
+	locked := tx
+	locked.TX_vin = []TXInput{tx.TX_vin[0]}
+	locked.Lock_time = 10
+	if err = run(&locked, UnlockSign(sign(&locked, "C1")), TimeLockScript(10, addrC1), 10); err != nil {
+		t.Errorf("time lock: %v", err)
+	}
+	locked.Lock_time = LOCK_TIME_THRESHOLD + 10
+	if err = run(&locked, UnlockSign(sign(&locked, "C1")), TimeLockScript(10, addrC1), 10); !errors.Is(err, ErrScriptLockTime) {
+		t.Errorf("height lock with a time lock: got %v, want %v", err, ErrScriptLockTime)
+	}
+
+	// 脚本格式与资源限制
+	many := func(op byte, count int) Script {
+		script := Script{}.AddOp(OP_TRUE)
+		for i := 0; i < count; i++ {
+			script = script.AddOp(op)
+		}
+		return script
+	}
+	cases := []struct {
+		name         string
+		unlock, lock Script
+		want         error
+	}{
+		{"unlock with an operation", Script{OP_TRUE, OP_NOT}, Script{OP_TRUE}, ErrScriptNotPushOnly},
+		{"unknown opcode", Script{OP_TRUE}, Script{0xff}, ErrScriptMalformed},
+		{"truncated push", Script{OP_TRUE}, Script{OP_PUSHDATA, 0, 5, 1}, ErrScriptMalformed},
+		{"unbalanced if", Script{OP_TRUE}, Script{OP_IF}, ErrScriptUnbalanced},
+		{"empty stack", Script{}, Script{OP_DROP}, ErrScriptStack},
+		{"not a number", Script{OP_TRUE}, Script{}.AddData([]byte{1}).AddOp(OP_LESSTHAN), ErrScriptNumber},
+		{"operation limit", Script{OP_TRUE}, many(OP_NOT, MAX_SCRIPT_OPS+1), ErrScriptOpLimit},
+		{"stack limit", Script{OP_TRUE}, many(OP_DUP, MAX_SCRIPT_STACK), ErrScriptStackLimit},
+		{"size limit", Script{OP_TRUE}, make(Script, MAX_SCRIPT_SIZE+1), ErrScriptTooLarge},
+		{"false result", Script{OP_TRUE}, Script{OP_NOT}, ErrScriptFailed},
+		{"unclean stack", Script{OP_TRUE, OP_TRUE}, Script{}, ErrScriptUnclean},
+	}
+	for _, c := range cases {
+		if err = run(&tx, c.unlock, c.lock, 1); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestEncodeTX(t *testing.T) {
+	fmt.Println("----------【Transaciton】——EncodeTX------------------------------------------------------------------------")
+	base := func() *Transaction {
+		return &Transaction{
+			TX_vin:  []TXInput{{Refer_tx_id: []byte{0xab}, Refer_tx_id_index: 1, TX_src: "C1"}},
+			TX_vout: []TXOutput{{TX_value: 5, TX_dst: "P1"}},
+		}
+	}
+	// 版本、输入项、输出项，可选字段为空时只有结束标签
+	if got := hex.EncodeToString(base().EncodeTX()); got != "010101ab0202433100010a0250310000" {
+		t.Fatalf("encoding changed: %s", got)
+	}
+	id := base().SetID()
+	// 设置任一可选字段都改变交易ID
+	options := map[string]func(tx *Transaction){
+		"lock time":   func(tx *Transaction) { tx.Lock_time = 5 },
+		"issue asset": func(tx *Transaction) { tx.Issue_asset = "BOND" },
+		"asset":       func(tx *Transaction) { tx.TX_vout[0].Asset = "BOND" },
+		"lock blocks": func(tx *Transaction) { tx.TX_vout[0].Lock_blocks = 3 },
+		"lock script": func(tx *Transaction) { tx.TX_vout[0].Lock_script = Script{OP_TRUE} },
+	}
+	for name, option := range options {
+		tx := base()
+		option(tx)
+		if bytes.Equal(tx.SetID(), id) {
+			t.Errorf("%s does not change the id", name)
+		}
+	}
+	// 解锁脚本只进入完整编码（默克尔树叶子），不改变交易ID
+	unlocked := base()
+	unlocked.TX_vin[0].Unlock_script = Script{OP_TRUE}
+	if !bytes.Equal(unlocked.SetID(), id) || bytes.Equal(unlocked.EncodeTX(), base().EncodeTX()) {
+		t.Error("unlock script must change the encoding but not the id")
+	}
+	fmt.Println("encode transaction success")
 }
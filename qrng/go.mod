@@ -0,0 +1,3 @@
+module qrng
+
+go 1.16
@@ -0,0 +1,74 @@
+// qrng包，随机数熵源抽象，为签名序列号、准备金数据等提供随机数
+// 创建人：zhanglu
+// 创建时间：2026/10/19
+// 使用须知：默认熵源为操作系统随机数，接入QRNG设备或需要可复现的测试时，通过qrng.SetDefault更换熵源
+package qrng
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// EntropySource，熵源接口，所有随机数来源均需实现
+type EntropySource interface {
+	io.Reader
+	Name() string // 熵源名称，用于日志输出
+}
+
+// 当前使用的熵源，默认为操作系统随机数
+var (
+	default_source EntropySource = NewOSSource()
+	default_mu     sync.RWMutex
+)
+
+// SetDefault，更换全局默认熵源
+// 参数：熵源EntropySource
+// 返回值：无
+func SetDefault(src EntropySource) {
+	default_mu.Lock()
+	defer default_mu.Unlock()
+	default_source = src
+}
+
+// Default，获取全局默认熵源
+// 参数：无
+// 返回值：熵源EntropySource
+func Default() EntropySource {
+	default_mu.RLock()
+	defer default_mu.RUnlock()
+	return default_source
+}
+
+// Read，从默认熵源读取len(b)字节随机数
+// 参数：存放随机数的[]byte
+// 返回值：读取的字节数int，读取错误error
+func Read(b []byte) (int, error) {
+	return io.ReadFull(Default(), b)
+}
+
+// NewSourceFromSpec，根据配置字符串生成熵源
+// 参数：配置字符串，"os"：操作系统随机数；"file:<路径>"：QRNG设备或随机数文件，附带健康检测；"seed:<种子>"：确定性熵源，仅用于测试
+// 返回值：熵源EntropySource，解析错误error
+func NewSourceFromSpec(spec string) (EntropySource, error) {
+	switch {
+	case spec == "" || spec == "os":
+		return NewOSSource(), nil
+	case strings.HasPrefix(spec, "file:"):
+		path := strings.TrimPrefix(spec, "file:")
+		if path == "" {
+			return nil, errors.New("qrng: empty device path")
+		}
+		src, err := NewFileSource(path)
+		if err != nil {
+			return nil, err
+		}
+		return NewHealthTestedSource(src, FILE_MIN_ENTROPY)
+	case strings.HasPrefix(spec, "seed:"):
+		return NewSeededSource([]byte(strings.TrimPrefix(spec, "seed:"))), nil
+	default:
+		return nil, fmt.Errorf("qrng: unknown entropy source %q", spec)
+	}
+}
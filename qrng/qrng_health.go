@@ -0,0 +1,198 @@
+package qrng
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// 健康检测参数，参照NIST SP 800-90B 4.4节
+const (
+	ALPHA_EXP       = 20   // 误报概率α=2^-20
+	APT_WINDOW      = 512  // 自适应比例检测窗口大小（非二元样本）
+	STARTUP_SAMPLE  = 1024 // 启动检测样本数，启动检测通过前不输出随机数
+	MAX_EMPTY_READS = 100  // 下层熵源连续返回0字节且无错误的次数上限，达到后返回io.ErrNoProgress
+)
+
+// 健康检测失败错误
+var (
+	ErrRepetitionCount    = errors.New("qrng: repetition count test failed")
+	ErrAdaptiveProportion = errors.New("qrng: adaptive proportion test failed")
+)
+
+// HealthTestedSource，带连续健康检测的熵源：对输出的每个字节（样本）执行重复计数检测与自适应比例检测，
+// 检测失败后熵源进入失败状态，不再输出随机数，直到调用Reset
+type HealthTestedSource struct {
+	src         EntropySource
+	min_entropy float64 // 每字节最小熵估计值H
+
+	rct_cutoff int  // 重复计数检测阈值
+	rct_last   byte // 上一个样本
+	rct_count  int  // 上一个样本连续出现的次数
+
+	apt_cutoff int  // 自适应比例检测阈值
+	apt_first  byte // 当前窗口的第一个样本
+	apt_count  int  // 当前窗口内第一个样本出现的次数
+	apt_index  int  // 当前窗口内已检测的样本数
+
+	started bool  // 是否已通过启动检测
+	failure error // 失败原因，nil表示正常
+	mu      sync.Mutex
+}
+
+// NewHealthTestedSource，为熵源附加健康检测
+// 参数：被检测的熵源EntropySource，每字节最小熵估计值float64，取值(0,8]
+// 返回值：带健康检测的熵源*HealthTestedSource，参数错误error
+func NewHealthTestedSource(src EntropySource, min_entropy float64) (*HealthTestedSource, error) {
+	if min_entropy <= 0 || min_entropy > 8 {
+		return nil, fmt.Errorf("qrng: min-entropy %v out of range (0,8]", min_entropy)
+	}
+	return &HealthTestedSource{
+		src:         src,
+		min_entropy: min_entropy,
+		rct_cutoff:  RepetitionCountCutoff(min_entropy),
+		apt_cutoff:  AdaptiveProportionCutoff(APT_WINDOW, min_entropy),
+	}, nil
+}
+
+// Read，读取随机数并进行健康检测，检测失败时返回错误且不输出任何数据
+func (h *HealthTestedSource) Read(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failure != nil {
+		return 0, h.failure
+	}
+	if !h.started { // 启动检测：丢弃并检测最初的样本
+		startup := make([]byte, STARTUP_SAMPLE)
+		if err := h.readTested(startup); err != nil {
+			return 0, err
+		}
+		h.started = true
+	}
+	if err := h.readTested(p); err != nil {
+		for i := range p { // 失败时清除已读取的数据，避免被误用
+			p[i] = 0
+		}
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Name，熵源名称
+func (h *HealthTestedSource) Name() string {
+	return h.src.Name() + "+health"
+}
+
+// Failure，获取健康检测失败原因，正常时返回nil
+func (h *HealthTestedSource) Failure() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failure
+}
+
+// Reset，清除失败状态并重新执行启动检测，一般在设备维护后调用
+func (h *HealthTestedSource) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failure = nil
+	h.started = false
+	h.rct_count = 0
+	h.apt_index = 0
+}
+
+// readTested，从下层熵源读满p，并逐字节进行检测；熵源连续MAX_EMPTY_READS次既无数据也无错误时返回io.ErrNoProgress，不无限等待
+func (h *HealthTestedSource) readTested(p []byte) error {
+	n := 0
+	empty := 0
+	for n < len(p) {
+		m, err := h.src.Read(p[n:])
+		if m == 0 && err == nil {
+			empty++
+			if empty >= MAX_EMPTY_READS {
+				return io.ErrNoProgress
+			}
+			continue
+		}
+		empty = 0
+		for _, sample := range p[n : n+m] {
+			if e := h.test(sample); e != nil {
+				h.failure = e
+				return e
+			}
+		}
+		n += m
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// test，对单个样本执行重复计数检测与自适应比例检测
+func (h *HealthTestedSource) test(sample byte) error {
+	// 1.重复计数检测：同一样本连续出现次数达到阈值即失败
+	if h.rct_count > 0 && sample == h.rct_last {
+		h.rct_count++
+		if h.rct_count >= h.rct_cutoff {
+			return ErrRepetitionCount
+		}
+	} else {
+		h.rct_last = sample
+		h.rct_count = 1
+	}
+
+	// 2.自适应比例检测：窗口内第一个样本出现次数达到阈值即失败
+	if h.apt_index == 0 {
+		h.apt_first = sample
+		h.apt_count = 1
+	} else if sample == h.apt_first {
+		h.apt_count++
+		if h.apt_count >= h.apt_cutoff {
+			return ErrAdaptiveProportion
+		}
+	}
+	h.apt_index++
+	if h.apt_index == APT_WINDOW {
+		h.apt_index = 0
+	}
+	return nil
+}
+
+// RepetitionCountCutoff，计算重复计数检测阈值C=1+⌈-log2(α)/H⌉
+// 参数：每样本最小熵H
+// 返回值：阈值int
+func RepetitionCountCutoff(min_entropy float64) int {
+	return 1 + int(math.Ceil(float64(ALPHA_EXP)/min_entropy))
+}
+
+// AdaptiveProportionCutoff，计算自适应比例检测阈值C=1+CRITBINOM(W,2^-H,1-α)
+// 参数：窗口大小W，每样本最小熵H
+// 返回值：阈值int
+func AdaptiveProportionCutoff(window int, min_entropy float64) int {
+	p := math.Pow(2, -min_entropy)
+	q := 1 - math.Pow(2, -ALPHA_EXP)
+	cdf := 0.0
+	for k := 0; k <= window; k++ {
+		cdf += binomialPMF(window, k, p)
+		if cdf >= q {
+			return k + 1
+		}
+	}
+	return window
+}
+
+// binomialPMF，二项分布概率P(X=k)，X~B(n,p)
+func binomialPMF(n, k int, p float64) float64 {
+	if p >= 1 {
+		if k == n {
+			return 1
+		}
+		return 0
+	}
+	lg_n, _ := math.Lgamma(float64(n + 1))
+	lg_k, _ := math.Lgamma(float64(k + 1))
+	lg_nk, _ := math.Lgamma(float64(n - k + 1))
+	return math.Exp(lg_n - lg_k - lg_nk + float64(k)*math.Log(p) + float64(n-k)*math.Log1p(-p))
+}
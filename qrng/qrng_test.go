@@ -0,0 +1,133 @@
+package qrng
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// constSource，恒定输出的故障熵源，用于触发健康检测
+type constSource struct{ b byte }
+
+func (s *constSource) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = s.b
+	}
+	return len(p), nil
+}
+func (s *constSource) Name() string { return "const" }
+
+// biasedSource，每隔一个字节输出同一固定值的偏置熵源，重复计数检测无法发现，需由自适应比例检测发现
+type biasedSource struct{ inner EntropySource }
+
+func (s *biasedSource) Read(p []byte) (int, error) {
+	n, err := s.inner.Read(p)
+	for i := 0; i < n; i += 2 {
+		p[i] = 0xAA
+	}
+	return n, err
+}
+func (s *biasedSource) Name() string { return "biased" }
+
+// emptySource，既不输出数据也不返回错误的故障熵源
+type emptySource struct{ reads int }
+
+func (s *emptySource) Read(p []byte) (int, error) {
+	s.reads++
+	return 0, nil
+}
+func (s *emptySource) Name() string { return "empty" }
+
+// 测试：相同种子得到相同输出，不同种子得到不同输出
+func TestSeededSource(t *testing.T) {
+	fmt.Println("----------【qrng】——SeededSource--------------------------------------------------------------------")
+	a := make([]byte, 100)
+	b := make([]byte, 100)
+	c := make([]byte, 100)
+	NewSeededSource([]byte("test")).Read(a)
+	src := NewSeededSource([]byte("test"))
+	src.Read(b[:7]) // 分段读取与一次读取结果应一致
+	src.Read(b[7:])
+	NewSeededSource([]byte("other")).Read(c)
+	if !bytes.Equal(a, b) {
+		t.Error("seeded source is not deterministic")
+	}
+	if bytes.Equal(a, c) {
+		t.Error("different seeds give the same stream")
+	}
+}
+
+// 测试：阈值与SP 800-90B表2一致
+func TestCutoff(t *testing.T) {
+	fmt.Println("----------【qrng】——Cutoff--------------------------------------------------------------------------")
+	apt := map[float64]int{0.5: 410, 1: 311, 2: 177, 4: 62, 8: 13}
+	for h, want := range apt {
+		if got := AdaptiveProportionCutoff(APT_WINDOW, h); got != want {
+			t.Errorf("APT cutoff H=%v: got %d, want %d", h, got, want)
+		}
+	}
+	if got := RepetitionCountCutoff(1); got != 21 {
+		t.Errorf("RCT cutoff H=1: got %d, want 21", got)
+	}
+}
+
+// 测试：健康检测可发现故障熵源，并在失败后拒绝输出
+func TestHealthTestedSource(t *testing.T) {
+	fmt.Println("----------【qrng】——HealthTestedSource--------------------------------------------------------------")
+	good, _ := NewHealthTestedSource(NewSeededSource([]byte("good")), 7)
+	if _, err := good.Read(make([]byte, 1<<16)); err != nil {
+		t.Errorf("healthy source failed: %v", err)
+	}
+
+	stuck, _ := NewHealthTestedSource(&constSource{0x42}, 7)
+	if _, err := stuck.Read(make([]byte, 16)); !errors.Is(err, ErrRepetitionCount) {
+		t.Errorf("stuck source: got %v, want %v", err, ErrRepetitionCount)
+	}
+	if _, err := stuck.Read(make([]byte, 16)); err == nil {
+		t.Error("failed source must not produce output")
+	}
+
+	biased, _ := NewHealthTestedSource(&biasedSource{NewSeededSource([]byte("bias"))}, 7)
+	if _, err := biased.Read(make([]byte, 16)); !errors.Is(err, ErrAdaptiveProportion) {
+		t.Errorf("biased source: got %v, want %v", err, ErrAdaptiveProportion)
+	}
+
+	empty := &emptySource{}
+	silent, _ := NewHealthTestedSource(empty, 7)
+	if _, err := silent.Read(make([]byte, 16)); !errors.Is(err, io.ErrNoProgress) || empty.reads != MAX_EMPTY_READS {
+		t.Errorf("empty source: got %v after %d reads, want %v", err, empty.reads, io.ErrNoProgress)
+	}
+
+	if _, err := NewHealthTestedSource(NewOSSource(), 9); err == nil {
+		t.Error("min-entropy above 8 must be rejected")
+	}
+}
+
+// 测试：根据配置字符串选择熵源
+func TestNewSourceFromSpec(t *testing.T) {
+	fmt.Println("----------【qrng】——NewSourceFromSpec---------------------------------------------------------------")
+	for spec, name := range map[string]string{"": "os", "os": "os", "seed:abc": "seed"} {
+		src, err := NewSourceFromSpec(spec)
+		if err != nil || src.Name() != name {
+			t.Errorf("spec %q: got %v, %v", spec, src, err)
+		}
+	}
+	if _, err := NewSourceFromSpec("file:/nonexistent/qrng"); err == nil {
+		t.Error("missing device must be reported")
+	}
+	if _, err := NewSourceFromSpec("quantum"); err == nil {
+		t.Error("unknown spec must be rejected")
+	}
+
+	SetDefault(NewSeededSource([]byte("default")))
+	defer SetDefault(NewOSSource())
+	a := make([]byte, 32)
+	b := make([]byte, 32)
+	Read(a)
+	NewSeededSource([]byte("default")).Read(b)
+	if !bytes.Equal(a, b) {
+		t.Error("Read does not use the default source")
+	}
+}
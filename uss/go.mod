@@ -4,8 +4,10 @@ go 1.16
 
 replace utils => ../utils
 replace qkdserv => ../qkdserv
+replace qrng => ../qrng
 
 require (
 	qkdserv v0.0.0-00010101000000-000000000000
+	qrng v0.0.0-00010101000000-000000000000
 	utils v0.0.0-00010101000000-000000000000
 )
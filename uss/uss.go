@@ -5,11 +5,11 @@ package uss
 
 import (
 	"bytes"
-	cryptorand "crypto/rand"
 	"fmt"
-	"io"
+	"log"
 
 	"qkdserv"
+	"qrng"
 	"utils"
 )
 
@@ -82,6 +82,18 @@ func UnconditionallySecureVerifySign(uss_sign USSToeplitzHashSignMsg) bool {
 	return verifysign_result
 }
 
+// VerifySign，验签并兼容本节点自己的签名：签名者无法以验签者身份验证自己的签名，本节点的签名以相同签名索引重新签名后比较，
+// 其他节点的签名按UnconditionallySecureVerifySign验签
+// 参数：签名信息USSToeplitzHashSignMsg
+// 返回值：验签结果bool
+func VerifySign(uss_sign USSToeplitzHashSignMsg) bool {
+	if uss_sign.Main_row_num.Sign_node_name == qkdserv.Node_name {
+		resign := UnconditionallySecureSign(uss_sign.Sign_index, uss_sign.USS_counts, uss_sign.USS_unit_len, uss_sign.USS_message)
+		return bytes.Equal(resign.USS_signature, uss_sign.USS_signature)
+	}
+	return UnconditionallySecureVerifySign(uss_sign)
+}
+
 func convertToUSSMessage(m []byte) [1024]byte {
 	var sign_m [1024]byte
 	if len(m) > 1024 {
@@ -102,12 +114,14 @@ func convertToUSSMessage(m []byte) [1024]byte {
 
 }
 
-// GenSignTaskSN，产生指定字节长度的随机数，主要可做签名序列号（一般为16字节）
+// GenSignTaskSN，产生指定字节长度的随机数，主要可做签名序列号（一般为16字节），随机数取自qrng默认熵源
 // 参数：随机数长度uint32
 // 返回值：特定长度的随机数[16]byte
 func GenSignTaskSN(length uint32) [16]byte {
 	sn := make([]byte, length)
-	io.ReadFull(cryptorand.Reader, sn)
+	if _, err := qrng.Read(sn); err != nil { // 熵源故障时不能继续签名
+		log.Panic(err)
+	}
 	var sign_task_sn [16]byte
 	for i := 0; i < 16; i++ {
 		sign_task_sn[i] = sn[i]
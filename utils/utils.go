@@ -15,6 +15,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 )
 
 // 配置文件路径
@@ -70,6 +71,41 @@ func GetNodeID(node_name string) [16]byte {
 	return node_id_table[node_name]
 }
 
+// 钱包地址登记表（钱包地址=节点/客户端名称），第一次使用时读取，之后复用
+var (
+	wallet_addr_table map[string]string
+	wallet_addr_once  sync.Once
+)
+
+// walletAddrTable，获取钱包地址登记表，配置文件只在第一次调用时读取
+// 参数：无
+// 返回值：钱包地址登记表map[string]string
+func walletAddrTable() map[string]string {
+	wallet_addr_once.Do(func() {
+		wallet_addr_table = InitConfig(INIT_PATH + "wallet_addr.txt")
+	})
+	return wallet_addr_table
+}
+
+// GetAddrOwner，获取钱包地址所属的节点/客户端名称
+// 参数：钱包地址string
+// 返回值：节点名称string，地址未登记时返回""
+func GetAddrOwner(addr string) string {
+	return walletAddrTable()[addr]
+}
+
+// GetNodeAddr，获取节点/客户端登记的钱包地址
+// 参数：节点名称string
+// 返回值：钱包地址string，未登记时返回""
+func GetNodeAddr(node_name string) string {
+	for addr, name := range walletAddrTable() {
+		if name == node_name {
+			return addr
+		}
+	}
+	return ""
+}
+
 // Digest，摘要函数
 // 参数：消息[]byte
 // 返回值：摘要值[]byte
@@ -153,6 +189,38 @@ func Send(url string, msg []byte) {
 	http.Post("http://"+url, "application/json", buff)
 }
 
+// Post，http信息发送并读取应答
+// 参数：目的地值，待发送消息
+// 返回值：应答消息[]byte，发送错误error
+func Post(url string, msg []byte) ([]byte, error) {
+	resp, err := http.Post("http://"+url, "application/json", bytes.NewBuffer(msg))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK { // 错误应答的正文为出错原因
+		reason, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("http %s: %s: %s", url, resp.Status, strings.TrimSpace(string(reason)))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Get，http GET请求并读取应答
+// 参数：目的地值（含路径与查询参数）
+// 返回值：应答消息[]byte，请求错误error
+func Get(url string) ([]byte, error) {
+	resp, err := http.Get("http://" + url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK { // 错误应答的正文为出错原因
+		reason, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("http %s: %s: %s", url, resp.Status, strings.TrimSpace(string(reason)))
+	}
+	return io.ReadAll(resp.Body)
+}
+
 // ReverseBytes，将字符串逆序
 // 参数：目标数据
 // 返回值：无